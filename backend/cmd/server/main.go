@@ -2,6 +2,7 @@ package main
 
 import (
 	"context"
+	"fmt"
 	"log/slog"
 	"os"
 	"os/signal"
@@ -9,15 +10,24 @@ import (
 
 	"realmops/internal/api"
 	"realmops/internal/config"
+	"realmops/internal/console"
 	"realmops/internal/db"
 	"realmops/internal/docker"
+	"realmops/internal/events"
 	"realmops/internal/jobs"
+	"realmops/internal/logarchive"
+	"realmops/internal/models"
+	"realmops/internal/notifications"
 	"realmops/internal/packs"
+	"realmops/internal/players"
+	"realmops/internal/podman"
 	"realmops/internal/ports"
 	"realmops/internal/rcon"
+	"realmops/internal/runtime"
 	"realmops/internal/server"
 	"realmops/internal/sftp"
 	"realmops/internal/sshkeys"
+	"realmops/internal/triggers"
 )
 
 func main() {
@@ -49,32 +59,67 @@ func main() {
 		os.Exit(1)
 	}
 
-	dockerRuntime, err := docker.NewProvider(cfg.DockerHost)
+	if len(os.Args) > 1 && os.Args[1] == "repair" {
+		if err := runRepair(cfg, database, os.Args[2:]); err != nil {
+			slog.Error("repair failed", "error", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	containerRuntime, err := newContainerRuntime(cfg)
 	if err != nil {
-		slog.Error("failed to initialize docker provider", "error", err)
+		slog.Error("failed to initialize container runtime", "runtime", cfg.ContainerRuntime, "error", err)
 		os.Exit(1)
 	}
-	defer dockerRuntime.Close()
+	defer containerRuntime.Close()
 
-	// Set docker provider for API status endpoint
-	api.SetDockerProvider(dockerRuntime)
+	// Set container runtime for API status endpoint
+	api.SetDockerProvider(containerRuntime)
 
 	packLoader := packs.NewLoader(cfg.PacksDir)
 
 	portAllocator := ports.NewAllocator(database, cfg.PortRangeStart, cfg.PortRangeEnd)
+	portAllocator.SetProbe(cfg.PortProbe)
+	if excluded, err := config.ParsePortList(cfg.PortExclude); err != nil {
+		slog.Warn("ignoring invalid port exclusion list", "value", cfg.PortExclude, "error", err)
+	} else {
+		portAllocator.SetExcluded(excluded)
+	}
+	if leaks, err := portAllocator.FindLeaks(); err == nil && len(leaks) > 0 {
+		slog.Warn("found leaked port reservations, run the repair command to release them", "count", len(leaks))
+	}
+
+	eventBus := events.NewBus(events.DefaultBufferSize)
 
 	jobRunner := jobs.NewRunner(database)
+	jobRunner.SetEvents(eventBus)
+	jobLimits := jobs.Limits{Global: cfg.JobConcurrency}
+	if perType, err := config.ParseLimits(cfg.JobTypeConcurrency); err != nil {
+		slog.Warn("ignoring invalid job type concurrency", "value", cfg.JobTypeConcurrency, "error", err)
+	} else if len(perType) > 0 {
+		jobLimits.PerType = make(map[models.JobType]int)
+		for jobType, limit := range perType {
+			jobLimits.PerType[models.JobType(jobType)] = limit
+		}
+	}
+	jobRunner.SetLimits(jobLimits)
 
 	serverManager := server.NewManager(
 		database,
-		dockerRuntime,
+		containerRuntime,
 		packLoader,
 		portAllocator,
 		jobRunner,
 		cfg.DataDir,
 	)
+	serverManager.SetEvents(eventBus)
 
 	rconManager := rcon.NewManager()
+	playerTracker := players.NewTracker(database, serverManager, packLoader, containerRuntime, rconManager)
+	triggerEngine := triggers.NewEngine(database, serverManager, packLoader, containerRuntime, rconManager, jobRunner, console.NewHistory(database))
+	logArchive := logarchive.NewArchiver(serverManager, containerRuntime, cfg.DataDir)
+	notificationService := notifications.NewService(database, eventBus, serverManager)
 
 	// SSH key and SFTP managers
 	sshKeyManager := sshkeys.NewManager(database)
@@ -86,8 +131,14 @@ func main() {
 		serverManager,
 		packLoader,
 		jobRunner,
-		dockerRuntime,
+		portAllocator,
+		containerRuntime,
 		rconManager,
+		playerTracker,
+		triggerEngine,
+		logArchive,
+		eventBus,
+		notificationService,
 		sshKeyManager,
 		sftpConfigManager,
 	)
@@ -96,6 +147,11 @@ func main() {
 	defer cancel()
 
 	go jobRunner.Start(ctx)
+	go playerTracker.Start(ctx)
+	go triggerEngine.Start(ctx)
+	go logArchive.Start(ctx)
+	go notificationService.Start(ctx)
+	go serverManager.MonitorHealth(ctx)
 
 	// Start SFTP server if enabled
 	var sftpServer *sftp.Server
@@ -113,6 +169,7 @@ func main() {
 		} else {
 			// Set the SFTP server reference for the API status endpoint
 			api.SetSFTPServer(sftpServer)
+			sftpServer.SetEvents(eventBus)
 
 			go func() {
 				slog.Info("starting SFTP server", "port", cfg.SFTPPort)
@@ -141,4 +198,16 @@ func main() {
 		sftpServer.Shutdown()
 	}
 	apiServer.Shutdown(context.Background())
+	rconManager.DisconnectAll()
+}
+
+func newContainerRuntime(cfg *config.Config) (runtime.Runtime, error) {
+	switch cfg.ContainerRuntime {
+	case "", "docker":
+		return docker.NewProvider(cfg.DockerHost)
+	case "podman":
+		return podman.NewProvider(cfg.PodmanHost)
+	default:
+		return nil, fmt.Errorf("unknown container runtime %q", cfg.ContainerRuntime)
+	}
 }
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+
+	"realmops/internal/config"
+	"realmops/internal/db"
+	"realmops/internal/ports"
+)
+
+// runRepair implements the "repair" subcommand, which finds and releases
+// port reservations leaked by deleted or half-created servers.
+func runRepair(cfg *config.Config, database *db.DB, args []string) error {
+	fs := flag.NewFlagSet("repair", flag.ContinueOnError)
+	dryRun := fs.Bool("dry-run", false, "only report leaked reservations")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	allocator := ports.NewAllocator(database, cfg.PortRangeStart, cfg.PortRangeEnd)
+
+	var leaks []ports.Leak
+	var err error
+	if *dryRun {
+		leaks, err = allocator.FindLeaks()
+	} else {
+		leaks, err = allocator.RepairLeaks()
+	}
+	if err != nil {
+		return err
+	}
+
+	if len(leaks) == 0 {
+		fmt.Println("no leaked port reservations found")
+		return nil
+	}
+
+	for _, l := range leaks {
+		fmt.Printf("port %d (server %s): %s\n", l.HostPort, l.ServerID, l.Reason)
+	}
+	if *dryRun {
+		fmt.Printf("found %d leaked port reservations, run without -dry-run to release them\n", len(leaks))
+	} else {
+		fmt.Printf("released %d leaked port reservations\n", len(leaks))
+	}
+	return nil
+}
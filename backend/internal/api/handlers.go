@@ -1,21 +1,37 @@
 package api
 
 import (
+	"context"
 	"crypto/rand"
 	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net"
 	"net/http"
 	"os"
 	"path/filepath"
+	"regexp"
+	"strconv"
 	"strings"
 	"time"
 
+	"realmops/internal/auth"
+	"realmops/internal/config"
+	"realmops/internal/console"
+	"realmops/internal/jobs"
+	"realmops/internal/logarchive"
 	"realmops/internal/models"
+	"realmops/internal/moderation"
+	"realmops/internal/notifications"
+	"realmops/internal/players"
+	"realmops/internal/ports"
+	"realmops/internal/rcon"
 	"realmops/internal/server"
 	"realmops/internal/sshkeys"
+	"realmops/internal/triggers"
+	"realmops/internal/ws"
 
 	"github.com/go-chi/chi/v5"
 )
@@ -36,6 +52,9 @@ func (s *Server) handleListServers(w http.ResponseWriter, r *http.Request) {
 		writeError(w, http.StatusInternalServerError, err.Error())
 		return
 	}
+	for _, srv := range servers {
+		srv.RCON = s.rconManager.Status(srv.ID)
+	}
 	writeJSON(w, http.StatusOK, servers)
 }
 
@@ -62,6 +81,7 @@ func (s *Server) handleGetServer(w http.ResponseWriter, r *http.Request) {
 		writeError(w, http.StatusNotFound, "server not found")
 		return
 	}
+	srv.RCON = s.rconManager.Status(srv.ID)
 	writeJSON(w, http.StatusOK, srv)
 }
 
@@ -71,6 +91,7 @@ func (s *Server) handleDeleteServer(w http.ResponseWriter, r *http.Request) {
 		writeError(w, http.StatusInternalServerError, err.Error())
 		return
 	}
+	s.rconManager.Disconnect(id)
 	w.WriteHeader(http.StatusNoContent)
 }
 
@@ -95,6 +116,414 @@ func (s *Server) handleUpdateServer(w http.ResponseWriter, r *http.Request) {
 	writeJSON(w, http.StatusOK, srv)
 }
 
+func (s *Server) handleUpdateServerPorts(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	var req server.UpdateServerPortsRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	if _, err := s.serverManager.GetServer(r.Context(), id); err != nil {
+		writeError(w, http.StatusNotFound, "server not found")
+		return
+	}
+
+	srv, err := s.serverManager.UpdateServerPorts(r.Context(), id, req)
+	if err != nil {
+		switch {
+		case errors.Is(err, server.ErrServerInstalling),
+			errors.Is(err, ports.ErrPortReserved),
+			errors.Is(err, ports.ErrPortInUse):
+			writeError(w, http.StatusConflict, err.Error())
+		default:
+			writeError(w, http.StatusBadRequest, err.Error())
+		}
+		return
+	}
+
+	writeJSON(w, http.StatusOK, srv)
+}
+
+type rconCommandRequest struct {
+	Command   string `json:"command"`
+	TimeoutMs int    `json:"timeoutMs"`
+}
+
+const maxRCONTimeout = 50 * time.Second
+
+func (s *Server) handleRCONCommand(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	var req rconCommandRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+	if strings.TrimSpace(req.Command) == "" {
+		writeError(w, http.StatusBadRequest, "command is required")
+		return
+	}
+
+	timeout := rcon.DefaultTimeout
+	if req.TimeoutMs < 0 {
+		writeError(w, http.StatusBadRequest, "timeoutMs must be positive")
+		return
+	}
+	if req.TimeoutMs > 0 {
+		timeout = time.Duration(req.TimeoutMs) * time.Millisecond
+	}
+	// Stay under the request timeout so the caller gets a real answer
+	if timeout > maxRCONTimeout {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("timeoutMs must be at most %d", maxRCONTimeout.Milliseconds()))
+		return
+	}
+
+	srv, err := s.serverManager.GetServer(r.Context(), id)
+	if err != nil {
+		writeError(w, http.StatusNotFound, "server not found")
+		return
+	}
+	if srv.State != models.ServerStateRunning {
+		writeError(w, http.StatusConflict, "server is not running")
+		return
+	}
+
+	manifest, err := s.packLoader.LoadFromDir(s.packLoader.GetPackPath(srv.PackID))
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "failed to load pack manifest")
+		return
+	}
+
+	s.runRCONCommand(w, r, srv, manifest, req.Command, timeout)
+}
+
+// runRCONCommand runs a command on the server's pooled RCON connection,
+// records it in the console history and writes the response.
+func (s *Server) runRCONCommand(w http.ResponseWriter, r *http.Request, srv *models.Server, manifest *models.Manifest, command string, timeout time.Duration) {
+	target, err := rcon.TargetFor(manifest, srv)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), timeout)
+	defer cancel()
+
+	start := time.Now()
+	response, err := s.rconManager.Run(ctx, srv.ID, target, command)
+	s.consoleHistory.RecordCommand(srv.ID, console.SourceAPI, auth.GetUser(r.Context()), command, response, err, time.Since(start))
+	if err != nil {
+		if errors.Is(err, context.DeadlineExceeded) {
+			writeError(w, http.StatusGatewayTimeout, "rcon command timed out")
+			return
+		}
+		writeError(w, http.StatusBadGateway, err.Error())
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]any{
+		"command":    command,
+		"response":   response,
+		"durationMs": time.Since(start).Milliseconds(),
+	})
+}
+
+func (s *Server) handleListConsoleCommands(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	srv, err := s.serverManager.GetServer(r.Context(), id)
+	if err != nil {
+		writeError(w, http.StatusNotFound, "server not found")
+		return
+	}
+
+	manifest, err := s.packLoader.LoadFromDir(s.packLoader.GetPackPath(srv.PackID))
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "failed to load pack manifest")
+		return
+	}
+
+	commands := manifest.Console.Commands
+	if commands == nil {
+		commands = []models.ConsoleCommand{}
+	}
+	writeJSON(w, http.StatusOK, commands)
+}
+
+type executeConsoleCommandRequest struct {
+	Params map[string]any `json:"params"`
+	// Confirm must be set to run a command marked dangerous
+	Confirm bool `json:"confirm"`
+}
+
+func (s *Server) handleExecuteConsoleCommand(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	name := chi.URLParam(r, "name")
+	var req executeConsoleCommandRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	srv, err := s.serverManager.GetServer(r.Context(), id)
+	if err != nil {
+		writeError(w, http.StatusNotFound, "server not found")
+		return
+	}
+
+	manifest, err := s.packLoader.LoadFromDir(s.packLoader.GetPackPath(srv.PackID))
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "failed to load pack manifest")
+		return
+	}
+
+	cmd, ok := console.FindCommand(manifest, name)
+	if !ok {
+		writeError(w, http.StatusNotFound, "command not found")
+		return
+	}
+
+	command, err := console.Render(cmd, req.Params)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if cmd.Dangerous && !req.Confirm {
+		writeJSON(w, http.StatusPreconditionRequired, map[string]any{
+			"error":   "command is marked dangerous and must be confirmed",
+			"command": command,
+		})
+		return
+	}
+
+	if srv.State != models.ServerStateRunning {
+		writeError(w, http.StatusConflict, "server is not running")
+		return
+	}
+
+	s.runRCONCommand(w, r, srv, manifest, command, rcon.DefaultTimeout)
+}
+
+func (s *Server) handleGetConsoleHistory(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	if _, err := s.serverManager.GetServer(r.Context(), id); err != nil {
+		writeError(w, http.StatusNotFound, "server not found")
+		return
+	}
+
+	q := console.Query{UserID: r.URL.Query().Get("user")}
+	if v := r.URL.Query().Get("limit"); v != "" {
+		limit, err := strconv.Atoi(v)
+		if err != nil || limit <= 0 {
+			writeError(w, http.StatusBadRequest, "invalid limit")
+			return
+		}
+		q.Limit = limit
+	}
+	if v := r.URL.Query().Get("before"); v != "" {
+		before, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "invalid before")
+			return
+		}
+		q.Before = before
+	}
+
+	entries, err := s.consoleHistory.List(id, q)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, entries)
+}
+
+func (s *Server) handleGetPlayers(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	if _, err := s.serverManager.GetServer(r.Context(), id); err != nil {
+		writeError(w, http.StatusNotFound, "server not found")
+		return
+	}
+
+	online := s.playerTracker.Online(id)
+	writeJSON(w, http.StatusOK, map[string]any{
+		"count":   len(online),
+		"players": online,
+	})
+}
+
+func (s *Server) handleGetPlayerHistory(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	if _, err := s.serverManager.GetServer(r.Context(), id); err != nil {
+		writeError(w, http.StatusNotFound, "server not found")
+		return
+	}
+
+	q := players.HistoryQuery{Player: r.URL.Query().Get("player")}
+	if v := r.URL.Query().Get("limit"); v != "" {
+		limit, err := strconv.Atoi(v)
+		if err != nil || limit <= 0 {
+			writeError(w, http.StatusBadRequest, "invalid limit")
+			return
+		}
+		q.Limit = limit
+	}
+	if v := r.URL.Query().Get("before"); v != "" {
+		before, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "invalid before")
+			return
+		}
+		q.Before = before
+	}
+
+	sessions, err := s.playerTracker.History(id, q)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, sessions)
+}
+
+func (s *Server) handleGetModeration(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	srv, err := s.serverManager.GetServer(r.Context(), id)
+	if err != nil {
+		writeError(w, http.StatusNotFound, "server not found")
+		return
+	}
+
+	manifest, err := s.packLoader.LoadFromDir(s.packLoader.GetPackPath(srv.PackID))
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "failed to load pack manifest")
+		return
+	}
+
+	bans, err := s.moderation.Bans(srv.PackID, srv.ID)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]any{
+		"actions": moderation.Supported(manifest),
+		"bans":    bans,
+	})
+}
+
+func (s *Server) handleModerate(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	var req moderation.Request
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	srv, err := s.serverManager.GetServer(r.Context(), id)
+	if err != nil {
+		writeError(w, http.StatusNotFound, "server not found")
+		return
+	}
+
+	results, err := s.moderation.Apply(r.Context(), srv, req, auth.GetUser(r.Context()))
+	if err != nil && results == nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]any{"results": results})
+}
+
+func (s *Server) handleListPackBans(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	bans, err := s.moderation.Bans(id, "")
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, bans)
+}
+
+func (s *Server) handleApplyPackBans(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	results, err := s.moderation.ApplyBans(r.Context(), id, auth.GetUser(r.Context()))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"results": results})
+}
+
+func (s *Server) handleListTriggers(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	list, err := s.triggerEngine.Triggers(r.Context(), id)
+	if err != nil {
+		writeError(w, http.StatusNotFound, "server not found")
+		return
+	}
+	writeJSON(w, http.StatusOK, list)
+}
+
+func (s *Server) handleCreateTrigger(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	var req triggers.TriggerRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	if _, err := s.serverManager.GetServer(r.Context(), id); err != nil {
+		writeError(w, http.StatusNotFound, "server not found")
+		return
+	}
+
+	trigger, err := s.triggerEngine.CreateTrigger(id, req)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusCreated, trigger)
+}
+
+func (s *Server) handleUpdateTrigger(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	triggerID := chi.URLParam(r, "triggerId")
+	var req triggers.TriggerRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	trigger, err := s.triggerEngine.UpdateTrigger(id, triggerID, req)
+	if errors.Is(err, triggers.ErrNotFound) {
+		writeError(w, http.StatusNotFound, err.Error())
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, trigger)
+}
+
+func (s *Server) handleDeleteTrigger(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	triggerID := chi.URLParam(r, "triggerId")
+	err := s.triggerEngine.DeleteTrigger(id, triggerID)
+	if errors.Is(err, triggers.ErrNotFound) {
+		writeError(w, http.StatusNotFound, err.Error())
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
 func (s *Server) handleStartServer(w http.ResponseWriter, r *http.Request) {
 	id := chi.URLParam(r, "id")
 	if err := s.serverManager.StartServer(r.Context(), id); err != nil {
@@ -135,7 +564,10 @@ func (s *Server) handleGetServerLogs(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	writeJSON(w, http.StatusOK, map[string]string{"containerId": srv.DockerContainerID})
+	writeJSON(w, http.StatusOK, map[string]any{
+		"containerId": srv.DockerContainerID,
+		"services":    srv.Services,
+	})
 }
 
 func (s *Server) handleStreamServerLogs(w http.ResponseWriter, r *http.Request) {
@@ -151,7 +583,85 @@ func (s *Server) handleStreamServerLogs(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	s.logStreamer.HandleWebSocket(w, r, srv.DockerContainerID)
+	sources := []ws.LogSource{{ContainerID: srv.DockerContainerID}}
+	for _, svc := range srv.Services {
+		sources = append(sources, ws.LogSource{Name: svc.Name, ContainerID: svc.ContainerID})
+	}
+
+	s.logStreamer.HandleWebSocket(w, r, sources)
+}
+
+func (s *Server) handleListLogSessions(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	if _, err := s.serverManager.GetServer(r.Context(), id); err != nil {
+		writeError(w, http.StatusNotFound, "server not found")
+		return
+	}
+
+	sessions, err := s.logArchive.Sessions(id)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, sessions)
+}
+
+func (s *Server) handleSearchServerLogs(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	if _, err := s.serverManager.GetServer(r.Context(), id); err != nil {
+		writeError(w, http.StatusNotFound, "server not found")
+		return
+	}
+
+	params := r.URL.Query()
+	q := logarchive.Query{Stream: params.Get("stream"), Cursor: params.Get("cursor")}
+	if v := params.Get("q"); v != "" {
+		pattern, err := regexp.Compile(v)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "invalid pattern: "+err.Error())
+			return
+		}
+		q.Pattern = pattern
+	}
+	if v := params.Get("from"); v != "" {
+		from, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "invalid from")
+			return
+		}
+		q.From = from
+	}
+	if v := params.Get("to"); v != "" {
+		to, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "invalid to")
+			return
+		}
+		q.To = to
+	}
+	if v := params.Get("limit"); v != "" {
+		limit, err := strconv.Atoi(v)
+		if err != nil || limit <= 0 {
+			writeError(w, http.StatusBadRequest, "invalid limit")
+			return
+		}
+		q.Limit = limit
+	}
+
+	result, err := s.logArchive.Search(id, q)
+	if errors.Is(err, logarchive.ErrInvalidCursor) {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, result)
+}
+
+func (s *Server) handleEventsWebSocket(w http.ResponseWriter, r *http.Request) {
+	s.eventsHandler.HandleWebSocket(w, r)
 }
 
 func (s *Server) handleConsoleWebSocket(w http.ResponseWriter, r *http.Request) {
@@ -170,6 +680,22 @@ func (s *Server) handleConsoleWebSocket(w http.ResponseWriter, r *http.Request)
 	s.consoleHandler.HandleWebSocket(w, r, srv)
 }
 
+func (s *Server) handleExecWebSocket(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	srv, err := s.serverManager.GetServer(r.Context(), id)
+	if err != nil {
+		writeError(w, http.StatusNotFound, "server not found")
+		return
+	}
+
+	if srv.State != "running" || srv.DockerContainerID == "" {
+		writeError(w, http.StatusBadRequest, "server must be running to exec into it")
+		return
+	}
+
+	s.execHandler.HandleWebSocket(w, r, srv)
+}
+
 func (s *Server) handleGetServerJobs(w http.ResponseWriter, r *http.Request) {
 	id := chi.URLParam(r, "id")
 	jobs, err := s.jobRunner.GetServerJobs(id, 20)
@@ -515,6 +1041,26 @@ func (s *Server) handleGetJob(w http.ResponseWriter, r *http.Request) {
 	writeJSON(w, http.StatusOK, job)
 }
 
+// handleCancelJob cancels a pending job, or stops a running one. Running
+// jobs still show as running until their handler has returned.
+func (s *Server) handleCancelJob(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	job, err := s.jobRunner.Cancel(id)
+	if errors.Is(err, jobs.ErrNotFound) {
+		writeError(w, http.StatusNotFound, "job not found")
+		return
+	}
+	if errors.Is(err, jobs.ErrNotCancelable) {
+		writeError(w, http.StatusConflict, err.Error())
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, job)
+}
+
 func (s *Server) handleListFiles(w http.ResponseWriter, r *http.Request) {
 	id := chi.URLParam(r, "id")
 	srv, err := s.serverManager.GetServer(r.Context(), id)
@@ -964,23 +1510,30 @@ func (s *Server) handleGetSFTPStatus(w http.ResponseWriter, r *http.Request) {
 type SystemConfigResponse struct {
 	// Running configuration (read-only)
 	Running struct {
-		SFTPEnabled    bool   `json:"sftpEnabled"`
-		SFTPPort       int    `json:"sftpPort"`
-		PortRangeStart int    `json:"portRangeStart"`
-		PortRangeEnd   int    `json:"portRangeEnd"`
-		DockerHost     string `json:"dockerHost"`
-		DataDir        string `json:"dataDir"`
-		DatabasePath   string `json:"databasePath"`
-		PacksDir       string `json:"packsDir"`
+		SFTPEnabled      bool   `json:"sftpEnabled"`
+		SFTPPort         int    `json:"sftpPort"`
+		PortRangeStart   int    `json:"portRangeStart"`
+		PortRangeEnd     int    `json:"portRangeEnd"`
+		PortExclude      string `json:"portExclude"`
+		PortProbe        bool   `json:"portProbe"`
+		DockerHost       string `json:"dockerHost"`
+		ContainerRuntime string `json:"containerRuntime"`
+		PodmanHost       string `json:"podmanHost"`
+		DataDir          string `json:"dataDir"`
+		DatabasePath     string `json:"databasePath"`
+		PacksDir         string `json:"packsDir"`
 	} `json:"running"`
 
 	// Saved configuration (can differ from running if restart needed)
 	Saved struct {
-		SFTPEnabled    *bool   `json:"sftpEnabled,omitempty"`
-		SFTPPort       *string `json:"sftpPort,omitempty"`
-		PortRangeStart *int    `json:"portRangeStart,omitempty"`
-		PortRangeEnd   *int    `json:"portRangeEnd,omitempty"`
-		DockerHost     *string `json:"dockerHost,omitempty"`
+		SFTPEnabled      *bool   `json:"sftpEnabled,omitempty"`
+		SFTPPort         *string `json:"sftpPort,omitempty"`
+		PortRangeStart   *int    `json:"portRangeStart,omitempty"`
+		PortRangeEnd     *int    `json:"portRangeEnd,omitempty"`
+		PortExclude      *string `json:"portExclude,omitempty"`
+		DockerHost       *string `json:"dockerHost,omitempty"`
+		ContainerRuntime *string `json:"containerRuntime,omitempty"`
+		PodmanHost       *string `json:"podmanHost,omitempty"`
 	} `json:"saved"`
 
 	// Status info
@@ -1004,9 +1557,11 @@ func (s *Server) handleGetSystemConfig(w http.ResponseWriter, r *http.Request) {
 	// Running config
 	response.Running.SFTPEnabled = s.cfg.SFTPEnabled
 	response.Running.SFTPPort = port
-	response.Running.PortRangeStart = s.cfg.PortRangeStart
-	response.Running.PortRangeEnd = s.cfg.PortRangeEnd
+	response.Running.PortRangeStart, response.Running.PortRangeEnd, response.Running.PortExclude = s.cfg.Ports()
+	response.Running.PortProbe = s.cfg.PortProbe
 	response.Running.DockerHost = s.cfg.DockerHost
+	response.Running.ContainerRuntime = s.cfg.ContainerRuntime
+	response.Running.PodmanHost = s.cfg.PodmanHost
 	response.Running.DataDir = s.cfg.DataDir
 	response.Running.DatabasePath = s.cfg.DatabasePath
 	response.Running.PacksDir = s.cfg.PacksDir
@@ -1017,17 +1572,23 @@ func (s *Server) handleGetSystemConfig(w http.ResponseWriter, r *http.Request) {
 	response.Saved.SFTPPort = saved.SFTPPort
 	response.Saved.PortRangeStart = saved.PortRangeStart
 	response.Saved.PortRangeEnd = saved.PortRangeEnd
+	response.Saved.PortExclude = saved.PortExclude
 	response.Saved.DockerHost = saved.DockerHost
+	response.Saved.ContainerRuntime = saved.ContainerRuntime
+	response.Saved.PodmanHost = saved.PodmanHost
 
 	writeJSON(w, http.StatusOK, response)
 }
 
 type UpdateConfigRequest struct {
-	SFTPEnabled    *bool   `json:"sftpEnabled,omitempty"`
-	SFTPPort       *int    `json:"sftpPort,omitempty"`
-	PortRangeStart *int    `json:"portRangeStart,omitempty"`
-	PortRangeEnd   *int    `json:"portRangeEnd,omitempty"`
-	DockerHost     *string `json:"dockerHost,omitempty"`
+	SFTPEnabled      *bool   `json:"sftpEnabled,omitempty"`
+	SFTPPort         *int    `json:"sftpPort,omitempty"`
+	PortRangeStart   *int    `json:"portRangeStart,omitempty"`
+	PortRangeEnd     *int    `json:"portRangeEnd,omitempty"`
+	PortExclude      *string `json:"portExclude,omitempty"`
+	DockerHost       *string `json:"dockerHost,omitempty"`
+	ContainerRuntime *string `json:"containerRuntime,omitempty"`
+	PodmanHost       *string `json:"podmanHost,omitempty"`
 }
 
 func (s *Server) handleUpdateSystemConfig(w http.ResponseWriter, r *http.Request) {
@@ -1053,13 +1614,29 @@ func (s *Server) handleUpdateSystemConfig(w http.ResponseWriter, r *http.Request
 	if req.PortRangeEnd != nil {
 		saved.PortRangeEnd = req.PortRangeEnd
 	}
+	if req.PortExclude != nil {
+		if _, err := config.ParsePortList(*req.PortExclude); err != nil {
+			writeError(w, http.StatusBadRequest, "invalid port exclusion list: "+err.Error())
+			return
+		}
+		saved.PortExclude = req.PortExclude
+	}
 	if req.DockerHost != nil {
 		saved.DockerHost = req.DockerHost
 	}
+	if req.ContainerRuntime != nil {
+		if *req.ContainerRuntime != "docker" && *req.ContainerRuntime != "podman" {
+			writeError(w, http.StatusBadRequest, "container runtime must be docker or podman")
+			return
+		}
+		saved.ContainerRuntime = req.ContainerRuntime
+	}
+	if req.PodmanHost != nil {
+		saved.PodmanHost = req.PodmanHost
+	}
 
 	// Validate port range
-	start := s.cfg.PortRangeStart
-	end := s.cfg.PortRangeEnd
+	start, end, exclude := s.cfg.Ports()
 	if saved.PortRangeStart != nil {
 		start = *saved.PortRangeStart
 	}
@@ -1075,16 +1652,69 @@ func (s *Server) handleUpdateSystemConfig(w http.ResponseWriter, r *http.Request
 		return
 	}
 
+	if saved.PortExclude != nil {
+		exclude = *saved.PortExclude
+	}
+	excluded, _ := config.ParsePortList(exclude)
+
 	// Save to file
 	if err := s.cfg.SaveConfig(saved); err != nil {
 		writeError(w, http.StatusInternalServerError, "failed to save config: "+err.Error())
 		return
 	}
 
+	// Port settings apply to the live allocator; servers left with ports
+	// outside a new range are moved with a port migration.
+	s.cfg.ApplyPorts(start, end, exclude)
+	s.portAllocator.SetRange(start, end)
+	s.portAllocator.SetExcluded(excluded)
+
 	// Return updated config
 	s.handleGetSystemConfig(w, r)
 }
 
+func (s *Server) handleGetPortMigration(w http.ResponseWriter, r *http.Request) {
+	servers, err := s.serverManager.OutOfRangeServers(r.Context())
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	rangeStart, rangeEnd, _ := s.cfg.Ports()
+	writeJSON(w, http.StatusOK, map[string]any{
+		"rangeStart": rangeStart,
+		"rangeEnd":   rangeEnd,
+		"servers":    servers,
+	})
+}
+
+func (s *Server) handleStartPortMigration(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		ServerIDs []string `json:"serverIds"`
+	}
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeError(w, http.StatusBadRequest, "invalid request body")
+			return
+		}
+	}
+
+	jobs, err := s.serverManager.MigratePorts(r.Context(), req.ServerIDs)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusAccepted, jobs)
+}
+
+func (s *Server) handleGetSystemPorts(w http.ResponseWriter, r *http.Request) {
+	status, err := s.portAllocator.Status()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, status)
+}
+
 // Docker provider interface for checking connection status
 var dockerProviderInstance DockerProviderInterface
 
@@ -1095,3 +1725,166 @@ type DockerProviderInterface interface {
 func SetDockerProvider(provider DockerProviderInterface) {
 	dockerProviderInstance = provider
 }
+
+func (s *Server) handleListNotificationChannels(w http.ResponseWriter, r *http.Request) {
+	channels, err := s.notifications.Channels()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, channels)
+}
+
+func (s *Server) handleCreateNotificationChannel(w http.ResponseWriter, r *http.Request) {
+	var req notifications.ChannelRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	channel, err := s.notifications.CreateChannel(req)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusCreated, channel)
+}
+
+func (s *Server) handleUpdateNotificationChannel(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	var req notifications.ChannelRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	channel, err := s.notifications.UpdateChannel(id, req)
+	if errors.Is(err, notifications.ErrNotFound) {
+		writeError(w, http.StatusNotFound, "channel not found")
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, channel)
+}
+
+func (s *Server) handleDeleteNotificationChannel(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	err := s.notifications.DeleteChannel(id)
+	if errors.Is(err, notifications.ErrNotFound) {
+		writeError(w, http.StatusNotFound, "channel not found")
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleTestNotificationChannel sends a test notification and returns its
+// delivery, failed or not.
+func (s *Server) handleTestNotificationChannel(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	delivery, err := s.notifications.Test(r.Context(), id)
+	if errors.Is(err, notifications.ErrNotFound) {
+		writeError(w, http.StatusNotFound, "channel not found")
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, delivery)
+}
+
+func (s *Server) handleListNotificationRules(w http.ResponseWriter, r *http.Request) {
+	rules, err := s.notifications.Rules(r.URL.Query().Get("channel"))
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, rules)
+}
+
+func (s *Server) handleCreateNotificationRule(w http.ResponseWriter, r *http.Request) {
+	var req notifications.RuleRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	rule, err := s.notifications.CreateRule(req)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusCreated, rule)
+}
+
+func (s *Server) handleUpdateNotificationRule(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	var req notifications.RuleRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	rule, err := s.notifications.UpdateRule(id, req)
+	if errors.Is(err, notifications.ErrNotFound) {
+		writeError(w, http.StatusNotFound, err.Error())
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, rule)
+}
+
+func (s *Server) handleDeleteNotificationRule(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	err := s.notifications.DeleteRule(id)
+	if errors.Is(err, notifications.ErrNotFound) {
+		writeError(w, http.StatusNotFound, "rule not found")
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) handleListNotificationDeliveries(w http.ResponseWriter, r *http.Request) {
+	q := notifications.DeliveryQuery{
+		ChannelID: r.URL.Query().Get("channel"),
+		ServerID:  r.URL.Query().Get("server"),
+		Status:    r.URL.Query().Get("status"),
+	}
+	if v := r.URL.Query().Get("limit"); v != "" {
+		limit, err := strconv.Atoi(v)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "invalid limit")
+			return
+		}
+		q.Limit = limit
+	}
+	if v := r.URL.Query().Get("before"); v != "" {
+		before, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "invalid before")
+			return
+		}
+		q.Before = before
+	}
+
+	deliveries, err := s.notifications.Deliveries(q)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, deliveries)
+}
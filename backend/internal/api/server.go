@@ -7,18 +7,27 @@ import (
 
 	"realmops/internal/auth"
 	"realmops/internal/config"
+	"realmops/internal/console"
 	"realmops/internal/db"
-	"realmops/internal/docker"
+	"realmops/internal/events"
 	"realmops/internal/jobs"
+	"realmops/internal/logarchive"
+	"realmops/internal/moderation"
+	"realmops/internal/notifications"
 	"realmops/internal/packs"
+	"realmops/internal/players"
+	"realmops/internal/ports"
 	"realmops/internal/rcon"
+	"realmops/internal/runtime"
 	"realmops/internal/server"
 	"realmops/internal/sshkeys"
+	"realmops/internal/triggers"
 	"realmops/internal/ws"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
 	"github.com/go-chi/cors"
+	"github.com/gorilla/websocket"
 )
 
 type Server struct {
@@ -27,8 +36,18 @@ type Server struct {
 	serverManager     *server.Manager
 	packLoader        *packs.Loader
 	jobRunner         *jobs.Runner
+	portAllocator     *ports.Allocator
+	rconManager       *rcon.Manager
+	consoleHistory    *console.History
+	playerTracker     *players.Tracker
+	moderation        *moderation.Service
+	triggerEngine     *triggers.Engine
+	logArchive        *logarchive.Archiver
+	notifications     *notifications.Service
 	logStreamer       *ws.LogStreamer
+	eventsHandler     *ws.EventsHandler
 	consoleHandler    *ws.ConsoleHandler
+	execHandler       *ws.ExecHandler
 	authMiddleware    *auth.Middleware
 	httpServer        *http.Server
 	sshKeyManager     *sshkeys.Manager
@@ -41,25 +60,58 @@ func NewServer(
 	serverManager *server.Manager,
 	packLoader *packs.Loader,
 	jobRunner *jobs.Runner,
-	dockerProvider *docker.Provider,
+	portAllocator *ports.Allocator,
+	containerRuntime runtime.Runtime,
 	rconManager *rcon.Manager,
+	playerTracker *players.Tracker,
+	triggerEngine *triggers.Engine,
+	logArchive *logarchive.Archiver,
+	eventBus *events.Bus,
+	notificationService *notifications.Service,
 	sshKeyManager *sshkeys.Manager,
 	sftpConfigManager *sshkeys.SFTPConfigManager,
 ) *Server {
+	consoleHistory := console.NewHistory(database)
+
 	return &Server{
 		cfg:               cfg,
 		db:                database,
 		serverManager:     serverManager,
 		packLoader:        packLoader,
 		jobRunner:         jobRunner,
-		logStreamer:       ws.NewLogStreamer(dockerProvider),
-		consoleHandler:    ws.NewConsoleHandler(packLoader, rconManager),
+		portAllocator:     portAllocator,
+		rconManager:       rconManager,
+		consoleHistory:    consoleHistory,
+		playerTracker:     playerTracker,
+		moderation:        moderation.NewService(database, serverManager, packLoader, rconManager, consoleHistory),
+		triggerEngine:     triggerEngine,
+		logArchive:        logArchive,
+		notifications:     notificationService,
+		logStreamer:       ws.NewLogStreamer(containerRuntime),
+		eventsHandler:     ws.NewEventsHandler(eventBus),
+		consoleHandler:    ws.NewConsoleHandler(packLoader, rconManager, containerRuntime, consoleHistory),
+		execHandler:       ws.NewExecHandler(packLoader, containerRuntime),
 		authMiddleware:    auth.NewMiddleware(cfg.AuthServiceURL),
 		sshKeyManager:     sshKeyManager,
 		sftpConfigManager: sftpConfigManager,
 	}
 }
 
+// timeout is middleware.Timeout for everything but WebSocket upgrades,
+// which stay open for as long as the client is connected.
+func timeout(d time.Duration) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		limited := middleware.Timeout(d)(next)
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if websocket.IsWebSocketUpgrade(r) {
+				next.ServeHTTP(w, r)
+				return
+			}
+			limited.ServeHTTP(w, r)
+		})
+	}
+}
+
 func (s *Server) Start() error {
 	r := chi.NewRouter()
 
@@ -67,7 +119,7 @@ func (s *Server) Start() error {
 	r.Use(middleware.Recoverer)
 	r.Use(middleware.RequestID)
 	r.Use(middleware.RealIP)
-	r.Use(middleware.Timeout(60 * time.Second))
+	r.Use(timeout(60 * time.Second))
 
 	r.Use(cors.Handler(cors.Options{
 		AllowedOrigins:   []string{"*"},
@@ -89,18 +141,37 @@ func (s *Server) Start() error {
 			// System info endpoint
 			r.Get("/system/info", s.handleSystemInfo)
 
+			// Server, job and SFTP events
+			r.Get("/events", s.handleEventsWebSocket)
+
 			r.Route("/servers", func(r chi.Router) {
 				r.Get("/", s.handleListServers)
 				r.Post("/", s.handleCreateServer)
 				r.Get("/{id}", s.handleGetServer)
 				r.Patch("/{id}", s.handleUpdateServer)
+				r.Put("/{id}/ports", s.handleUpdateServerPorts)
 				r.Delete("/{id}", s.handleDeleteServer)
 				r.Post("/{id}/start", s.handleStartServer)
 				r.Post("/{id}/stop", s.handleStopServer)
 				r.Post("/{id}/restart", s.handleRestartServer)
 				r.Get("/{id}/logs", s.handleGetServerLogs)
 				r.Get("/{id}/logs/stream", s.handleStreamServerLogs)
+				r.Get("/{id}/logs/sessions", s.handleListLogSessions)
+				r.Get("/{id}/logs/search", s.handleSearchServerLogs)
 				r.Get("/{id}/console", s.handleConsoleWebSocket)
+				r.Get("/{id}/console/history", s.handleGetConsoleHistory)
+				r.Get("/{id}/console/commands", s.handleListConsoleCommands)
+				r.Post("/{id}/console/commands/{name}", s.handleExecuteConsoleCommand)
+				r.Post("/{id}/rcon", s.handleRCONCommand)
+				r.Get("/{id}/players", s.handleGetPlayers)
+				r.Get("/{id}/players/history", s.handleGetPlayerHistory)
+				r.Get("/{id}/moderation", s.handleGetModeration)
+				r.Post("/{id}/moderation", s.handleModerate)
+				r.Get("/{id}/triggers", s.handleListTriggers)
+				r.Post("/{id}/triggers", s.handleCreateTrigger)
+				r.Put("/{id}/triggers/{triggerId}", s.handleUpdateTrigger)
+				r.Delete("/{id}/triggers/{triggerId}", s.handleDeleteTrigger)
+				r.Get("/{id}/exec", s.handleExecWebSocket)
 				r.Get("/{id}/jobs", s.handleGetServerJobs)
 				r.Get("/{id}/files", s.handleListFiles)
 				r.Get("/{id}/files/*", s.handleGetFile)
@@ -120,10 +191,27 @@ func (s *Server) Start() error {
 				r.Get("/{id}/files/*", s.handleListPackFiles)
 				r.Put("/{id}/files/*", s.handleUploadPackFile)
 				r.Delete("/{id}/files/*", s.handleDeletePackFile)
+				r.Get("/{id}/bans", s.handleListPackBans)
+				r.Post("/{id}/bans/apply", s.handleApplyPackBans)
+			})
+
+			// Notification channels, their rules and the delivery log
+			r.Route("/notifications", func(r chi.Router) {
+				r.Get("/channels", s.handleListNotificationChannels)
+				r.Post("/channels", s.handleCreateNotificationChannel)
+				r.Put("/channels/{id}", s.handleUpdateNotificationChannel)
+				r.Delete("/channels/{id}", s.handleDeleteNotificationChannel)
+				r.Post("/channels/{id}/test", s.handleTestNotificationChannel)
+				r.Get("/rules", s.handleListNotificationRules)
+				r.Post("/rules", s.handleCreateNotificationRule)
+				r.Put("/rules/{id}", s.handleUpdateNotificationRule)
+				r.Delete("/rules/{id}", s.handleDeleteNotificationRule)
+				r.Get("/deliveries", s.handleListNotificationDeliveries)
 			})
 
 			r.Route("/jobs", func(r chi.Router) {
 				r.Get("/{id}", s.handleGetJob)
+				r.Post("/{id}/cancel", s.handleCancelJob)
 			})
 
 			// SSH Keys management
@@ -144,6 +232,11 @@ func (s *Server) Start() error {
 			// System configuration
 			r.Get("/system/config", s.handleGetSystemConfig)
 			r.Patch("/system/config", s.handleUpdateSystemConfig)
+
+			// Host port reservations and conflicts
+			r.Get("/system/ports", s.handleGetSystemPorts)
+			r.Get("/system/ports/migrate", s.handleGetPortMigration)
+			r.Post("/system/ports/migrate", s.handleStartPortMigration)
 		})
 	})
 
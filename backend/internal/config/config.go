@@ -2,28 +2,44 @@ package config
 
 import (
 	"encoding/json"
+	"fmt"
 	"os"
 	"path/filepath"
 	"runtime"
 	"strconv"
+	"strings"
 	"sync"
 )
 
 type Config struct {
-	ListenAddr      string
-	DataDir         string
-	DatabasePath    string
-	PacksDir        string
-	DockerHost      string
-	PortRangeStart  int
-	PortRangeEnd    int
+	ListenAddr   string
+	DataDir      string
+	DatabasePath string
+	PacksDir     string
+	DockerHost   string
+	// ContainerRuntime selects the engine servers run on: docker or podman
+	ContainerRuntime string
+	// PodmanHost is the Podman API socket; empty picks the default location
+	PodmanHost     string
+	PortRangeStart int
+	PortRangeEnd   int
+	// PortExclude lists host ports the allocator never hands out,
+	// e.g. "25565,27000-27015"
+	PortExclude string
+	// PortProbe checks that a port is free on the host before allocating it
+	PortProbe       bool
 	SessionSecret   string
 	AuthServiceURL  string
 	SFTPEnabled     bool
 	SFTPPort        string
 	SFTPHostKeyPath string
+	// JobConcurrency is how many jobs run at once
+	JobConcurrency int
+	// JobTypeConcurrency caps job types further, e.g. "backup=1,install=2"
+	JobTypeConcurrency string
 
-	// mu protects savedConfig
+	// mu protects savedConfig and the port settings, which change at
+	// runtime through ApplyPorts
 	mu          sync.RWMutex
 	savedConfig *SavedConfig
 }
@@ -34,7 +50,11 @@ type SavedConfig struct {
 	SFTPPort       *string `json:"sftpPort,omitempty"`
 	PortRangeStart *int    `json:"portRangeStart,omitempty"`
 	PortRangeEnd   *int    `json:"portRangeEnd,omitempty"`
+	PortExclude    *string `json:"portExclude,omitempty"`
 	DockerHost     *string `json:"dockerHost,omitempty"`
+
+	ContainerRuntime *string `json:"containerRuntime,omitempty"`
+	PodmanHost       *string `json:"podmanHost,omitempty"`
 }
 
 func Load() (*Config, error) {
@@ -42,20 +62,26 @@ func Load() (*Config, error) {
 	defaultPacksDir := getDefaultPacksDir(defaultDataDir)
 
 	cfg := &Config{
-		ListenAddr:     getEnv("GSM_LISTEN_ADDR", ":8080"),
-		DataDir:        getEnv("GSM_DATA_DIR", defaultDataDir),
-		PacksDir:       getEnv("GSM_PACKS_DIR", defaultPacksDir),
-		DockerHost:     getEnv("GSM_DOCKER_HOST", defaultDockerHost),
-		PortRangeStart: getEnvInt("GSM_PORT_RANGE_START", 20000),
-		PortRangeEnd:   getEnvInt("GSM_PORT_RANGE_END", 40000),
-		SessionSecret:  getEnv("GSM_SESSION_SECRET", "change-me-in-production"),
-		AuthServiceURL: getEnv("GSM_AUTH_SERVICE_URL", "http://localhost:3001"),
-		SFTPEnabled:    getEnvBool("GSM_SFTP_ENABLED", true),
-		SFTPPort:       getEnv("GSM_SFTP_PORT", ":2022"),
+		ListenAddr:       getEnv("GSM_LISTEN_ADDR", ":8080"),
+		DataDir:          getEnv("GSM_DATA_DIR", defaultDataDir),
+		PacksDir:         getEnv("GSM_PACKS_DIR", defaultPacksDir),
+		DockerHost:       getEnv("GSM_DOCKER_HOST", defaultDockerHost),
+		ContainerRuntime: getEnv("GSM_CONTAINER_RUNTIME", "docker"),
+		PodmanHost:       getEnv("GSM_PODMAN_HOST", ""),
+		PortRangeStart:   getEnvInt("GSM_PORT_RANGE_START", 20000),
+		PortRangeEnd:     getEnvInt("GSM_PORT_RANGE_END", 40000),
+		PortExclude:      getEnv("GSM_PORT_EXCLUDE", ""),
+		PortProbe:        getEnvBool("GSM_PORT_PROBE", true),
+		SessionSecret:    getEnv("GSM_SESSION_SECRET", "change-me-in-production"),
+		AuthServiceURL:   getEnv("GSM_AUTH_SERVICE_URL", "http://localhost:3001"),
+		SFTPEnabled:      getEnvBool("GSM_SFTP_ENABLED", true),
+		SFTPPort:         getEnv("GSM_SFTP_PORT", ":2022"),
 	}
 
 	cfg.DatabasePath = filepath.Join(cfg.DataDir, "db", "gsm.db")
 	cfg.SFTPHostKeyPath = getEnv("GSM_SFTP_HOST_KEY_PATH", filepath.Join(cfg.DataDir, "sftp_host_key"))
+	cfg.JobConcurrency = getEnvInt("GSM_JOB_CONCURRENCY", 4)
+	cfg.JobTypeConcurrency = getEnv("GSM_JOB_TYPE_CONCURRENCY", "")
 
 	return cfg, nil
 }
@@ -111,6 +137,63 @@ func getEnvBool(key string, defaultValue bool) bool {
 	return defaultValue
 }
 
+// ParsePortList parses a comma separated list of ports and port ranges such
+// as "25565,27000-27015".
+func ParsePortList(value string) ([]int, error) {
+	var ports []int
+	for _, part := range strings.Split(value, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+
+		first, last, isRange := strings.Cut(part, "-")
+		start, err := strconv.Atoi(strings.TrimSpace(first))
+		if err != nil {
+			return nil, fmt.Errorf("invalid port %q", part)
+		}
+		end := start
+		if isRange {
+			end, err = strconv.Atoi(strings.TrimSpace(last))
+			if err != nil {
+				return nil, fmt.Errorf("invalid port range %q", part)
+			}
+		}
+		if start < 1 || end > 65535 || start > end {
+			return nil, fmt.Errorf("invalid port range %q", part)
+		}
+
+		for port := start; port <= end; port++ {
+			ports = append(ports, port)
+		}
+	}
+	return ports, nil
+}
+
+// ParseLimits parses a comma separated list of limits such as
+// "backup=1,install=2".
+func ParseLimits(value string) (map[string]int, error) {
+	limits := make(map[string]int)
+	for _, part := range strings.Split(value, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+
+		name, limit, ok := strings.Cut(part, "=")
+		name = strings.TrimSpace(name)
+		if !ok || name == "" {
+			return nil, fmt.Errorf("invalid limit %q", part)
+		}
+		n, err := strconv.Atoi(strings.TrimSpace(limit))
+		if err != nil || n < 1 {
+			return nil, fmt.Errorf("invalid limit %q", part)
+		}
+		limits[name] = n
+	}
+	return limits, nil
+}
+
 // GetConfigFilePath returns the path to the config.json file
 func (c *Config) GetConfigFilePath() string {
 	return filepath.Join(c.DataDir, "config.json")
@@ -151,9 +234,18 @@ func (c *Config) LoadSavedConfig() error {
 	if saved.PortRangeEnd != nil {
 		c.PortRangeEnd = *saved.PortRangeEnd
 	}
+	if saved.PortExclude != nil {
+		c.PortExclude = *saved.PortExclude
+	}
 	if saved.DockerHost != nil {
 		c.DockerHost = *saved.DockerHost
 	}
+	if saved.ContainerRuntime != nil {
+		c.ContainerRuntime = *saved.ContainerRuntime
+	}
+	if saved.PodmanHost != nil {
+		c.PodmanHost = *saved.PodmanHost
+	}
 
 	return nil
 }
@@ -194,6 +286,25 @@ func (c *Config) GetSavedConfig() *SavedConfig {
 	return c.savedConfig
 }
 
+// ApplyPorts updates the running port settings, which unlike the other
+// settings take effect without a restart.
+func (c *Config) ApplyPorts(rangeStart, rangeEnd int, exclude string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.PortRangeStart = rangeStart
+	c.PortRangeEnd = rangeEnd
+	c.PortExclude = exclude
+}
+
+// Ports returns the running port range and exclusions.
+func (c *Config) Ports() (rangeStart, rangeEnd int, exclude string) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	return c.PortRangeStart, c.PortRangeEnd, c.PortExclude
+}
+
 // HasPendingChanges checks if saved config differs from running config
 func (c *Config) HasPendingChanges() bool {
 	c.mu.RLock()
@@ -216,9 +327,18 @@ func (c *Config) HasPendingChanges() bool {
 	if c.savedConfig.PortRangeEnd != nil && *c.savedConfig.PortRangeEnd != c.PortRangeEnd {
 		return true
 	}
+	if c.savedConfig.PortExclude != nil && *c.savedConfig.PortExclude != c.PortExclude {
+		return true
+	}
 	if c.savedConfig.DockerHost != nil && *c.savedConfig.DockerHost != c.DockerHost {
 		return true
 	}
+	if c.savedConfig.ContainerRuntime != nil && *c.savedConfig.ContainerRuntime != c.ContainerRuntime {
+		return true
+	}
+	if c.savedConfig.PodmanHost != nil && *c.savedConfig.PodmanHost != c.PodmanHost {
+		return true
+	}
 
 	return false
 }
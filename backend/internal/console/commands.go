@@ -0,0 +1,142 @@
+package console
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"strings"
+	"text/template"
+	"unicode"
+
+	"realmops/internal/models"
+)
+
+// ParamTypes are the types a command param may have.
+var ParamTypes = map[string]bool{
+	"string":  true,
+	"number":  true,
+	"boolean": true,
+	"select":  true,
+	"player":  true,
+}
+
+// FindCommand looks a catalog command up by name.
+func FindCommand(manifest *models.Manifest, name string) (*models.ConsoleCommand, bool) {
+	for i := range manifest.Console.Commands {
+		if manifest.Console.Commands[i].Name == name {
+			return &manifest.Console.Commands[i], true
+		}
+	}
+	return nil, false
+}
+
+// Render validates args against the command's params and renders its
+// template. Missing optional params take their default, or render empty.
+func Render(cmd *models.ConsoleCommand, args map[string]any) (string, error) {
+	values := make(map[string]any, len(cmd.Params))
+
+	for _, p := range cmd.Params {
+		val, ok := args[p.Name]
+		if !ok || val == nil || val == "" {
+			if p.Required {
+				return "", fmt.Errorf("missing required param: %s", p.Name)
+			}
+			if p.Default != nil {
+				values[p.Name] = p.Default
+			} else {
+				values[p.Name] = ""
+			}
+			continue
+		}
+
+		v, err := CheckParam(p, val)
+		if err != nil {
+			return "", err
+		}
+		values[p.Name] = v
+	}
+
+	for name := range args {
+		if _, ok := values[name]; !ok {
+			return "", fmt.Errorf("unknown param: %s", name)
+		}
+	}
+
+	t, err := template.New(cmd.Name).Option("missingkey=zero").Parse(cmd.Template)
+	if err != nil {
+		return "", fmt.Errorf("invalid command template: %w", err)
+	}
+
+	var buf bytes.Buffer
+	if err := t.Execute(&buf, values); err != nil {
+		return "", fmt.Errorf("failed to render command: %w", err)
+	}
+	return strings.TrimSpace(buf.String()), nil
+}
+
+// CheckParam validates a value for a param and converts it to the param's
+// type. String params must not contain control characters or double
+// quotes, and player params must also be a single word, so neither can
+// change the command's shape.
+func CheckParam(p models.CommandParam, val any) (any, error) {
+	switch p.Type {
+	case "number":
+		n, ok := val.(float64)
+		if !ok {
+			if i, isInt := val.(int); isInt {
+				n, ok = float64(i), true
+			}
+		}
+		if !ok {
+			return nil, fmt.Errorf("param %s must be a number", p.Name)
+		}
+		if p.Min != nil && n < float64(*p.Min) {
+			return nil, fmt.Errorf("param %s must be at least %d", p.Name, *p.Min)
+		}
+		if p.Max != nil && n > float64(*p.Max) {
+			return nil, fmt.Errorf("param %s must be at most %d", p.Name, *p.Max)
+		}
+		// Keep integers free of a trailing ".0"
+		if n == math.Trunc(n) {
+			return int64(n), nil
+		}
+		return n, nil
+
+	case "boolean":
+		b, ok := val.(bool)
+		if !ok {
+			return nil, fmt.Errorf("param %s must be a boolean", p.Name)
+		}
+		return b, nil
+
+	case "select":
+		s, ok := val.(string)
+		if !ok {
+			return nil, fmt.Errorf("param %s must be a string", p.Name)
+		}
+		for _, opt := range p.Options {
+			if opt == s {
+				return s, nil
+			}
+		}
+		return nil, fmt.Errorf("param %s has invalid value", p.Name)
+
+	default:
+		s, ok := val.(string)
+		if !ok {
+			return nil, fmt.Errorf("param %s must be a string", p.Name)
+		}
+		// A line break would let a param smuggle in a second command
+		if strings.IndexFunc(s, unicode.IsControl) >= 0 {
+			return nil, fmt.Errorf("param %s must not contain control characters", p.Name)
+		}
+		// A quote would end a quoted argument and start another one
+		if strings.Contains(s, `"`) {
+			return nil, fmt.Errorf("param %s must not contain double quotes", p.Name)
+		}
+		if p.Type == "player" && strings.ContainsAny(s, " \t") {
+			return nil, fmt.Errorf("param %s must be a single player name or ID", p.Name)
+		}
+		return s, nil
+	}
+}
@@ -0,0 +1,61 @@
+package console
+
+import (
+	"testing"
+
+	"realmops/internal/models"
+)
+
+func TestRender(t *testing.T) {
+	maxAmount := 64
+	kick := &models.ConsoleCommand{
+		Name:     "kick",
+		Template: `kick {{.player}} "{{.reason}}"`,
+		Params: []models.CommandParam{
+			{Name: "player", Type: "player", Required: true},
+			{Name: "reason", Type: "string", Default: "Kicked"},
+		},
+	}
+	give := &models.ConsoleCommand{
+		Name:     "give",
+		Template: "give {{.player}} {{.item}} {{.amount}}",
+		Params: []models.CommandParam{
+			{Name: "player", Type: "player", Required: true},
+			{Name: "item", Type: "select", Options: []string{"stone", "dirt"}},
+			{Name: "amount", Type: "number", Max: &maxAmount},
+		},
+	}
+
+	tests := []struct {
+		name    string
+		cmd     *models.ConsoleCommand
+		args    map[string]any
+		want    string
+		wantErr bool
+	}{
+		{name: "default", cmd: kick, args: map[string]any{"player": "Steve"}, want: `kick Steve "Kicked"`},
+		{name: "reason with spaces", cmd: kick, args: map[string]any{"player": "Steve", "reason": "be nice"}, want: `kick Steve "be nice"`},
+		{name: "missing player", cmd: kick, args: map[string]any{}, wantErr: true},
+		{name: "second player smuggled in", cmd: kick, args: map[string]any{"player": "Steve op Alex"}, wantErr: true},
+		{name: "quoted player", cmd: kick, args: map[string]any{"player": `x" "y`}, wantErr: true},
+		{name: "quote in player", cmd: kick, args: map[string]any{"player": `Steve"`}, wantErr: true},
+		{name: "extra argument through a quote", cmd: kick, args: map[string]any{"player": "Steve", "reason": `x" "y`}, wantErr: true},
+		{name: "line break", cmd: kick, args: map[string]any{"player": "Steve", "reason": "x\nop Alex"}, wantErr: true},
+		{name: "unknown param", cmd: kick, args: map[string]any{"player": "Steve", "force": true}, wantErr: true},
+		{name: "integer from JSON", cmd: give, args: map[string]any{"player": "Steve", "item": "stone", "amount": float64(3)}, want: "give Steve stone 3"},
+		{name: "above max", cmd: give, args: map[string]any{"player": "Steve", "item": "stone", "amount": float64(65)}, wantErr: true},
+		{name: "invalid option", cmd: give, args: map[string]any{"player": "Steve", "item": "tnt"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Render(tt.cmd, tt.args)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
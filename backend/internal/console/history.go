@@ -0,0 +1,185 @@
+package console
+
+import (
+	"database/sql"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"realmops/internal/auth"
+	"realmops/internal/db"
+)
+
+// MaxResponseSummary is how much of a command's response is kept.
+const MaxResponseSummary = 2000
+
+const (
+	SourceConsole    = "console"
+	SourceAPI        = "api"
+	SourceModeration = "moderation"
+	SourceTrigger    = "trigger"
+)
+
+// Entry is one command sent to a server's console.
+type Entry struct {
+	ID         int64     `json:"id"`
+	ServerID   string    `json:"serverId"`
+	UserID     string    `json:"userId,omitempty"`
+	UserName   string    `json:"userName,omitempty"`
+	Source     string    `json:"source"`
+	Command    string    `json:"command"`
+	Response   string    `json:"response,omitempty"`
+	Error      string    `json:"error,omitempty"`
+	DurationMs int64     `json:"durationMs"`
+	CreatedAt  time.Time `json:"createdAt"`
+}
+
+// Query filters History.List. Results are newest first; Before pages
+// backwards by entry ID.
+type Query struct {
+	Limit  int
+	Before int64
+	UserID string
+}
+
+// History persists console commands so they can be audited and replayed.
+type History struct {
+	db *db.DB
+}
+
+func NewHistory(database *db.DB) *History {
+	return &History{db: database}
+}
+
+// Record stores a command, trimming its response to MaxResponseSummary.
+func (h *History) Record(e *Entry) error {
+	if e.CreatedAt.IsZero() {
+		e.CreatedAt = time.Now()
+	}
+	e.Response = Summarize(e.Response)
+
+	result, err := h.db.Exec(`
+		INSERT INTO console_commands (server_id, user_id, user_name, source, command, response, error, duration_ms, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`, e.ServerID, e.UserID, e.UserName, e.Source, e.Command, e.Response, e.Error, e.DurationMs, e.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to record console command: %w", err)
+	}
+
+	e.ID, _ = result.LastInsertId()
+	return nil
+}
+
+// RecordCommand records a command a user ran from source. user may be nil.
+// A failure to record is logged, not returned, since the command has run
+// either way. Consoles whose output is not tied to the command, like stdin
+// consoles, pass an empty response.
+func (h *History) RecordCommand(serverID, source string, user *auth.User, command, response string, cmdErr error, took time.Duration) {
+	entry := &Entry{
+		ServerID:   serverID,
+		Source:     source,
+		Command:    command,
+		Response:   response,
+		DurationMs: took.Milliseconds(),
+	}
+	if user != nil {
+		entry.UserID = user.ID
+		entry.UserName = user.Name
+	}
+	h.record(entry, cmdErr)
+}
+
+// RecordActorCommand is RecordCommand for commands run on behalf of
+// something other than a user, like a trigger, named by actor.
+func (h *History) RecordActorCommand(serverID, source, actor, command, response string, cmdErr error, took time.Duration) {
+	h.record(&Entry{
+		ServerID:   serverID,
+		UserName:   actor,
+		Source:     source,
+		Command:    command,
+		Response:   response,
+		DurationMs: took.Milliseconds(),
+	}, cmdErr)
+}
+
+func (h *History) record(entry *Entry, cmdErr error) {
+	if cmdErr != nil {
+		entry.Error = cmdErr.Error()
+	}
+	if err := h.Record(entry); err != nil {
+		slog.Warn("failed to record console command", "serverId", entry.ServerID, "error", err)
+	}
+}
+
+// List returns a server's commands, newest first.
+func (h *History) List(serverID string, q Query) ([]*Entry, error) {
+	if q.Limit <= 0 || q.Limit > 500 {
+		q.Limit = 100
+	}
+
+	query := `
+		SELECT id, server_id, user_id, user_name, source, command, response, error, duration_ms, created_at
+		FROM console_commands
+		WHERE server_id = ?`
+	args := []any{serverID}
+
+	if q.Before > 0 {
+		query += ` AND id < ?`
+		args = append(args, q.Before)
+	}
+	if q.UserID != "" {
+		query += ` AND user_id = ?`
+		args = append(args, q.UserID)
+	}
+	query += ` ORDER BY id DESC LIMIT ?`
+	args = append(args, q.Limit)
+
+	rows, err := h.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	entries := []*Entry{}
+	for rows.Next() {
+		var e Entry
+		var userID, userName, response, errMsg sql.NullString
+		if err := rows.Scan(&e.ID, &e.ServerID, &userID, &userName, &e.Source, &e.Command, &response, &errMsg, &e.DurationMs, &e.CreatedAt); err != nil {
+			return nil, err
+		}
+		e.UserID = userID.String
+		e.UserName = userName.String
+		e.Response = response.String
+		e.Error = errMsg.String
+		entries = append(entries, &e)
+	}
+	return entries, rows.Err()
+}
+
+// Scrollback returns a server's last n commands, oldest first, for a new
+// console session to show.
+func (h *History) Scrollback(serverID string, n int) ([]*Entry, error) {
+	entries, err := h.List(serverID, Query{Limit: n})
+	if err != nil {
+		return nil, err
+	}
+	for i, j := 0, len(entries)-1; i < j; i, j = i+1, j-1 {
+		entries[i], entries[j] = entries[j], entries[i]
+	}
+	return entries, nil
+}
+
+// Summarize trims a response to MaxResponseSummary bytes without splitting
+// a UTF-8 character.
+func Summarize(response string) string {
+	response = strings.TrimSpace(response)
+	if len(response) <= MaxResponseSummary {
+		return response
+	}
+	cut := MaxResponseSummary
+	for cut > 0 && response[cut]&0xC0 == 0x80 {
+		cut--
+	}
+	return response[:cut] + "…"
+}
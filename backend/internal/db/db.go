@@ -2,6 +2,7 @@ package db
 
 import (
 	"database/sql"
+	"fmt"
 	"os"
 	"path/filepath"
 
@@ -156,6 +157,112 @@ func (db *DB) Migrate() error {
 
 		`CREATE INDEX IF NOT EXISTS idx_ssh_keys_fingerprint ON ssh_keys(fingerprint)`,
 		`CREATE INDEX IF NOT EXISTS idx_server_sftp_config_ssh_key ON server_sftp_config(ssh_key_id)`,
+
+		// Sidecar containers declared by a pack's services
+		`CREATE TABLE IF NOT EXISTS server_containers (
+			server_id TEXT NOT NULL,
+			service TEXT NOT NULL,
+			container_id TEXT NOT NULL,
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			PRIMARY KEY (server_id, service),
+			FOREIGN KEY (server_id) REFERENCES servers(id) ON DELETE CASCADE
+		)`,
+
+		// Audit log of console and RCON commands. Kept when a server is
+		// deleted so that its history can still be reviewed.
+		`CREATE TABLE IF NOT EXISTS console_commands (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			server_id TEXT NOT NULL,
+			user_id TEXT,
+			user_name TEXT,
+			source TEXT NOT NULL,
+			command TEXT NOT NULL,
+			response TEXT,
+			error TEXT,
+			duration_ms INTEGER NOT NULL DEFAULT 0,
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+		)`,
+		`CREATE INDEX IF NOT EXISTS idx_console_commands_server_id ON console_commands(server_id, id)`,
+
+		// Player visits recorded by the player tracker
+		`CREATE TABLE IF NOT EXISTS player_sessions (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			server_id TEXT NOT NULL,
+			player_name TEXT NOT NULL,
+			player_id TEXT,
+			joined_at DATETIME NOT NULL,
+			left_at DATETIME
+		)`,
+		`CREATE INDEX IF NOT EXISTS idx_player_sessions_server_id ON player_sessions(server_id, id)`,
+
+		// Ban list kept by moderation. An empty server_id bans the player
+		// from every server of the pack.
+		`CREATE TABLE IF NOT EXISTS bans (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			pack_id TEXT NOT NULL,
+			server_id TEXT NOT NULL DEFAULT '',
+			player TEXT NOT NULL,
+			reason TEXT,
+			created_by TEXT,
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+		)`,
+		`CREATE INDEX IF NOT EXISTS idx_bans_pack_id ON bans(pack_id)`,
+
+		// User-defined log triggers; pack triggers live in the manifest
+		`CREATE TABLE IF NOT EXISTS triggers (
+			id TEXT PRIMARY KEY,
+			server_id TEXT NOT NULL,
+			name TEXT NOT NULL,
+			pattern TEXT NOT NULL,
+			action TEXT NOT NULL,
+			cooldown INTEGER NOT NULL DEFAULT 0,
+			command TEXT,
+			url TEXT,
+			enabled INTEGER NOT NULL DEFAULT 1,
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			FOREIGN KEY (server_id) REFERENCES servers(id) ON DELETE CASCADE
+		)`,
+		`CREATE INDEX IF NOT EXISTS idx_triggers_server_id ON triggers(server_id)`,
+
+		// Notification channels and the rules subscribing them to events.
+		// An empty server_id matches every server.
+		`CREATE TABLE IF NOT EXISTS notification_channels (
+			id TEXT PRIMARY KEY,
+			name TEXT NOT NULL,
+			type TEXT NOT NULL,
+			url TEXT NOT NULL,
+			secret TEXT,
+			enabled INTEGER NOT NULL DEFAULT 1,
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+		)`,
+		`CREATE TABLE IF NOT EXISTS notification_rules (
+			id TEXT PRIMARY KEY,
+			channel_id TEXT NOT NULL,
+			server_id TEXT NOT NULL DEFAULT '',
+			events_json TEXT NOT NULL,
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			FOREIGN KEY (channel_id) REFERENCES notification_channels(id) ON DELETE CASCADE
+		)`,
+
+		// Delivery log of notifications, also used to resume retries
+		`CREATE TABLE IF NOT EXISTS notification_deliveries (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			channel_id TEXT NOT NULL,
+			event_id INTEGER NOT NULL DEFAULT 0,
+			event_type TEXT NOT NULL,
+			server_id TEXT,
+			status TEXT NOT NULL,
+			attempts INTEGER NOT NULL DEFAULT 0,
+			response_code INTEGER NOT NULL DEFAULT 0,
+			error TEXT,
+			payload TEXT NOT NULL,
+			next_attempt_at DATETIME,
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			delivered_at DATETIME
+		)`,
+		`CREATE INDEX IF NOT EXISTS idx_notification_deliveries_channel_id ON notification_deliveries(channel_id, id)`,
+		`CREATE INDEX IF NOT EXISTS idx_notification_deliveries_status ON notification_deliveries(status)`,
 	}
 
 	for _, migration := range migrations {
@@ -164,5 +271,58 @@ func (db *DB) Migrate() error {
 		}
 	}
 
+	// Columns added to tables after their initial release. SQLite has no
+	// ADD COLUMN IF NOT EXISTS, so each one is checked against table_info.
+	columns := []struct {
+		table      string
+		column     string
+		definition string
+	}{
+		{"servers", "networks_json", "TEXT NOT NULL DEFAULT '[]'"},
+		{"server_ports", "service", "TEXT NOT NULL DEFAULT ''"},
+		{"jobs", "attempts", "INTEGER NOT NULL DEFAULT 0"},
+		{"jobs", "next_run_at", "DATETIME"},
+		{"jobs", "runner_id", "TEXT"},
+		{"jobs", "heartbeat_at", "DATETIME"},
+	}
+
+	for _, c := range columns {
+		if err := db.addColumnIfMissing(c.table, c.column, c.definition); err != nil {
+			return err
+		}
+	}
+
 	return nil
 }
+
+func (db *DB) addColumnIfMissing(table, column, definition string) error {
+	rows, err := db.Query(fmt.Sprintf("PRAGMA table_info(%s)", table))
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			cid        int
+			name       string
+			colType    string
+			notNull    int
+			defaultVal sql.NullString
+			primaryKey int
+		)
+		if err := rows.Scan(&cid, &name, &colType, &notNull, &defaultVal, &primaryKey); err != nil {
+			return err
+		}
+		if name == column {
+			return nil
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	rows.Close()
+
+	_, err = db.Exec(fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", table, column, definition))
+	return err
+}
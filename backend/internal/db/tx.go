@@ -0,0 +1,26 @@
+package db
+
+import "database/sql"
+
+// Querier is satisfied by both *DB and *sql.Tx, so helpers can run on their
+// own or as part of a larger transaction.
+type Querier interface {
+	Exec(query string, args ...any) (sql.Result, error)
+	Query(query string, args ...any) (*sql.Rows, error)
+	QueryRow(query string, args ...any) *sql.Row
+}
+
+// WithTx runs fn in a transaction that is committed if fn returns nil and
+// rolled back otherwise.
+func (db *DB) WithTx(fn func(tx *sql.Tx) error) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := fn(tx); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
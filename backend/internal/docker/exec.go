@@ -0,0 +1,124 @@
+package docker
+
+import (
+	"context"
+	"fmt"
+	"io"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/pkg/stdcopy"
+	"realmops/internal/runtime"
+)
+
+// execSession wraps the hijacked connection of a Docker exec.
+type execSession struct {
+	client *Provider
+	execID string
+	resp   types.HijackedResponse
+}
+
+func (p *Provider) Exec(ctx context.Context, containerID string, opts runtime.ExecOptions) (runtime.ExecSession, error) {
+	config := types.ExecConfig{
+		User:         opts.User,
+		Tty:          opts.Tty,
+		AttachStdin:  true,
+		AttachStdout: true,
+		AttachStderr: true,
+		Env:          opts.Env,
+		WorkingDir:   opts.WorkingDir,
+		Cmd:          opts.Cmd,
+	}
+	if opts.Tty && opts.Cols > 0 && opts.Rows > 0 {
+		config.ConsoleSize = &[2]uint{opts.Rows, opts.Cols}
+	}
+
+	created, err := p.client.ContainerExecCreate(ctx, containerID, config)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create exec: %w", err)
+	}
+
+	resp, err := p.client.ContainerExecAttach(ctx, created.ID, types.ExecStartCheck{
+		Tty:         opts.Tty,
+		ConsoleSize: config.ConsoleSize,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to attach exec: %w", err)
+	}
+
+	return &execSession{client: p, execID: created.ID, resp: resp}, nil
+}
+
+func (e *execSession) Read(b []byte) (int, error) {
+	return e.resp.Reader.Read(b)
+}
+
+func (e *execSession) Write(b []byte) (int, error) {
+	return e.resp.Conn.Write(b)
+}
+
+func (e *execSession) Close() error {
+	e.resp.Close()
+	return nil
+}
+
+func (e *execSession) Resize(ctx context.Context, cols, rows uint) error {
+	return e.client.client.ContainerExecResize(ctx, e.execID, types.ResizeOptions{
+		Height: rows,
+		Width:  cols,
+	})
+}
+
+func (e *execSession) ExitCode(ctx context.Context) (int, error) {
+	info, err := e.client.client.ContainerExecInspect(ctx, e.execID)
+	if err != nil {
+		return 0, err
+	}
+	if info.Running {
+		return 0, fmt.Errorf("process is still running")
+	}
+	return info.ExitCode, nil
+}
+
+// attachSession is an attached container stream. Output of containers
+// without a TTY is demultiplexed so readers always see plain text.
+type attachSession struct {
+	io.Reader
+	resp types.HijackedResponse
+}
+
+func (p *Provider) Attach(ctx context.Context, containerID string) (io.ReadWriteCloser, error) {
+	info, err := p.client.ContainerInspect(ctx, containerID)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := p.client.ContainerAttach(ctx, containerID, types.ContainerAttachOptions{
+		Stream: true,
+		Stdin:  true,
+		Stdout: true,
+		Stderr: true,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to attach to container: %w", err)
+	}
+
+	session := &attachSession{Reader: resp.Reader, resp: resp}
+	if !info.Config.Tty {
+		pr, pw := io.Pipe()
+		go func() {
+			_, err := stdcopy.StdCopy(pw, pw, resp.Reader)
+			pw.CloseWithError(err)
+		}()
+		session.Reader = pr
+	}
+	return session, nil
+}
+
+func (a *attachSession) Write(b []byte) (int, error) {
+	return a.resp.Conn.Write(b)
+}
+
+func (a *attachSession) Close() error {
+	a.resp.Close()
+	return nil
+}
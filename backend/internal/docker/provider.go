@@ -12,11 +12,15 @@ import (
 	"github.com/docker/docker/api/types/container"
 	"github.com/docker/docker/api/types/filters"
 	"github.com/docker/docker/api/types/mount"
+	"github.com/docker/docker/api/types/network"
 	"github.com/docker/docker/client"
 	"github.com/docker/go-connections/nat"
 	"realmops/internal/models"
+	"realmops/internal/runtime"
 )
 
+var _ runtime.Runtime = (*Provider)(nil)
+
 type Provider struct {
 	client *client.Client
 }
@@ -26,7 +30,16 @@ func NewProvider(host string) (*Provider, error) {
 	if host != "" && !strings.HasPrefix(host, "unix://") {
 		opts = append(opts, client.WithHost(host))
 	}
+	return newProvider(opts)
+}
+
+// NewProviderForHost connects to a Docker-compatible API at exactly the given
+// host, ignoring DOCKER_HOST. Used for engines such as Podman.
+func NewProviderForHost(host string) (*Provider, error) {
+	return newProvider([]client.Opt{client.WithHost(host), client.WithAPIVersionNegotiation()})
+}
 
+func newProvider(opts []client.Opt) (*Provider, error) {
 	cli, err := client.NewClientWithOpts(opts...)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create docker client: %w", err)
@@ -42,6 +55,10 @@ func NewProvider(host string) (*Provider, error) {
 	return &Provider{client: cli}, nil
 }
 
+func (p *Provider) Name() string {
+	return "docker"
+}
+
 func (p *Provider) Close() error {
 	return p.client.Close()
 }
@@ -53,31 +70,7 @@ func (p *Provider) IsConnected() bool {
 	return err == nil
 }
 
-type CreateContainerOptions struct {
-	Name       string
-	Image      string
-	Workdir    string
-	User       string
-	Env        []string
-	Command    []string
-	Entrypoint []string
-	Mounts     []MountConfig
-	Ports      []PortMapping
-	Labels     map[string]string
-}
-
-type MountConfig struct {
-	Source string
-	Target string
-}
-
-type PortMapping struct {
-	ContainerPort int
-	HostPort      int
-	Protocol      string
-}
-
-func (p *Provider) CreateContainer(ctx context.Context, opts CreateContainerOptions) (string, error) {
+func (p *Provider) CreateContainer(ctx context.Context, opts runtime.CreateContainerOptions) (string, error) {
 	exposedPorts := nat.PortSet{}
 	portBindings := nat.PortMap{}
 
@@ -95,9 +88,10 @@ func (p *Provider) CreateContainer(ctx context.Context, opts CreateContainerOpti
 	var mounts []mount.Mount
 	for _, m := range opts.Mounts {
 		mounts = append(mounts, mount.Mount{
-			Type:   mount.TypeBind,
-			Source: m.Source,
-			Target: m.Target,
+			Type:     mount.TypeBind,
+			Source:   m.Source,
+			Target:   m.Target,
+			ReadOnly: m.ReadOnly,
 		})
 	}
 
@@ -110,6 +104,9 @@ func (p *Provider) CreateContainer(ctx context.Context, opts CreateContainerOpti
 		Entrypoint:   opts.Entrypoint,
 		ExposedPorts: exposedPorts,
 		Labels:       opts.Labels,
+		OpenStdin:    opts.OpenStdin,
+		AttachStdin:  opts.OpenStdin,
+		Tty:          opts.Tty,
 	}
 
 	hostConfig := &container.HostConfig{
@@ -118,9 +115,20 @@ func (p *Provider) CreateContainer(ctx context.Context, opts CreateContainerOpti
 		RestartPolicy: container.RestartPolicy{
 			Name: "no",
 		},
+		UsernsMode: container.UsernsMode(opts.UsernsMode),
 	}
 
-	resp, err := p.client.ContainerCreate(ctx, containerConfig, hostConfig, nil, nil, opts.Name)
+	var networkConfig *network.NetworkingConfig
+	if opts.Network != "" {
+		hostConfig.NetworkMode = container.NetworkMode(opts.Network)
+		networkConfig = &network.NetworkingConfig{
+			EndpointsConfig: map[string]*network.EndpointSettings{
+				opts.Network: {Aliases: opts.NetworkAliases},
+			},
+		}
+	}
+
+	resp, err := p.client.ContainerCreate(ctx, containerConfig, hostConfig, networkConfig, nil, opts.Name)
 	if err != nil {
 		return "", fmt.Errorf("failed to create container: %w", err)
 	}
@@ -145,7 +153,7 @@ func (p *Provider) RemoveContainer(ctx context.Context, containerID string, forc
 	})
 }
 
-func (p *Provider) InspectContainer(ctx context.Context, containerID string) (*ContainerInfo, error) {
+func (p *Provider) InspectContainer(ctx context.Context, containerID string) (*runtime.ContainerInfo, error) {
 	info, err := p.client.ContainerInspect(ctx, containerID)
 	if err != nil {
 		return nil, err
@@ -160,23 +168,22 @@ func (p *Provider) InspectContainer(ctx context.Context, containerID string) (*C
 		state = models.ServerStateError
 	}
 
-	return &ContainerInfo{
+	var health string
+	if info.State.Health != nil {
+		health = info.State.Health.Status
+	}
+
+	return &runtime.ContainerInfo{
 		ID:       info.ID,
 		State:    state,
 		ExitCode: info.State.ExitCode,
 		Started:  info.State.StartedAt,
 		Finished: info.State.FinishedAt,
+		Tty:      info.Config != nil && info.Config.Tty,
+		Health:   health,
 	}, nil
 }
 
-type ContainerInfo struct {
-	ID       string
-	State    models.ServerState
-	ExitCode int
-	Started  string
-	Finished string
-}
-
 type StatsResponse struct {
 	CPUStats struct {
 		CPUUsage struct {
@@ -231,12 +238,17 @@ func (p *Provider) GetContainerStats(ctx context.Context, containerID string) (*
 	}, nil
 }
 
-func (p *Provider) GetContainerLogs(ctx context.Context, containerID string, tail string, follow bool) (io.ReadCloser, error) {
+func (p *Provider) GetContainerLogs(ctx context.Context, containerID string, opts runtime.LogsOptions) (io.ReadCloser, error) {
+	var since string
+	if !opts.Since.IsZero() {
+		since = opts.Since.Format(time.RFC3339Nano)
+	}
 	return p.client.ContainerLogs(ctx, containerID, types.ContainerLogsOptions{
 		ShowStdout: true,
 		ShowStderr: true,
-		Follow:     follow,
-		Tail:       tail,
+		Follow:     opts.Follow,
+		Tail:       opts.Tail,
+		Since:      since,
 		Timestamps: true,
 	})
 }
@@ -251,6 +263,70 @@ func (p *Provider) PullImage(ctx context.Context, imageName string) error {
 	return nil
 }
 
+// EnsureNetwork creates a bridge network with the given name unless one
+// already exists, and returns its ID.
+func (p *Provider) EnsureNetwork(ctx context.Context, name string, labels map[string]string) (string, error) {
+	existing, err := p.client.NetworkInspect(ctx, name, types.NetworkInspectOptions{})
+	if err == nil {
+		return existing.ID, nil
+	}
+	if !client.IsErrNotFound(err) {
+		return "", fmt.Errorf("failed to inspect network %s: %w", name, err)
+	}
+
+	resp, err := p.client.NetworkCreate(ctx, name, types.NetworkCreate{
+		CheckDuplicate: true,
+		Driver:         "bridge",
+		Labels:         labels,
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to create network %s: %w", name, err)
+	}
+	return resp.ID, nil
+}
+
+// RemoveNetwork removes a network. Missing networks are not an error.
+func (p *Provider) RemoveNetwork(ctx context.Context, name string) error {
+	if err := p.client.NetworkRemove(ctx, name); err != nil && !client.IsErrNotFound(err) {
+		return fmt.Errorf("failed to remove network %s: %w", name, err)
+	}
+	return nil
+}
+
+// RemoveNetworkIfUnused removes a network only when no container is attached
+// to it anymore. Used for shared networks that outlive single servers.
+func (p *Provider) RemoveNetworkIfUnused(ctx context.Context, name string) error {
+	info, err := p.client.NetworkInspect(ctx, name, types.NetworkInspectOptions{})
+	if err != nil {
+		if client.IsErrNotFound(err) {
+			return nil
+		}
+		return err
+	}
+	if len(info.Containers) > 0 {
+		return nil
+	}
+	return p.RemoveNetwork(ctx, name)
+}
+
+func (p *Provider) ConnectNetwork(ctx context.Context, networkName, containerID string, aliases []string) error {
+	err := p.client.NetworkConnect(ctx, networkName, containerID, &network.EndpointSettings{
+		Aliases: aliases,
+	})
+	if err != nil && !strings.Contains(err.Error(), "already exists") {
+		return fmt.Errorf("failed to connect container to network %s: %w", networkName, err)
+	}
+	return nil
+}
+
+func (p *Provider) DisconnectNetwork(ctx context.Context, networkName, containerID string) error {
+	err := p.client.NetworkDisconnect(ctx, networkName, containerID, true)
+	if err != nil && !client.IsErrNotFound(err) && !strings.Contains(err.Error(), "is not connected") {
+		return fmt.Errorf("failed to disconnect container from network %s: %w", networkName, err)
+	}
+	return nil
+}
+
 func (p *Provider) ListContainersByLabel(ctx context.Context, labels map[string]string) ([]string, error) {
 	filterArgs := filters.NewArgs()
 	for k, v := range labels {
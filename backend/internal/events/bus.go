@@ -0,0 +1,196 @@
+// Package events fans out what happens to servers, jobs and SFTP sessions
+// to API clients, so they need not poll.
+package events
+
+import (
+	"strings"
+	"sync"
+	"time"
+)
+
+// Event types.
+const (
+	ServerState   = "server.state"
+	ServerHealth  = "server.health"
+	ServerCrashed = "server.crashed"
+
+	JobCreated   = "job.created"
+	JobStarted   = "job.started"
+	JobProgress  = "job.progress"
+	JobCompleted = "job.completed"
+	JobFailed    = "job.failed"
+	JobRetrying  = "job.retrying"
+	JobCanceled  = "job.canceled"
+
+	BackupCompleted = "backup.completed"
+
+	SFTPSessionStarted = "sftp.session_started"
+	SFTPSessionEnded   = "sftp.session_ended"
+)
+
+// DefaultBufferSize is how many events a bus keeps for clients resuming
+// after a reconnect.
+const DefaultBufferSize = 1000
+
+// subscriberBuffer is how many events a slow subscriber may fall behind
+// before it is dropped.
+const subscriberBuffer = 256
+
+type Event struct {
+	// ID is the resume cursor. IDs increase, also across restarts, as the
+	// first one is derived from the time the bus was created.
+	ID       int64     `json:"id"`
+	Type     string    `json:"type"`
+	ServerID string    `json:"serverId,omitempty"`
+	Time     time.Time `json:"time"`
+	Data     any       `json:"data,omitempty"`
+}
+
+// Filter selects events. Empty fields match everything; a type ending in
+// "." matches every type with that prefix, e.g. "job.".
+type Filter struct {
+	ServerIDs []string
+	Types     []string
+}
+
+func (f Filter) Match(e Event) bool {
+	if len(f.ServerIDs) > 0 && !contains(f.ServerIDs, e.ServerID) {
+		return false
+	}
+	if len(f.Types) == 0 {
+		return true
+	}
+	for _, t := range f.Types {
+		if t == e.Type || (strings.HasSuffix(t, ".") && strings.HasPrefix(e.Type, t)) {
+			return true
+		}
+	}
+	return false
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// Bus keeps the latest events in a ring buffer and delivers new ones to
+// subscribers. A nil *Bus discards everything, so publishers need not check
+// whether events are wired up.
+type Bus struct {
+	mu     sync.Mutex
+	nextID int64
+	ring   []Event
+	start  int // index of the oldest event in ring
+	count  int
+	subs   map[*Subscription]struct{}
+}
+
+// Subscription receives the events matching its filter on C. C is closed
+// when the subscription is canceled, or when the subscriber fell too far
+// behind, in which case Dropped reports true.
+type Subscription struct {
+	C       <-chan Event
+	c       chan Event
+	filter  Filter
+	dropped bool
+	bus     *Bus
+}
+
+func NewBus(size int) *Bus {
+	if size <= 0 {
+		size = DefaultBufferSize
+	}
+	return &Bus{
+		nextID: time.Now().UnixMilli() * 1000,
+		ring:   make([]Event, size),
+		subs:   make(map[*Subscription]struct{}),
+	}
+}
+
+// Publish records an event and delivers it to the matching subscribers.
+func (b *Bus) Publish(eventType, serverID string, data any) {
+	if b == nil {
+		return
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.nextID++
+	e := Event{ID: b.nextID, Type: eventType, ServerID: serverID, Time: time.Now(), Data: data}
+
+	i := (b.start + b.count) % len(b.ring)
+	b.ring[i] = e
+	if b.count < len(b.ring) {
+		b.count++
+	} else {
+		b.start = (b.start + 1) % len(b.ring)
+	}
+
+	for sub := range b.subs {
+		if !sub.filter.Match(e) {
+			continue
+		}
+		select {
+		case sub.c <- e:
+		default:
+			sub.dropped = true
+			delete(b.subs, sub)
+			close(sub.c)
+		}
+	}
+}
+
+// Subscribe starts delivering events that match filter. With a cursor, the
+// buffered events after it are returned first; complete is false when some
+// events after the cursor are no longer buffered, e.g. because the cursor
+// is from before a restart, and the client has to reload its state.
+func (b *Bus) Subscribe(filter Filter, cursor int64) (sub *Subscription, backlog []Event, complete bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	c := make(chan Event, subscriberBuffer)
+	sub = &Subscription{C: c, c: c, filter: filter, bus: b}
+	b.subs[sub] = struct{}{}
+
+	complete = true
+	if cursor > 0 {
+		oldest := b.nextID + 1
+		if b.count > 0 {
+			oldest = b.ring[b.start].ID
+		}
+		complete = cursor >= oldest-1 && cursor <= b.nextID
+
+		for n := 0; n < b.count; n++ {
+			e := b.ring[(b.start+n)%len(b.ring)]
+			if e.ID > cursor && filter.Match(e) {
+				backlog = append(backlog, e)
+			}
+		}
+	}
+
+	return sub, backlog, complete
+}
+
+// Cancel stops the subscription and closes C.
+func (s *Subscription) Cancel() {
+	s.bus.mu.Lock()
+	defer s.bus.mu.Unlock()
+
+	if _, ok := s.bus.subs[s]; ok {
+		delete(s.bus.subs, s)
+		close(s.c)
+	}
+}
+
+// Dropped reports whether the subscription ended because the subscriber
+// did not keep up.
+func (s *Subscription) Dropped() bool {
+	s.bus.mu.Lock()
+	defer s.bus.mu.Unlock()
+	return s.dropped
+}
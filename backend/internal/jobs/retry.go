@@ -0,0 +1,41 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+
+	"realmops/internal/models"
+)
+
+// retryableError marks a failure as transient, e.g. a network error, so that
+// the runner tries the job again.
+type retryableError struct {
+	err error
+}
+
+func (e *retryableError) Error() string { return e.err.Error() }
+func (e *retryableError) Unwrap() error { return e.err }
+
+// Retryable marks err as transient. Handlers wrap errors with it for
+// failures that may go away by themselves; anything else fails the job at
+// once.
+func Retryable(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &retryableError{err: err}
+}
+
+// IsRetryable reports whether err, or an error it wraps, was marked with
+// Retryable.
+func IsRetryable(err error) bool {
+	var re *retryableError
+	return errors.As(err, &re)
+}
+
+// WillRetry reports whether the runner runs job again after its handler
+// returned err. Handlers use it to leave the state of a job that is about
+// to be retried as it is.
+func WillRetry(ctx context.Context, job *models.Job, err error) bool {
+	return ctx.Err() == nil && IsRetryable(err) && job.Attempts < MaxAttempts
+}
@@ -2,51 +2,166 @@ package jobs
 
 import (
 	"context"
+	"database/sql"
+	"errors"
+	"fmt"
 	"log/slog"
 	"sync"
 	"time"
 
 	"realmops/internal/db"
+	"realmops/internal/events"
 	"realmops/internal/models"
 )
 
 type JobHandler func(ctx context.Context, job *models.Job) error
 
+// InterruptHandler is called for a job that stopped halfway because the
+// backend went down, after the job was requeued or failed, so that the
+// state the job left behind can be reset. It is also called, with requeued
+// false, for a job canceled while waiting to be retried.
+type InterruptHandler func(job *models.Job, requeued bool)
+
+var (
+	ErrNotFound      = errors.New("job not found")
+	ErrNotCancelable = errors.New("job has already finished")
+)
+
+const (
+	// DefaultConcurrency is how many jobs run at once unless configured.
+	DefaultConcurrency = 4
+	// MaxAttempts is how often a job failing with a retryable error is run.
+	MaxAttempts = 3
+
+	pollInterval  = 2 * time.Second
+	maxRetryDelay = 5 * time.Minute
+
+	heartbeatInterval = 15 * time.Second
+	// staleAfter is how long a running job of another runner may go
+	// without a heartbeat before it counts as interrupted
+	staleAfter = 3 * heartbeatInterval
+)
+
+// retryBaseDelay is the wait before the first retry; it doubles with every
+// further attempt.
+var retryBaseDelay = 10 * time.Second
+
+// idempotentTypes are the job types that can safely run again from the
+// start after being interrupted halfway. Interrupted jobs of other types
+// fail.
+var idempotentTypes = map[models.JobType]bool{
+	models.JobTypeInstall: true,
+	models.JobTypeUpdate:  true,
+	models.JobTypeBackup:  true,
+}
+
+// Limits caps how many jobs run at once. Jobs of the same server never run
+// at the same time, whatever the limits.
+type Limits struct {
+	Global int
+	// PerType caps job types further; types not listed only count
+	// towards Global
+	PerType map[models.JobType]int
+}
+
+type runningJob struct {
+	job      *models.Job
+	cancel   context.CancelFunc
+	canceled bool
+}
+
 type Runner struct {
-	db       *db.DB
-	handlers map[models.JobType]JobHandler
-	mu       sync.RWMutex
-	running  map[string]context.CancelFunc
+	// id tells the jobs of this process apart from those left running by
+	// a previous one
+	id          string
+	db          *db.DB
+	handlers    map[models.JobType]JobHandler
+	mu          sync.RWMutex
+	running     map[string]*runningJob
+	limits      Limits
+	events      *events.Bus
+	onInterrupt InterruptHandler
+	// wake makes the runner look for pending jobs without waiting for the
+	// next poll
+	wake chan struct{}
 }
 
 func NewRunner(database *db.DB) *Runner {
 	return &Runner{
+		id:       generateID(),
 		db:       database,
 		handlers: make(map[models.JobType]JobHandler),
-		running:  make(map[string]context.CancelFunc),
+		running:  make(map[string]*runningJob),
+		limits:   Limits{Global: DefaultConcurrency},
+		wake:     make(chan struct{}, 1),
 	}
 }
 
+// SetEvents publishes job progress on bus.
+func (r *Runner) SetEvents(bus *events.Bus) {
+	r.events = bus
+}
+
+// SetLimits sets how many jobs may run at once. A global limit below one
+// falls back to DefaultConcurrency.
+func (r *Runner) SetLimits(limits Limits) {
+	if limits.Global < 1 {
+		limits.Global = DefaultConcurrency
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.limits = limits
+}
+
+// SetInterruptHandler sets the handler called for interrupted jobs.
+func (r *Runner) SetInterruptHandler(handler InterruptHandler) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.onInterrupt = handler
+}
+
 func (r *Runner) RegisterHandler(jobType models.JobType, handler JobHandler) {
 	r.mu.Lock()
 	defer r.mu.Unlock()
 	r.handlers[jobType] = handler
 }
 
+// Start runs pending jobs until ctx is done. Jobs a previous process left
+// running are recovered first, and from then on whenever their heartbeat
+// goes stale.
 func (r *Runner) Start(ctx context.Context) {
-	ticker := time.NewTicker(2 * time.Second)
+	r.recoverInterrupted(ctx)
+
+	ticker := time.NewTicker(pollInterval)
 	defer ticker.Stop()
+	heartbeat := time.NewTicker(heartbeatInterval)
+	defer heartbeat.Stop()
 
 	for {
 		select {
 		case <-ctx.Done():
 			return
 		case <-ticker.C:
-			r.processPendingJobs(ctx)
+		case <-r.wake:
+		case <-heartbeat.C:
+			r.heartbeat()
+			r.recoverInterrupted(ctx)
 		}
+		r.processPendingJobs(ctx)
+	}
+}
+
+func (r *Runner) notify() {
+	select {
+	case r.wake <- struct{}{}:
+	default:
 	}
 }
 
+// processPendingJobs starts pending jobs in creation order as far as the
+// limits allow. A server's jobs run one after the other: once one of its
+// jobs has to wait, be it for the limits or for its retry to be due, the
+// ones after it wait too.
 func (r *Runner) processPendingJobs(ctx context.Context) {
 	jobs, err := r.getPendingJobs()
 	if err != nil {
@@ -54,32 +169,92 @@ func (r *Runner) processPendingJobs(ctx context.Context) {
 		return
 	}
 
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := time.Now()
+	busy := make(map[string]bool)
+	perType := make(map[models.JobType]int)
+	for _, rj := range r.running {
+		if rj.job.ServerID != "" {
+			busy[rj.job.ServerID] = true
+		}
+		perType[rj.job.Type]++
+	}
+	total := len(r.running)
+
 	for _, job := range jobs {
-		r.mu.RLock()
-		_, isRunning := r.running[job.ID]
-		r.mu.RUnlock()
+		if total >= r.limits.Global {
+			return
+		}
+		if _, isRunning := r.running[job.ID]; isRunning {
+			continue
+		}
+		if job.ServerID != "" {
+			if busy[job.ServerID] {
+				continue
+			}
+			busy[job.ServerID] = true
+		}
+		if job.NextRunAt != nil && job.NextRunAt.After(now) {
+			continue
+		}
+		if limit, ok := r.limits.PerType[job.Type]; ok && perType[job.Type] >= limit {
+			continue
+		}
 
-		if isRunning {
+		claimed, err := r.claimJob(job)
+		if err != nil {
+			slog.Error("failed to start job", "id", job.ID, "error", err)
+			continue
+		}
+		if !claimed {
+			// Canceled in the meantime
 			continue
 		}
 
-		go r.runJob(ctx, job)
+		jobCtx, cancel := context.WithCancel(ctx)
+		rj := &runningJob{job: job, cancel: cancel}
+		r.running[job.ID] = rj
+		total++
+		perType[job.Type]++
+		go r.runJob(jobCtx, rj)
 	}
 }
 
-func (r *Runner) runJob(ctx context.Context, job *models.Job) {
-	jobCtx, cancel := context.WithCancel(ctx)
-	r.mu.Lock()
-	r.running[job.ID] = cancel
-	r.mu.Unlock()
+// claimJob marks a pending job as running, unless it no longer is pending.
+func (r *Runner) claimJob(job *models.Job) (bool, error) {
+	now := time.Now()
+	result, err := r.db.Exec(`
+		UPDATE jobs SET status = ?, attempts = attempts + 1, next_run_at = NULL,
+			runner_id = ?, heartbeat_at = ?, updated_at = ?
+		WHERE id = ? AND status = ?
+	`, models.JobStatusRunning, r.id, now, now, job.ID, models.JobStatusPending)
+	if err != nil {
+		return false, err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return false, nil
+	}
 
+	job.Status = models.JobStatusRunning
+	job.Attempts++
+	job.NextRunAt = nil
+	job.UpdatedAt = now
+	return true, nil
+}
+
+func (r *Runner) runJob(ctx context.Context, rj *runningJob) {
+	job := rj.job
 	defer func() {
+		rj.cancel()
 		r.mu.Lock()
 		delete(r.running, job.ID)
 		r.mu.Unlock()
+		r.notify()
 	}()
 
-	r.updateJobStatus(job.ID, models.JobStatusRunning, 0, "")
+	r.publish(events.JobStarted, job, 0, "")
 
 	r.mu.RLock()
 	handler, exists := r.handlers[job.Type]
@@ -87,20 +262,219 @@ func (r *Runner) runJob(ctx context.Context, job *models.Job) {
 
 	if !exists {
 		slog.Error("no handler for job type", "type", job.Type)
-		r.updateJobStatus(job.ID, models.JobStatusFailed, 0, "no handler for job type")
+		r.finishJob(job, models.JobStatusFailed, "no handler for job type")
+		r.publish(events.JobFailed, job, job.Progress, "no handler for job type")
 		return
 	}
 
-	if err := handler(jobCtx, job); err != nil {
+	err := handler(ctx, job)
+
+	r.mu.RLock()
+	canceled := rj.canceled
+	r.mu.RUnlock()
+
+	switch {
+	case err == nil:
+		r.finishJob(job, models.JobStatusCompleted, "")
+		r.publish(events.JobCompleted, job, 100, "")
+		if job.Type == models.JobTypeBackup {
+			// Backups get an event of their own, so that consumers need not
+			// follow every job
+			r.publish(events.BackupCompleted, job, 100, "")
+		}
+	case canceled:
+		slog.Info("job canceled", "id", job.ID)
+		r.finishJob(job, models.JobStatusCanceled, "Canceled\n")
+		r.publish(events.JobCanceled, job, job.Progress, "")
+	case ctx.Err() != nil:
+		// The backend is shutting down
+		r.recoverJob(job, "Interrupted by shutdown")
+	case WillRetry(ctx, job, err):
+		delay := retryDelay(job.Attempts)
+		slog.Warn("job failed, retrying", "id", job.ID, "attempt", job.Attempts, "retryIn", delay, "error", err)
+		r.retryJob(job, delay, err)
+		r.publish(events.JobRetrying, job, job.Progress, err.Error())
+	default:
 		slog.Error("job failed", "id", job.ID, "error", err)
-		r.updateJobStatus(job.ID, models.JobStatusFailed, job.Progress, err.Error())
+		r.finishJob(job, models.JobStatusFailed, err.Error()+"\n")
+		r.publish(events.JobFailed, job, job.Progress, err.Error())
+	}
+}
+
+// heartbeat marks the jobs of this runner as alive.
+func (r *Runner) heartbeat() {
+	_, err := r.db.Exec(`UPDATE jobs SET heartbeat_at = ? WHERE runner_id = ? AND status = ?`,
+		time.Now(), r.id, models.JobStatusRunning)
+	if err != nil {
+		slog.Error("failed to update job heartbeat", "error", err)
+	}
+}
+
+// recoverInterrupted requeues or fails the jobs left running by another
+// runner that stopped sending heartbeats, which is what a crashed backend
+// leaves behind.
+func (r *Runner) recoverInterrupted(ctx context.Context) {
+	rows, err := r.db.Query(`
+		SELECT `+jobColumns+`
+		FROM jobs WHERE status = ? AND (runner_id IS NULL OR runner_id != ?)
+			AND (heartbeat_at IS NULL OR heartbeat_at < ?)
+	`, models.JobStatusRunning, r.id, time.Now().Add(-staleAfter))
+	if err != nil {
+		slog.Error("failed to find interrupted jobs", "error", err)
 		return
 	}
+	var interrupted []*models.Job
+	for rows.Next() {
+		job, err := scanJob(rows)
+		if err != nil {
+			slog.Error("failed to read interrupted job", "error", err)
+			continue
+		}
+		interrupted = append(interrupted, job)
+	}
+	rows.Close()
 
-	r.updateJobStatus(job.ID, models.JobStatusCompleted, 100, "")
+	for _, job := range interrupted {
+		if ctx.Err() != nil {
+			return
+		}
+		r.recoverJob(job, "Interrupted by a backend restart")
+	}
+}
+
+// recoverJob requeues an interrupted job if its type is idempotent and it
+// has attempts left, so that a job that brings the backend down does not
+// do so forever. Otherwise the job fails.
+func (r *Runner) recoverJob(job *models.Job, reason string) {
+	requeue := idempotentTypes[job.Type] && job.Attempts < MaxAttempts
+
+	status := models.JobStatusFailed
+	msg := reason + "\n"
+	if requeue {
+		status = models.JobStatusPending
+		msg = reason + ", requeued\n"
+	}
+
+	result, err := r.db.Exec(`
+		UPDATE jobs SET status = ?, runner_id = NULL, heartbeat_at = NULL, logs = logs || ?, updated_at = ?
+		WHERE id = ? AND status = ?
+	`, status, msg, time.Now(), job.ID, models.JobStatusRunning)
+	if err != nil {
+		slog.Error("failed to recover interrupted job", "id", job.ID, "error", err)
+		return
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return
+	}
+	job.Status = status
+	slog.Warn("recovered interrupted job", "id", job.ID, "type", job.Type, "serverId", job.ServerID, "requeued", requeue)
+
+	r.mu.RLock()
+	onInterrupt := r.onInterrupt
+	r.mu.RUnlock()
+	if onInterrupt != nil {
+		onInterrupt(job, requeue)
+	}
+
+	if requeue {
+		r.publish(events.JobRetrying, job, job.Progress, reason)
+	} else {
+		r.publish(events.JobFailed, job, job.Progress, reason)
+	}
+}
+
+// retryDelay is how long to wait before running a job again after its nth
+// attempt failed.
+func retryDelay(attempt int) time.Duration {
+	delay := retryBaseDelay << (attempt - 1)
+	if delay > maxRetryDelay || delay <= 0 {
+		delay = maxRetryDelay
+	}
+	return delay
+}
+
+// Cancel cancels a pending job, or asks a running one to stop by canceling
+// its context. A running job reports canceled once its handler returns.
+func (r *Runner) Cancel(id string) (*models.Job, error) {
+	// Held while canceling a pending job so that it cannot be started at
+	// the same time
+	r.mu.Lock()
+	if rj, ok := r.running[id]; ok {
+		rj.canceled = true
+		rj.cancel()
+		r.mu.Unlock()
+		return r.GetJob(id)
+	}
+
+	result, err := r.db.Exec(`
+		UPDATE jobs SET status = ?, next_run_at = NULL, logs = logs || ?, updated_at = ?
+		WHERE id = ? AND status = ?
+	`, models.JobStatusCanceled, "Canceled\n", time.Now(), id, models.JobStatusPending)
+	r.mu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+
+	job, err := r.GetJob(id)
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return job, ErrNotCancelable
+	}
+
+	r.mu.RLock()
+	onInterrupt := r.onInterrupt
+	r.mu.RUnlock()
+	if onInterrupt != nil && job.Attempts > 0 {
+		// It was waiting to be retried
+		onInterrupt(job, false)
+	}
+
+	r.publish(events.JobCanceled, job, job.Progress, "")
+	return job, nil
+}
+
+// publish sends a job event. Logs are left out; clients fetch the job for
+// them.
+func (r *Runner) publish(eventType string, job *models.Job, progress float64, errMsg string) {
+	data := map[string]any{
+		"jobId":    job.ID,
+		"type":     job.Type,
+		"progress": progress,
+		"attempts": job.Attempts,
+	}
+	if errMsg != "" {
+		data["error"] = errMsg
+	}
+	if job.NextRunAt != nil {
+		data["nextRunAt"] = job.NextRunAt
+	}
+	r.events.Publish(eventType, job.ServerID, data)
 }
 
 func (r *Runner) CreateJob(jobType models.JobType, serverID string) (*models.Job, error) {
+	job, err := r.createJob(r.db, jobType, serverID)
+	if err != nil {
+		return nil, err
+	}
+	r.publish(events.JobCreated, job, 0, "")
+	r.notify()
+	return job, nil
+}
+
+// CreateJobTx creates a job as part of the caller's transaction. The runner
+// only picks it up once the transaction commits. No job.created event is
+// published, as the transaction may yet roll back; job.started follows once
+// the job runs.
+func (r *Runner) CreateJobTx(tx *sql.Tx, jobType models.JobType, serverID string) (*models.Job, error) {
+	return r.createJob(tx, jobType, serverID)
+}
+
+func (r *Runner) createJob(q db.Querier, jobType models.JobType, serverID string) (*models.Job, error) {
 	id := generateID()
 	job := &models.Job{
 		ID:        id,
@@ -112,7 +486,7 @@ func (r *Runner) CreateJob(jobType models.JobType, serverID string) (*models.Job
 		UpdatedAt: time.Now(),
 	}
 
-	_, err := r.db.Exec(`
+	_, err := q.Exec(`
 		INSERT INTO jobs (id, type, server_id, status, progress, logs, created_at, updated_at)
 		VALUES (?, ?, ?, ?, ?, ?, ?, ?)
 	`, job.ID, job.Type, job.ServerID, job.Status, job.Progress, job.Logs, job.CreatedAt, job.UpdatedAt)
@@ -124,30 +498,51 @@ func (r *Runner) CreateJob(jobType models.JobType, serverID string) (*models.Job
 	return job, nil
 }
 
-func (r *Runner) GetJob(id string) (*models.Job, error) {
+const jobColumns = `id, type, server_id, status, progress, logs, attempts, next_run_at, created_at, updated_at`
+
+func scanJob(row interface{ Scan(...any) error }) (*models.Job, error) {
 	var job models.Job
-	err := r.db.QueryRow(`
-		SELECT id, type, server_id, status, progress, logs, created_at, updated_at
-		FROM jobs WHERE id = ?
-	`, id).Scan(&job.ID, &job.Type, &job.ServerID, &job.Status, &job.Progress, &job.Logs, &job.CreatedAt, &job.UpdatedAt)
+	var serverID sql.NullString
+	var nextRunAt sql.NullTime
+	err := row.Scan(&job.ID, &job.Type, &serverID, &job.Status, &job.Progress, &job.Logs, &job.Attempts, &nextRunAt, &job.CreatedAt, &job.UpdatedAt)
 	if err != nil {
 		return nil, err
 	}
+	// The server of a job may have been deleted since
+	job.ServerID = serverID.String
+	if nextRunAt.Valid {
+		job.NextRunAt = &nextRunAt.Time
+	}
 	return &job, nil
 }
 
+func (r *Runner) GetJob(id string) (*models.Job, error) {
+	return scanJob(r.db.QueryRow(`SELECT `+jobColumns+` FROM jobs WHERE id = ?`, id))
+}
+
 func (r *Runner) UpdateProgress(jobID string, progress float64, logs string) error {
 	_, err := r.db.Exec(`
 		UPDATE jobs SET progress = ?, logs = logs || ?, updated_at = ?
 		WHERE id = ?
 	`, progress, logs, time.Now(), jobID)
-	return err
+	if err != nil {
+		return err
+	}
+
+	if r.events != nil {
+		if job, err := r.GetJob(jobID); err == nil {
+			r.publish(events.JobProgress, job, progress, "")
+		}
+	}
+	return nil
 }
 
+// getPendingJobs returns the pending jobs, oldest first, including those
+// whose retry is not due yet.
 func (r *Runner) getPendingJobs() ([]*models.Job, error) {
 	rows, err := r.db.Query(`
-		SELECT id, type, server_id, status, progress, logs, created_at, updated_at
-		FROM jobs WHERE status = ? ORDER BY created_at ASC LIMIT 10
+		SELECT `+jobColumns+`
+		FROM jobs WHERE status = ? ORDER BY created_at ASC
 	`, models.JobStatusPending)
 	if err != nil {
 		return nil, err
@@ -156,28 +551,48 @@ func (r *Runner) getPendingJobs() ([]*models.Job, error) {
 
 	var jobs []*models.Job
 	for rows.Next() {
-		var job models.Job
-		if err := rows.Scan(&job.ID, &job.Type, &job.ServerID, &job.Status, &job.Progress, &job.Logs, &job.CreatedAt, &job.UpdatedAt); err != nil {
+		job, err := scanJob(rows)
+		if err != nil {
 			return nil, err
 		}
-		jobs = append(jobs, &job)
+		jobs = append(jobs, job)
 	}
 	return jobs, rows.Err()
 }
 
-func (r *Runner) updateJobStatus(jobID string, status models.JobStatus, progress float64, logs string) {
+// finishJob records the final status of a job and appends msg to its logs.
+func (r *Runner) finishJob(job *models.Job, status models.JobStatus, msg string) {
+	if status == models.JobStatusCompleted {
+		job.Progress = 100
+	}
+	job.Status = status
+	_, err := r.db.Exec(`
+		UPDATE jobs SET status = ?, progress = MAX(progress, ?), logs = logs || ?, updated_at = ?
+		WHERE id = ?
+	`, status, job.Progress, msg, time.Now(), job.ID)
+	if err != nil {
+		slog.Error("failed to update job status", "id", job.ID, "error", err)
+	}
+}
+
+// retryJob puts a failed job back in the queue to run again after delay.
+func (r *Runner) retryJob(job *models.Job, delay time.Duration, cause error) {
+	next := time.Now().Add(delay)
+	job.Status = models.JobStatusPending
+	job.NextRunAt = &next
+	msg := fmt.Sprintf("Attempt %d failed: %v\nRetrying in %s\n", job.Attempts, cause, delay)
 	_, err := r.db.Exec(`
-		UPDATE jobs SET status = ?, progress = ?, logs = ?, updated_at = ?
+		UPDATE jobs SET status = ?, next_run_at = ?, logs = logs || ?, updated_at = ?
 		WHERE id = ?
-	`, status, progress, logs, time.Now(), jobID)
+	`, job.Status, next, msg, time.Now(), job.ID)
 	if err != nil {
-		slog.Error("failed to update job status", "id", jobID, "error", err)
+		slog.Error("failed to requeue job", "id", job.ID, "error", err)
 	}
 }
 
 func (r *Runner) GetServerJobs(serverID string, limit int) ([]*models.Job, error) {
 	rows, err := r.db.Query(`
-		SELECT id, type, server_id, status, progress, logs, created_at, updated_at
+		SELECT `+jobColumns+`
 		FROM jobs WHERE server_id = ? ORDER BY created_at DESC LIMIT ?
 	`, serverID, limit)
 	if err != nil {
@@ -187,11 +602,11 @@ func (r *Runner) GetServerJobs(serverID string, limit int) ([]*models.Job, error
 
 	var jobs []*models.Job
 	for rows.Next() {
-		var job models.Job
-		if err := rows.Scan(&job.ID, &job.Type, &job.ServerID, &job.Status, &job.Progress, &job.Logs, &job.CreatedAt, &job.UpdatedAt); err != nil {
+		job, err := scanJob(rows)
+		if err != nil {
 			return nil, err
 		}
-		jobs = append(jobs, &job)
+		jobs = append(jobs, job)
 	}
 	return jobs, rows.Err()
 }
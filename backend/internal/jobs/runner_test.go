@@ -0,0 +1,495 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"realmops/internal/db"
+	"realmops/internal/events"
+	"realmops/internal/models"
+)
+
+func newTestRunner(t *testing.T) *Runner {
+	t.Helper()
+	database, err := db.New(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { database.Close() })
+	if err := database.Migrate(); err != nil {
+		t.Fatal(err)
+	}
+	r := NewRunner(database)
+	r.SetEvents(events.NewBus(0))
+	return r
+}
+
+// runningIDs returns the IDs of the jobs the runner has started and not yet
+// finished.
+func runningIDs(r *Runner) []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	var ids []string
+	for id := range r.running {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// waitDone waits until the runner is done with a job and returns it.
+func waitDone(t *testing.T, r *Runner, id string) *models.Job {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		r.mu.RLock()
+		_, running := r.running[id]
+		r.mu.RUnlock()
+		if !running {
+			job, err := r.GetJob(id)
+			if err != nil {
+				t.Fatalf("GetJob: %v", err)
+			}
+			return job
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	t.Fatalf("job %s did not finish", id)
+	return nil
+}
+
+// backOff makes a pending job wait for a retry that is not due yet.
+func backOff(t *testing.T, r *Runner, id string) {
+	t.Helper()
+	_, err := r.db.Exec(`UPDATE jobs SET attempts = 1, next_run_at = ? WHERE id = ?`, time.Now().Add(time.Hour), id)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestProcessPendingJobsLimits(t *testing.T) {
+	type pendingJob struct {
+		jobType models.JobType
+		server  string
+		backoff bool
+	}
+
+	tests := []struct {
+		name   string
+		limits Limits
+		jobs   []pendingJob
+		// want are the indexes of the jobs that start
+		want []int
+	}{
+		{
+			name:   "global limit",
+			limits: Limits{Global: 2},
+			jobs: []pendingJob{
+				{jobType: models.JobTypeInstall, server: "a"},
+				{jobType: models.JobTypeInstall, server: "b"},
+				{jobType: models.JobTypeInstall, server: "c"},
+			},
+			want: []int{0, 1},
+		},
+		{
+			name:   "per-type limit",
+			limits: Limits{Global: 4, PerType: map[models.JobType]int{models.JobTypeBackup: 1}},
+			jobs: []pendingJob{
+				{jobType: models.JobTypeBackup, server: "a"},
+				{jobType: models.JobTypeBackup, server: "b"},
+				{jobType: models.JobTypeInstall, server: "c"},
+			},
+			want: []int{0, 2},
+		},
+		{
+			name:   "one job per server",
+			limits: Limits{Global: 4},
+			jobs: []pendingJob{
+				{jobType: models.JobTypeInstall, server: "a"},
+				{jobType: models.JobTypeBackup, server: "a"},
+				{jobType: models.JobTypeInstall, server: "b"},
+			},
+			want: []int{0, 2},
+		},
+		{
+			name:   "jobs without a server run side by side",
+			limits: Limits{Global: 4},
+			jobs: []pendingJob{
+				{jobType: models.JobTypeBackup},
+				{jobType: models.JobTypeBackup},
+			},
+			want: []int{0, 1},
+		},
+		{
+			name:   "later jobs wait behind one held by a limit",
+			limits: Limits{Global: 4, PerType: map[models.JobType]int{models.JobTypeBackup: 1}},
+			jobs: []pendingJob{
+				{jobType: models.JobTypeBackup, server: "a"},
+				{jobType: models.JobTypeBackup, server: "b"},
+				{jobType: models.JobTypeInstall, server: "b"},
+			},
+			want: []int{0},
+		},
+		{
+			name:   "later jobs wait behind one backing off",
+			limits: Limits{Global: 4},
+			jobs: []pendingJob{
+				{jobType: models.JobTypeInstall, server: "a", backoff: true},
+				{jobType: models.JobTypeUpdate, server: "a"},
+				{jobType: models.JobTypeInstall, server: "b"},
+			},
+			want: []int{2},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := newTestRunner(t)
+			r.SetLimits(tt.limits)
+
+			release := make(chan struct{})
+			block := func(ctx context.Context, job *models.Job) error {
+				<-release
+				return nil
+			}
+			r.RegisterHandler(models.JobTypeInstall, block)
+			r.RegisterHandler(models.JobTypeUpdate, block)
+			r.RegisterHandler(models.JobTypeBackup, block)
+
+			var ids []string
+			for _, pj := range tt.jobs {
+				job, err := r.CreateJob(pj.jobType, pj.server)
+				if err != nil {
+					t.Fatalf("CreateJob: %v", err)
+				}
+				if pj.backoff {
+					backOff(t, r, job.ID)
+				}
+				ids = append(ids, job.ID)
+			}
+
+			r.processPendingJobs(context.Background())
+
+			var want []string
+			for _, i := range tt.want {
+				want = append(want, ids[i])
+			}
+			sort.Strings(want)
+			got := runningIDs(r)
+			close(release)
+			for _, id := range got {
+				waitDone(t, r, id)
+			}
+
+			if len(got) != len(want) {
+				t.Fatalf("started %v, want %v", got, want)
+			}
+			for i := range got {
+				if got[i] != want[i] {
+					t.Fatalf("started %v, want %v", got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestProcessPendingJobsOrder(t *testing.T) {
+	r := newTestRunner(t)
+
+	var mu sync.Mutex
+	var order []models.JobType
+	record := func(ctx context.Context, job *models.Job) error {
+		mu.Lock()
+		order = append(order, job.Type)
+		mu.Unlock()
+		return nil
+	}
+	r.RegisterHandler(models.JobTypeInstall, record)
+	r.RegisterHandler(models.JobTypeUpdate, record)
+	r.RegisterHandler(models.JobTypeBackup, record)
+
+	want := []models.JobType{models.JobTypeInstall, models.JobTypeUpdate, models.JobTypeBackup}
+	var ids []string
+	for _, jobType := range want {
+		job, err := r.CreateJob(jobType, "a")
+		if err != nil {
+			t.Fatalf("CreateJob: %v", err)
+		}
+		ids = append(ids, job.ID)
+	}
+
+	for _, id := range ids {
+		r.processPendingJobs(context.Background())
+		if job := waitDone(t, r, id); job.Status != models.JobStatusCompleted {
+			t.Fatalf("job %s is %s, want completed", job.Type, job.Status)
+		}
+	}
+
+	if len(order) != len(want) {
+		t.Fatalf("ran %v, want %v", order, want)
+	}
+	for i := range order {
+		if order[i] != want[i] {
+			t.Fatalf("ran %v, want %v", order, want)
+		}
+	}
+}
+
+func TestRetry(t *testing.T) {
+	defer func(d time.Duration) { retryBaseDelay = d }(retryBaseDelay)
+	retryBaseDelay = 20 * time.Millisecond
+
+	transient := Retryable(errors.New("connection reset"))
+
+	tests := []struct {
+		name string
+		// results are what the handler returns on each attempt, repeating
+		// the last one
+		results      []error
+		wantStatus   models.JobStatus
+		wantAttempts int
+	}{
+		{name: "succeeds", results: []error{nil}, wantStatus: models.JobStatusCompleted, wantAttempts: 1},
+		{name: "succeeds after retries", results: []error{transient, transient, nil}, wantStatus: models.JobStatusCompleted, wantAttempts: 3},
+		{name: "permanent errors are not retried", results: []error{errors.New("bad manifest")}, wantStatus: models.JobStatusFailed, wantAttempts: 1},
+		{name: "gives up after MaxAttempts", results: []error{transient}, wantStatus: models.JobStatusFailed, wantAttempts: MaxAttempts},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := newTestRunner(t)
+			results := tt.results
+			r.RegisterHandler(models.JobTypeInstall, func(ctx context.Context, job *models.Job) error {
+				err := results[0]
+				if len(results) > 1 {
+					results = results[1:]
+				}
+				return err
+			})
+
+			job, err := r.CreateJob(models.JobTypeInstall, "a")
+			if err != nil {
+				t.Fatalf("CreateJob: %v", err)
+			}
+
+			for i := 0; i <= MaxAttempts; i++ {
+				r.processPendingJobs(context.Background())
+				job = waitDone(t, r, job.ID)
+				if job.Status != models.JobStatusPending {
+					break
+				}
+
+				if job.NextRunAt == nil {
+					t.Fatal("retried job has no next run time")
+				}
+				if wait := time.Until(*job.NextRunAt); wait > retryDelay(job.Attempts) {
+					t.Fatalf("retry in %v, want at most %v", wait, retryDelay(job.Attempts))
+				}
+				// Not due yet
+				r.processPendingJobs(context.Background())
+				if got := runningIDs(r); len(got) != 0 {
+					t.Fatalf("retry ran %v early", time.Until(*job.NextRunAt))
+				}
+				time.Sleep(time.Until(*job.NextRunAt))
+			}
+
+			if job.Status != tt.wantStatus || job.Attempts != tt.wantAttempts {
+				t.Errorf("job = %s after %d attempts, want %s after %d",
+					job.Status, job.Attempts, tt.wantStatus, tt.wantAttempts)
+			}
+		})
+	}
+}
+
+func TestCancel(t *testing.T) {
+	t.Run("pending", func(t *testing.T) {
+		r := newTestRunner(t)
+		ran := false
+		r.RegisterHandler(models.JobTypeInstall, func(ctx context.Context, job *models.Job) error {
+			ran = true
+			return nil
+		})
+		job, err := r.CreateJob(models.JobTypeInstall, "a")
+		if err != nil {
+			t.Fatalf("CreateJob: %v", err)
+		}
+
+		got, err := r.Cancel(job.ID)
+		if err != nil {
+			t.Fatalf("Cancel: %v", err)
+		}
+		if got.Status != models.JobStatusCanceled {
+			t.Errorf("status = %s, want canceled", got.Status)
+		}
+
+		r.processPendingJobs(context.Background())
+		if ids := runningIDs(r); len(ids) != 0 || ran {
+			t.Error("canceled job ran")
+		}
+		if _, err := r.Cancel(job.ID); !errors.Is(err, ErrNotCancelable) {
+			t.Errorf("Cancel again = %v, want %v", err, ErrNotCancelable)
+		}
+	})
+
+	t.Run("waiting for a retry", func(t *testing.T) {
+		r := newTestRunner(t)
+		var interrupted *models.Job
+		r.SetInterruptHandler(func(job *models.Job, requeued bool) {
+			if requeued {
+				t.Error("canceled job reported as requeued")
+			}
+			interrupted = job
+		})
+		job, err := r.CreateJob(models.JobTypeInstall, "a")
+		if err != nil {
+			t.Fatalf("CreateJob: %v", err)
+		}
+		backOff(t, r, job.ID)
+
+		if _, err := r.Cancel(job.ID); err != nil {
+			t.Fatalf("Cancel: %v", err)
+		}
+		if interrupted == nil || interrupted.ID != job.ID {
+			t.Error("interrupt handler not called for the canceled retry")
+		}
+	})
+
+	t.Run("running", func(t *testing.T) {
+		r := newTestRunner(t)
+		started := make(chan struct{})
+		r.RegisterHandler(models.JobTypeInstall, func(ctx context.Context, job *models.Job) error {
+			close(started)
+			<-ctx.Done()
+			// Canceling must not count as a transient failure
+			return Retryable(ctx.Err())
+		})
+		job, err := r.CreateJob(models.JobTypeInstall, "a")
+		if err != nil {
+			t.Fatalf("CreateJob: %v", err)
+		}
+
+		r.processPendingJobs(context.Background())
+		select {
+		case <-started:
+		case <-time.After(5 * time.Second):
+			t.Fatal("job did not start")
+		}
+
+		if _, err := r.Cancel(job.ID); err != nil {
+			t.Fatalf("Cancel: %v", err)
+		}
+		got := waitDone(t, r, job.ID)
+		if got.Status != models.JobStatusCanceled || got.Attempts != 1 {
+			t.Errorf("job = %s after %d attempts, want canceled after 1", got.Status, got.Attempts)
+		}
+	})
+
+	t.Run("unknown", func(t *testing.T) {
+		r := newTestRunner(t)
+		if _, err := r.Cancel("nope"); !errors.Is(err, ErrNotFound) {
+			t.Errorf("Cancel = %v, want %v", err, ErrNotFound)
+		}
+	})
+}
+
+func TestRecoverInterrupted(t *testing.T) {
+	const (
+		noRunner    = ""
+		otherRunner = "other"
+		thisRunner  = "this"
+	)
+	stale := time.Now().Add(-2 * staleAfter)
+	fresh := time.Now()
+
+	tests := []struct {
+		name      string
+		jobType   models.JobType
+		attempts  int
+		runner    string
+		heartbeat *time.Time
+		want      models.JobStatus
+		// wantInterrupt is whether the interrupt handler is called, and
+		// wantRequeued what it is told
+		wantInterrupt bool
+		wantRequeued  bool
+	}{
+		{name: "install without a runner", jobType: models.JobTypeInstall, attempts: 1, runner: noRunner, want: models.JobStatusPending, wantInterrupt: true, wantRequeued: true},
+		{name: "update of a stale runner", jobType: models.JobTypeUpdate, attempts: 1, runner: otherRunner, heartbeat: &stale, want: models.JobStatusPending, wantInterrupt: true, wantRequeued: true},
+		{name: "install out of attempts", jobType: models.JobTypeInstall, attempts: MaxAttempts, runner: otherRunner, heartbeat: &stale, want: models.JobStatusFailed, wantInterrupt: true},
+		{name: "port migration", jobType: models.JobTypePortMigrate, attempts: 1, runner: otherRunner, heartbeat: &stale, want: models.JobStatusFailed, wantInterrupt: true},
+		{name: "restore", jobType: models.JobTypeRestore, attempts: 1, runner: noRunner, want: models.JobStatusFailed, wantInterrupt: true},
+		{name: "other runner still alive", jobType: models.JobTypeInstall, attempts: 1, runner: otherRunner, heartbeat: &fresh, want: models.JobStatusRunning},
+		{name: "own job", jobType: models.JobTypeInstall, attempts: 1, runner: thisRunner, heartbeat: &stale, want: models.JobStatusRunning},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := newTestRunner(t)
+			var calls []bool
+			r.SetInterruptHandler(func(job *models.Job, requeued bool) {
+				calls = append(calls, requeued)
+			})
+
+			job, err := r.CreateJob(tt.jobType, "a")
+			if err != nil {
+				t.Fatalf("CreateJob: %v", err)
+			}
+			var runnerID any
+			switch tt.runner {
+			case otherRunner:
+				runnerID = "previous-process"
+			case thisRunner:
+				runnerID = r.id
+			}
+			var heartbeat any
+			if tt.heartbeat != nil {
+				heartbeat = *tt.heartbeat
+			}
+			_, err = r.db.Exec(`UPDATE jobs SET status = ?, attempts = ?, runner_id = ?, heartbeat_at = ? WHERE id = ?`,
+				models.JobStatusRunning, tt.attempts, runnerID, heartbeat, job.ID)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			r.recoverInterrupted(context.Background())
+
+			got, err := r.GetJob(job.ID)
+			if err != nil {
+				t.Fatalf("GetJob: %v", err)
+			}
+			if got.Status != tt.want {
+				t.Errorf("status = %s, want %s", got.Status, tt.want)
+			}
+			if got.Attempts != tt.attempts {
+				t.Errorf("attempts = %d, want %d", got.Attempts, tt.attempts)
+			}
+
+			if !tt.wantInterrupt {
+				if len(calls) != 0 {
+					t.Errorf("interrupt handler called for a job that was left alone")
+				}
+				return
+			}
+			if len(calls) != 1 || calls[0] != tt.wantRequeued {
+				t.Errorf("interrupt handler calls = %v, want one with requeued %v", calls, tt.wantRequeued)
+			}
+			if tt.want == models.JobStatusPending {
+				// Requeued jobs run again
+				var ran bool
+				r.RegisterHandler(tt.jobType, func(ctx context.Context, job *models.Job) error {
+					ran = true
+					return nil
+				})
+				r.processPendingJobs(context.Background())
+				if got := waitDone(t, r, job.ID); !ran || got.Status != models.JobStatusCompleted {
+					t.Errorf("requeued job is %s after running again, want completed", got.Status)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,445 @@
+// Package logarchive keeps the output of every server container on disk, so
+// that it survives the container being recreated, and searches it.
+package logarchive
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"realmops/internal/logstream"
+	"realmops/internal/runtime"
+	"realmops/internal/server"
+)
+
+const (
+	// catchUpTimeout bounds the final read of a stopped container's logs.
+	catchUpTimeout = 30 * time.Second
+
+	// MaxFileSize is the size at which the current log file of a session is
+	// compressed and a new one started.
+	MaxFileSize = 8 << 20
+	// MaxSessions is how many sessions are kept per server; the oldest
+	// finished ones are deleted first.
+	MaxSessions = 20
+	// MaxLineLength caps the text of an archived line; longer lines are
+	// truncated.
+	MaxLineLength = 16 << 10
+
+	currentFile = "current.log"
+	metaFile    = "session.json"
+)
+
+// Session is the archived output of one container, from its creation until
+// it was removed. Its directory holds the rotated files 000001.log.gz,
+// 000002.log.gz, ... and the file being written, current.log. Every file
+// has one JSON encoded logstream.Line per line.
+type Session struct {
+	ID          string     `json:"id"`
+	ContainerID string     `json:"containerId"`
+	StartedAt   time.Time  `json:"startedAt"`
+	EndedAt     *time.Time `json:"endedAt,omitempty"`
+	LastLineAt  *time.Time `json:"lastLineAt,omitempty"`
+	Files       int        `json:"files"`
+	Size        int64      `json:"size"`
+}
+
+// Archiver copies the logs of running servers into sessions under
+// <dataDir>/servers/<id>/logs.
+type Archiver struct {
+	serverManager *server.Manager
+	runtime       runtime.Runtime
+	dataDir       string
+
+	// rotateMu keeps searches from reading files that are being rotated
+	rotateMu sync.RWMutex
+}
+
+func NewArchiver(serverManager *server.Manager, containerRuntime runtime.Runtime, dataDir string) *Archiver {
+	return &Archiver{
+		serverManager: serverManager,
+		runtime:       containerRuntime,
+		dataDir:       dataDir,
+	}
+}
+
+// Start archives logs until ctx is done. Sessions left open by a previous
+// run are picked up where they stopped.
+func (a *Archiver) Start(ctx context.Context) {
+	logstream.NewWatcher(a.serverManager.RunningContainers, a.archive).Run(ctx)
+}
+
+// archive follows a container until its watch ends. If that is because the
+// container stopped, rather than because the archiver is shutting down, the
+// rest of its output is read and the session finished. A server's next
+// watch only starts after this returns, so a container started again opens
+// its session once the previous run has finished it.
+func (a *Archiver) archive(ctx context.Context, serverID, containerID string) {
+	w, err := a.open(serverID, containerID)
+	if err != nil {
+		slog.Error("failed to open log archive", "serverId", serverID, "error", err)
+		return
+	}
+
+	logstream.Repeat(ctx, func(ctx context.Context) {
+		if err := w.copy(ctx, a.runtime, true); err != nil && ctx.Err() == nil {
+			slog.Debug("log archiving interrupted", "serverId", serverID, "error", err)
+		}
+	})
+
+	if context.Cause(ctx) != logstream.ErrContainerStopped {
+		w.close()
+		return
+	}
+
+	cctx, cancel := context.WithTimeout(context.Background(), catchUpTimeout)
+	defer cancel()
+	w.copy(cctx, a.runtime, false)
+
+	if err := w.finish(); err != nil {
+		slog.Error("failed to finish log archive", "serverId", serverID, "error", err)
+	}
+	a.prune(serverID)
+}
+
+func (a *Archiver) serverLogDir(serverID string) string {
+	return filepath.Join(a.dataDir, "servers", serverID, "logs")
+}
+
+// sessionWriter appends to the current file of a session.
+type sessionWriter struct {
+	a       *Archiver
+	dir     string
+	session Session
+
+	file *os.File
+	size int64
+	// last is the time of the newest archived line; older lines are
+	// skipped when a stream is read again
+	last time.Time
+}
+
+// open resumes the session of a container or starts a new one.
+func (a *Archiver) open(serverID, containerID string) (*sessionWriter, error) {
+	base := a.serverLogDir(serverID)
+	if err := os.MkdirAll(base, 0755); err != nil {
+		return nil, err
+	}
+
+	w := &sessionWriter{a: a}
+
+	matches, _ := filepath.Glob(filepath.Join(base, "*-"+shortID(containerID)))
+	if len(matches) > 0 {
+		w.dir = matches[len(matches)-1]
+		if err := readJSON(filepath.Join(w.dir, metaFile), &w.session); err != nil {
+			return nil, err
+		}
+		w.session.EndedAt = nil
+		if w.session.LastLineAt != nil {
+			w.last = *w.session.LastLineAt
+		}
+		if t, ok := lastLineTime(filepath.Join(w.dir, currentFile)); ok {
+			w.last = t
+		}
+	} else {
+		now := time.Now()
+		w.session = Session{
+			ID:          fmt.Sprintf("%d-%s", now.Unix(), shortID(containerID)),
+			ContainerID: containerID,
+			StartedAt:   now,
+		}
+		w.dir = filepath.Join(base, w.session.ID)
+		if err := os.MkdirAll(w.dir, 0755); err != nil {
+			return nil, err
+		}
+	}
+
+	file, err := os.OpenFile(filepath.Join(w.dir, currentFile), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, err
+	}
+	info, _ := file.Stat()
+	w.file = file
+	if info != nil {
+		w.size = info.Size()
+	}
+
+	return w, w.saveMeta()
+}
+
+// copy archives the container's output that is newer than the last
+// archived line, following it if asked to.
+func (w *sessionWriter) copy(ctx context.Context, rt runtime.Runtime, follow bool) error {
+	opts := runtime.LogsOptions{Tail: "all", Follow: follow, Since: w.last}
+	r, err := logstream.Open(ctx, rt, w.session.ContainerID, opts)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			r.Close()
+		case <-done:
+		}
+	}()
+
+	for {
+		line, err := r.Next()
+		if err != nil {
+			if err == io.EOF || ctx.Err() != nil {
+				return nil
+			}
+			return err
+		}
+		if !line.Time.After(w.last) {
+			continue
+		}
+		if err := w.write(line); err != nil {
+			return err
+		}
+	}
+}
+
+func (w *sessionWriter) write(line logstream.Line) error {
+	if len(line.Text) > MaxLineLength {
+		line.Text = strings.ToValidUTF8(line.Text[:MaxLineLength], "")
+	}
+	data, err := json.Marshal(line)
+	if err != nil {
+		return err
+	}
+	data = append(data, '\n')
+
+	n, err := w.file.Write(data)
+	w.size += int64(n)
+	if err != nil {
+		return err
+	}
+	w.last = line.Time
+
+	if w.size >= MaxFileSize {
+		return w.rotate()
+	}
+	return nil
+}
+
+// rotate compresses the current file into the next numbered file.
+func (w *sessionWriter) rotate() error {
+	w.a.rotateMu.Lock()
+	defer w.a.rotateMu.Unlock()
+
+	if err := w.file.Close(); err != nil {
+		return err
+	}
+
+	current := filepath.Join(w.dir, currentFile)
+	if w.size > 0 {
+		name := filepath.Join(w.dir, fmt.Sprintf("%06d.log.gz", w.session.Files+1))
+		if err := compressFile(current, name); err != nil {
+			return err
+		}
+		w.session.Files++
+		if err := os.Remove(current); err != nil {
+			return err
+		}
+	}
+
+	last := w.last
+	if !last.IsZero() {
+		w.session.LastLineAt = &last
+	}
+	if err := w.saveMeta(); err != nil {
+		return err
+	}
+
+	file, err := os.OpenFile(current, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	w.file = file
+	w.size = 0
+	return nil
+}
+
+// finish compresses the rest of the session and marks it ended.
+func (w *sessionWriter) finish() error {
+	if err := w.rotate(); err != nil {
+		return err
+	}
+	w.file.Close()
+	os.Remove(filepath.Join(w.dir, currentFile))
+
+	now := time.Now()
+	w.session.EndedAt = &now
+	return w.saveMeta()
+}
+
+func (w *sessionWriter) close() {
+	last := w.last
+	if !last.IsZero() {
+		w.session.LastLineAt = &last
+	}
+	w.saveMeta()
+	w.file.Close()
+}
+
+func (w *sessionWriter) saveMeta() error {
+	data, err := json.MarshalIndent(w.session, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(w.dir, metaFile), data, 0644)
+}
+
+// prune deletes the oldest finished sessions of a server beyond
+// MaxSessions.
+func (a *Archiver) prune(serverID string) {
+	sessions, err := a.Sessions(serverID)
+	if err != nil || len(sessions) <= MaxSessions {
+		return
+	}
+
+	excess := len(sessions) - MaxSessions
+	for _, s := range sessions {
+		if excess == 0 {
+			break
+		}
+		if s.EndedAt == nil {
+			continue
+		}
+		if err := os.RemoveAll(filepath.Join(a.serverLogDir(serverID), s.ID)); err == nil {
+			excess--
+		}
+	}
+}
+
+// Sessions lists the archived sessions of a server, oldest first.
+func (a *Archiver) Sessions(serverID string) ([]Session, error) {
+	base := a.serverLogDir(serverID)
+	entries, err := os.ReadDir(base)
+	if os.IsNotExist(err) {
+		return []Session{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	sessions := []Session{}
+	for _, e := range entries {
+		if !e.IsDir() {
+			continue
+		}
+		dir := filepath.Join(base, e.Name())
+		var s Session
+		if err := readJSON(filepath.Join(dir, metaFile), &s); err != nil {
+			continue
+		}
+		s.Size = dirSize(dir)
+		sessions = append(sessions, s)
+	}
+
+	sort.Slice(sessions, func(i, j int) bool {
+		return sessions[i].StartedAt.Before(sessions[j].StartedAt)
+	})
+	return sessions, nil
+}
+
+func shortID(containerID string) string {
+	if len(containerID) > 12 {
+		return containerID[:12]
+	}
+	return containerID
+}
+
+func readJSON(path string, v any) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+func dirSize(dir string) int64 {
+	var size int64
+	entries, _ := os.ReadDir(dir)
+	for _, e := range entries {
+		if info, err := e.Info(); err == nil {
+			size += info.Size()
+		}
+	}
+	return size
+}
+
+// lastLineTime returns the time of the last complete line of a log file.
+func lastLineTime(path string) (time.Time, bool) {
+	f, err := os.Open(path)
+	if err != nil {
+		return time.Time{}, false
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil || info.Size() == 0 {
+		return time.Time{}, false
+	}
+
+	// Room for the longest line, even with every byte escaped
+	const window = 8 * MaxLineLength
+	offset := info.Size() - window
+	if offset < 0 {
+		offset = 0
+	}
+	data := make([]byte, info.Size()-offset)
+	if _, err := f.ReadAt(data, offset); err != nil && err != io.EOF {
+		return time.Time{}, false
+	}
+
+	lines := strings.Split(strings.TrimRight(string(data), "\n"), "\n")
+	for i := len(lines) - 1; i >= 0; i-- {
+		var line logstream.Line
+		if json.Unmarshal([]byte(lines[i]), &line) == nil {
+			return line.Time, true
+		}
+	}
+	return time.Time{}, false
+}
+
+func compressFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+
+	zw := gzip.NewWriter(out)
+	if _, err := io.Copy(zw, bufio.NewReader(in)); err != nil {
+		out.Close()
+		os.Remove(dst)
+		return err
+	}
+	if err := zw.Close(); err != nil {
+		out.Close()
+		os.Remove(dst)
+		return err
+	}
+	return out.Close()
+}
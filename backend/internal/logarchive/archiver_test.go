@@ -0,0 +1,311 @@
+package logarchive
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"realmops/internal/logstream"
+)
+
+var baseTime = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+func newTestArchiver(t *testing.T) *Archiver {
+	t.Helper()
+	return NewArchiver(nil, nil, t.TempDir())
+}
+
+// writeLines archives n lines numbered from first, each one second after
+// the previous one. pad makes every line's text that long.
+func writeLines(t *testing.T, w *sessionWriter, first, n, pad int) {
+	t.Helper()
+	for i := first; i < first+n; i++ {
+		text := fmt.Sprintf("line %06d ", i)
+		text += strings.Repeat("x", max(pad-len(text), 0))
+		line := logstream.Line{Stream: "stdout", Time: baseTime.Add(time.Duration(i) * time.Second), Text: text}
+		if err := w.write(line); err != nil {
+			t.Fatalf("write: %v", err)
+		}
+	}
+}
+
+// linesPerFile is how many lines of pad bytes fill a file.
+func linesPerFile(pad int) int {
+	return MaxFileSize/pad + 1
+}
+
+func TestRotation(t *testing.T) {
+	a := newTestArchiver(t)
+	w, err := a.open("srv", "container1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	const pad = 8 << 10
+	n := linesPerFile(pad) + 10
+	writeLines(t, w, 0, n, pad)
+	w.close()
+
+	if w.session.Files != 1 {
+		t.Errorf("files = %d, want 1", w.session.Files)
+	}
+	if _, err := os.Stat(filepath.Join(w.dir, "000001.log.gz")); err != nil {
+		t.Errorf("rotated file: %v", err)
+	}
+	info, err := os.Stat(filepath.Join(w.dir, currentFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Size() >= MaxFileSize {
+		t.Errorf("current.log is %d bytes after rotation", info.Size())
+	}
+
+	sessions, err := a.Sessions("srv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sessions) != 1 || sessions[0].Files != 1 || sessions[0].EndedAt != nil {
+		t.Errorf("sessions = %+v, want one open session with one rotated file", sessions)
+	}
+}
+
+func TestWriteCapsLineLength(t *testing.T) {
+	a := newTestArchiver(t)
+	w, err := a.open("srv", "container1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.close()
+
+	// A multi-byte rune straddles the cut
+	text := strings.Repeat("x", MaxLineLength-1) + "é" + strings.Repeat("y", MaxLineLength)
+	if err := w.write(logstream.Line{Stream: "stdout", Time: baseTime, Text: text}); err != nil {
+		t.Fatal(err)
+	}
+
+	res, err := a.Search("srv", Query{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res.Matches) != 1 {
+		t.Fatalf("matches = %d, want 1", len(res.Matches))
+	}
+	if got := res.Matches[0].Text; got != strings.Repeat("x", MaxLineLength-1) {
+		t.Errorf("archived %d bytes, want the first %d", len(got), MaxLineLength-1)
+	}
+}
+
+func TestResume(t *testing.T) {
+	partialLine := func(t *testing.T, dir string) {
+		f, err := os.OpenFile(filepath.Join(dir, currentFile), os.O_APPEND|os.O_WRONLY, 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer f.Close()
+		f.WriteString(`{"stream":"stdout","time":"2030-01-01T00:00:00Z","te`)
+	}
+
+	tests := []struct {
+		name string
+		// crash skips recording the last line in session.json
+		crash bool
+		// damage changes the session's files after the first run
+		damage   func(t *testing.T, dir string)
+		wantLast int
+	}{
+		{name: "clean shutdown", wantLast: 9},
+		{name: "crash", crash: true, wantLast: 9},
+		{name: "crash mid-line", crash: true, damage: partialLine, wantLast: 9},
+		{
+			name:  "crash and current.log lost",
+			crash: true,
+			damage: func(t *testing.T, dir string) {
+				os.Remove(filepath.Join(dir, currentFile))
+			},
+			// session.json has the last rotated line
+			wantLast: 4,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := newTestArchiver(t)
+			w, err := a.open("srv", "container1")
+			if err != nil {
+				t.Fatal(err)
+			}
+			writeLines(t, w, 0, 5, 0)
+			if err := w.rotate(); err != nil {
+				t.Fatal(err)
+			}
+			writeLines(t, w, 5, 5, 0)
+			if tt.crash {
+				w.file.Close()
+			} else {
+				w.close()
+			}
+			if tt.damage != nil {
+				tt.damage(t, w.dir)
+			}
+
+			resumed, err := a.open("srv", "container1")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer resumed.close()
+
+			if resumed.dir != w.dir {
+				t.Errorf("resumed %s, want %s", resumed.dir, w.dir)
+			}
+			if resumed.session.Files != 1 {
+				t.Errorf("files = %d, want 1", resumed.session.Files)
+			}
+			if want := baseTime.Add(time.Duration(tt.wantLast) * time.Second); !resumed.last.Equal(want) {
+				t.Errorf("last = %v, want %v", resumed.last, want)
+			}
+		})
+	}
+}
+
+func TestSearchPagination(t *testing.T) {
+	a := newTestArchiver(t)
+
+	// A finished session spanning rotated files, then a running one
+	const pad = 8 << 10
+	first := linesPerFile(pad)*2 + 7
+	w, err := a.open("srv", "aaaaaaaaaaaa")
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeLines(t, w, 0, first, pad)
+	if err := w.finish(); err != nil {
+		t.Fatal(err)
+	}
+
+	w, err = a.open("srv", "bbbbbbbbbbbb")
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeLines(t, w, first, 20, 0)
+	defer w.close()
+	total := first + 20
+
+	tests := []struct {
+		name  string
+		query Query
+		want  []int
+	}{
+		{name: "everything", query: Query{Limit: 97}, want: seq(0, total)},
+		{name: "pattern", query: Query{Limit: 3, Pattern: regexp.MustCompile(`line \d+0 `)}, want: every(10, total)},
+		{name: "time range", query: Query{Limit: 50, From: baseTime.Add(100 * time.Second), To: baseTime.Add(1999 * time.Second)}, want: seq(100, 2000)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []int
+			q := tt.query
+			for pages := 0; ; pages++ {
+				if pages > total {
+					t.Fatal("pagination does not end")
+				}
+				res, err := a.Search("srv", q)
+				if err != nil {
+					t.Fatalf("Search: %v", err)
+				}
+				if len(res.Matches) > q.Limit {
+					t.Fatalf("page has %d matches, limit %d", len(res.Matches), q.Limit)
+				}
+				for _, m := range res.Matches {
+					var n int
+					fmt.Sscanf(m.Text, "line %d", &n)
+					got = append(got, n)
+				}
+				if res.NextCursor == "" {
+					break
+				}
+				q.Cursor = res.NextCursor
+			}
+
+			if len(got) != len(tt.want) {
+				t.Fatalf("got %d lines, want %d", len(got), len(tt.want))
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Fatalf("line %d is %d, want %d", i, got[i], tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestSearchSkipsOverlongLines(t *testing.T) {
+	a := newTestArchiver(t)
+	w, err := a.open("srv", "container1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeLines(t, w, 0, 2, 0)
+	// Archived before lines were capped
+	if _, err := w.file.WriteString(`{"stream":"stdout","text":"` + strings.Repeat("x", maxScanLine) + "\"}\n"); err != nil {
+		t.Fatal(err)
+	}
+	writeLines(t, w, 2, 2, 0)
+	w.close()
+
+	res, err := a.Search("srv", Query{Limit: 2})
+	if err != nil {
+		t.Fatalf("Search: %v", err)
+	}
+	res, err = a.Search("srv", Query{Limit: 2, Cursor: res.NextCursor})
+	if err != nil {
+		t.Fatalf("Search after the long line: %v", err)
+	}
+	if len(res.Matches) != 2 || !strings.HasPrefix(res.Matches[0].Text, "line 000002") {
+		t.Errorf("matches = %+v, want lines 2 and 3", res.Matches)
+	}
+}
+
+func TestParseCursor(t *testing.T) {
+	tests := []struct {
+		cursor  string
+		wantErr bool
+	}{
+		{cursor: "1700000000-abc:1:10"},
+		{cursor: "1700000000-abc:0:10", wantErr: true},
+		{cursor: ":1:10", wantErr: true},
+		{cursor: "1700000000-abc:1", wantErr: true},
+		{cursor: "1700000000-abc:1:x", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.cursor, func(t *testing.T) {
+			p, err := parseCursor(tt.cursor)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && p.String() != tt.cursor {
+				t.Errorf("round trip = %q", p.String())
+			}
+		})
+	}
+}
+
+func seq(from, to int) []int {
+	var s []int
+	for i := from; i < to; i++ {
+		s = append(s, i)
+	}
+	return s
+}
+
+func every(step, to int) []int {
+	var s []int
+	for i := 0; i < to; i += step {
+		s = append(s, i)
+	}
+	return s
+}
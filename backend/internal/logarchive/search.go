@@ -0,0 +1,263 @@
+package logarchive
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"realmops/internal/logstream"
+)
+
+const (
+	DefaultSearchLimit = 100
+	MaxSearchLimit     = 1000
+
+	// maxScanLine is the longest file line a search reads; longer ones,
+	// from before lines were capped at MaxLineLength, are skipped.
+	maxScanLine = 1 << 20
+)
+
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// Query selects archived lines. Results are in the order they were written,
+// across sessions; pass a result's NextCursor as Cursor for the next page.
+type Query struct {
+	// Pattern is matched against the line text; nil matches every line
+	Pattern *regexp.Regexp
+	// From and To bound the line time; zero means unbounded
+	From   time.Time
+	To     time.Time
+	Stream string
+	Limit  int
+	Cursor string
+}
+
+type Match struct {
+	Session     string    `json:"session"`
+	ContainerID string    `json:"containerId"`
+	Stream      string    `json:"stream"`
+	Time        time.Time `json:"time"`
+	Text        string    `json:"text"`
+}
+
+type Result struct {
+	Matches    []Match `json:"matches"`
+	NextCursor string  `json:"nextCursor,omitempty"`
+}
+
+// position is where a line is in the archive: the session, the file (1 for
+// the first rotated file, Files+1 for current.log) and the line number in
+// that file. A position stays valid when current.log is rotated, as it
+// becomes file Files+1.
+type position struct {
+	session string
+	file    int
+	line    int
+}
+
+func (p position) String() string {
+	return fmt.Sprintf("%s:%d:%d", p.session, p.file, p.line)
+}
+
+func parseCursor(cursor string) (position, error) {
+	parts := strings.Split(cursor, ":")
+	if len(parts) != 3 || parts[0] == "" {
+		return position{}, ErrInvalidCursor
+	}
+	file, err1 := strconv.Atoi(parts[1])
+	line, err2 := strconv.Atoi(parts[2])
+	if err1 != nil || err2 != nil || file < 1 || line < 0 {
+		return position{}, ErrInvalidCursor
+	}
+	return position{session: parts[0], file: file, line: line}, nil
+}
+
+// Search finds archived lines of a server.
+func (a *Archiver) Search(serverID string, q Query) (*Result, error) {
+	if q.Limit <= 0 {
+		q.Limit = DefaultSearchLimit
+	}
+	if q.Limit > MaxSearchLimit {
+		q.Limit = MaxSearchLimit
+	}
+
+	var after *position
+	if q.Cursor != "" {
+		p, err := parseCursor(q.Cursor)
+		if err != nil {
+			return nil, err
+		}
+		after = &p
+	}
+
+	a.rotateMu.RLock()
+	defer a.rotateMu.RUnlock()
+
+	sessions, err := a.Sessions(serverID)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &Result{Matches: []Match{}}
+	for _, s := range sessions {
+		if after != nil && s.ID < after.session {
+			continue
+		}
+		if !q.From.IsZero() && s.EndedAt != nil && s.EndedAt.Before(q.From) {
+			continue
+		}
+
+		dir := filepath.Join(a.serverLogDir(serverID), s.ID)
+		for file := 1; file <= s.Files+1; file++ {
+			if after != nil && s.ID == after.session && file < after.file {
+				continue
+			}
+
+			skip := 0
+			if after != nil && s.ID == after.session && file == after.file {
+				skip = after.line
+			}
+
+			full, err := a.searchFile(dir, s, file, skip, q, result)
+			if err != nil {
+				return nil, err
+			}
+			if full {
+				return result, nil
+			}
+		}
+	}
+
+	return result, nil
+}
+
+// searchFile appends the matches in one file of a session after line skip.
+// It reports whether the result is full, in which case NextCursor is set.
+func (a *Archiver) searchFile(dir string, s Session, file, skip int, q Query, result *Result) (bool, error) {
+	r, err := openFile(dir, s, file)
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	defer r.Close()
+
+	br := bufio.NewReaderSize(r, 64*1024)
+
+	n := 0
+	for {
+		data, err := readLine(br, maxScanLine)
+		if err == io.EOF {
+			return false, nil
+		}
+		if err != nil {
+			return false, err
+		}
+		n++
+		if n <= skip || data == nil {
+			continue
+		}
+
+		var line logstream.Line
+		if err := json.Unmarshal(data, &line); err != nil {
+			// A line still being written
+			continue
+		}
+		if !q.From.IsZero() && line.Time.Before(q.From) {
+			continue
+		}
+		if !q.To.IsZero() && line.Time.After(q.To) {
+			continue
+		}
+		if q.Stream != "" && line.Stream != q.Stream {
+			continue
+		}
+		if q.Pattern != nil && !q.Pattern.MatchString(line.Text) {
+			continue
+		}
+
+		result.Matches = append(result.Matches, Match{
+			Session:     s.ID,
+			ContainerID: s.ContainerID,
+			Stream:      line.Stream,
+			Time:        line.Time,
+			Text:        line.Text,
+		})
+		if len(result.Matches) == q.Limit {
+			result.NextCursor = position{session: s.ID, file: file, line: n}.String()
+			return true, nil
+		}
+	}
+}
+
+// readLine reads the next line of r without its line break. A line longer
+// than max is consumed and returned as nil. io.EOF is only returned when
+// there is no line left.
+func readLine(r *bufio.Reader, max int) ([]byte, error) {
+	var line []byte
+	tooLong := false
+	for {
+		chunk, isPrefix, err := r.ReadLine()
+		if err != nil {
+			if err == io.EOF && (len(line) > 0 || tooLong) {
+				break
+			}
+			return nil, err
+		}
+		if !tooLong {
+			if len(line)+len(chunk) > max {
+				tooLong, line = true, nil
+			} else {
+				line = append(line, chunk...)
+			}
+		}
+		if !isPrefix {
+			break
+		}
+	}
+	if tooLong {
+		return nil, nil
+	}
+	if line == nil {
+		line = []byte{}
+	}
+	return line, nil
+}
+
+// openFile opens a rotated file of a session, or its current.log.
+func openFile(dir string, s Session, file int) (io.ReadCloser, error) {
+	if file > s.Files {
+		return os.Open(filepath.Join(dir, currentFile))
+	}
+
+	f, err := os.Open(filepath.Join(dir, fmt.Sprintf("%06d.log.gz", file)))
+	if err != nil {
+		return nil, err
+	}
+	zr, err := gzip.NewReader(f)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	return &gzipFile{Reader: zr, file: f}, nil
+}
+
+type gzipFile struct {
+	*gzip.Reader
+	file *os.File
+}
+
+func (g *gzipFile) Close() error {
+	g.Reader.Close()
+	return g.file.Close()
+}
@@ -0,0 +1,206 @@
+// Package logstream decodes container log streams into lines.
+package logstream
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"io"
+	"strings"
+	"time"
+
+	"realmops/internal/runtime"
+)
+
+const (
+	StreamStdout = "stdout"
+	StreamStderr = "stderr"
+)
+
+// Line is one line of container output.
+type Line struct {
+	Stream string    `json:"stream"`
+	Time   time.Time `json:"time"`
+	Text   string    `json:"text"`
+}
+
+// maxFrameSize bounds a single multiplexed frame; Docker splits log
+// messages at 16KiB, so anything far larger is a corrupt stream.
+const maxFrameSize = 1 << 20
+
+// Reader splits a container log stream into lines. Containers without a TTY
+// send Docker's multiplexed format, where every frame starts with an 8 byte
+// header naming the stream and the payload size; a frame may carry several
+// lines or part of one. TTY containers send raw bytes, all on stdout.
+type Reader struct {
+	src io.ReadCloser
+	br  *bufio.Reader
+	tty bool
+
+	// partial holds the unfinished line of each stream
+	partial map[string]*bytes.Buffer
+	queue   []Line
+	err     error
+}
+
+// NewReader reads the log stream of a container; tty is the container's TTY
+// flag, which decides the stream's format.
+func NewReader(src io.ReadCloser, tty bool) *Reader {
+	return &Reader{
+		src:     src,
+		br:      bufio.NewReaderSize(src, 32*1024),
+		tty:     tty,
+		partial: make(map[string]*bytes.Buffer),
+	}
+}
+
+// Open starts reading a container's logs.
+func Open(ctx context.Context, rt runtime.Runtime, containerID string, opts runtime.LogsOptions) (*Reader, error) {
+	info, err := rt.InspectContainer(ctx, containerID)
+	if err != nil {
+		return nil, err
+	}
+	logs, err := rt.GetContainerLogs(ctx, containerID, opts)
+	if err != nil {
+		return nil, err
+	}
+	return NewReader(logs, info.Tty), nil
+}
+
+// Next returns the next complete line. At the end of the stream any
+// unterminated line is returned before io.EOF.
+func (r *Reader) Next() (Line, error) {
+	for len(r.queue) == 0 {
+		if r.err != nil {
+			return Line{}, r.err
+		}
+		r.fill()
+	}
+
+	line := r.queue[0]
+	r.queue = r.queue[1:]
+	return line, nil
+}
+
+func (r *Reader) Close() error {
+	return r.src.Close()
+}
+
+func (r *Reader) fill() {
+	if r.tty {
+		text, err := r.br.ReadString('\n')
+		if text != "" {
+			r.queue = append(r.queue, parseLine(StreamStdout, text))
+		}
+		if err != nil {
+			r.err = err
+		}
+		return
+	}
+
+	var header [8]byte
+	if _, err := io.ReadFull(r.br, header[:]); err != nil {
+		r.flush()
+		r.err = eof(err)
+		return
+	}
+
+	stream := StreamStdout
+	if header[0] == 2 {
+		stream = StreamStderr
+	}
+	size := binary.BigEndian.Uint32(header[4:])
+	if size > maxFrameSize {
+		r.flush()
+		r.err = io.ErrUnexpectedEOF
+		return
+	}
+
+	payload := make([]byte, size)
+	if _, err := io.ReadFull(r.br, payload); err != nil {
+		r.flush()
+		r.err = eof(err)
+		return
+	}
+
+	buf := r.partial[stream]
+	if buf == nil {
+		buf = new(bytes.Buffer)
+		r.partial[stream] = buf
+	}
+	buf.Write(payload)
+
+	for {
+		i := bytes.IndexByte(buf.Bytes(), '\n')
+		if i < 0 {
+			break
+		}
+		text := string(buf.Next(i + 1))
+		r.queue = append(r.queue, parseLine(stream, text))
+	}
+}
+
+// flush emits the unterminated lines left at the end of the stream.
+func (r *Reader) flush() {
+	for _, stream := range []string{StreamStdout, StreamStderr} {
+		if buf := r.partial[stream]; buf != nil && buf.Len() > 0 {
+			r.queue = append(r.queue, parseLine(stream, buf.String()))
+			buf.Reset()
+		}
+	}
+}
+
+func eof(err error) error {
+	if err == io.ErrUnexpectedEOF {
+		return io.EOF
+	}
+	return err
+}
+
+// parseLine strips the line ending and the RFC 3339 timestamp Docker puts
+// in front of every line. Lines without one are stamped with the current
+// time.
+func parseLine(stream, text string) Line {
+	text = strings.TrimRight(text, "\r\n")
+	line := Line{Stream: stream, Time: time.Now(), Text: text}
+
+	if i := strings.IndexByte(text, ' '); i > 0 {
+		if t, err := time.Parse(time.RFC3339Nano, text[:i]); err == nil {
+			line.Time = t
+			line.Text = text[i+1:]
+		}
+	}
+	return line
+}
+
+// Follow calls fn for every line the container writes from now on, until
+// ctx is done or the stream ends, e.g. because the container stopped.
+func Follow(ctx context.Context, rt runtime.Runtime, containerID string, fn func(Line)) error {
+	r, err := Open(ctx, rt, containerID, runtime.LogsOptions{Tail: "0", Follow: true})
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			r.Close()
+		case <-done:
+		}
+	}()
+
+	for {
+		line, err := r.Next()
+		if err != nil {
+			if err == io.EOF || ctx.Err() != nil {
+				return nil
+			}
+			return err
+		}
+		fn(line)
+	}
+}
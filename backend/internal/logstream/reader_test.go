@@ -0,0 +1,106 @@
+package logstream
+
+import (
+	"bytes"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/docker/docker/pkg/stdcopy"
+)
+
+type frame struct {
+	stream stdcopy.StdType
+	data   string
+}
+
+func muxed(frames ...frame) []byte {
+	var buf bytes.Buffer
+	for _, f := range frames {
+		io.WriteString(stdcopy.NewStdWriter(&buf, f.stream), f.data)
+	}
+	return buf.Bytes()
+}
+
+func TestReader(t *testing.T) {
+	stamp := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	tests := []struct {
+		name  string
+		input []byte
+		tty   bool
+		want  []Line
+	}{
+		{
+			name: "multiplexed streams",
+			input: muxed(
+				frame{stdcopy.Stdout, "2026-01-02T03:04:05Z starting\n"},
+				frame{stdcopy.Stderr, "2026-01-02T03:04:05Z warning\n"},
+			),
+			want: []Line{
+				{Stream: StreamStdout, Time: stamp, Text: "starting"},
+				{Stream: StreamStderr, Time: stamp, Text: "warning"},
+			},
+		},
+		{
+			name: "line split across frames",
+			input: muxed(
+				frame{stdcopy.Stdout, "2026-01-02T03:04:05Z hel"},
+				frame{stdcopy.Stderr, "2026-01-02T03:04:05Z oops\n"},
+				frame{stdcopy.Stdout, "lo\nsecond\n"},
+			),
+			want: []Line{
+				{Stream: StreamStderr, Time: stamp, Text: "oops"},
+				{Stream: StreamStdout, Time: stamp, Text: "hello"},
+				{Stream: StreamStdout, Text: "second"},
+			},
+		},
+		{
+			name:  "unterminated last line",
+			input: muxed(frame{stdcopy.Stdout, "2026-01-02T03:04:05Z done"}),
+			want:  []Line{{Stream: StreamStdout, Time: stamp, Text: "done"}},
+		},
+		{
+			// A TTY stream is raw even when it starts like a frame header
+			name:  "tty",
+			input: []byte("\x01\x00\x00\x00 2026-01-02T03:04:05Z not a frame\r\n2026-01-02T03:04:05Z prompt> "),
+			tty:   true,
+			want: []Line{
+				{Stream: StreamStdout, Text: "\x01\x00\x00\x00 2026-01-02T03:04:05Z not a frame"},
+				{Stream: StreamStdout, Time: stamp, Text: "prompt> "},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := NewReader(io.NopCloser(bytes.NewReader(tt.input)), tt.tty)
+
+			var got []Line
+			for {
+				line, err := r.Next()
+				if err == io.EOF {
+					break
+				}
+				if err != nil {
+					t.Fatal(err)
+				}
+				got = append(got, line)
+			}
+
+			if len(got) != len(tt.want) {
+				t.Fatalf("got %d lines %+v, want %d", len(got), got, len(tt.want))
+			}
+			for i, want := range tt.want {
+				g := got[i]
+				if g.Stream != want.Stream || g.Text != want.Text {
+					t.Errorf("line %d = %s %q, want %s %q", i, g.Stream, g.Text, want.Stream, want.Text)
+				}
+				// Lines without a timestamp are stamped on arrival
+				if !want.Time.IsZero() && !g.Time.Equal(want.Time) {
+					t.Errorf("line %d time = %v, want %v", i, g.Time, want.Time)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,169 @@
+package logstream
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+const (
+	// ReconcileInterval is how often a Watcher looks for servers that
+	// started or stopped.
+	ReconcileInterval = 15 * time.Second
+	// RetryDelay is the pause before re-following a log stream that ended.
+	RetryDelay = 5 * time.Second
+)
+
+// ErrContainerStopped is the cause of a watch's context when its container
+// stopped or was replaced, as opposed to the Watcher shutting down.
+var ErrContainerStopped = errors.New("container stopped")
+
+// WatchFunc watches one server's container until ctx is done. Returning
+// earlier ends the watch, and a new one is started on the next reconcile.
+type WatchFunc func(ctx context.Context, serverID, containerID string)
+
+// Watcher runs a WatchFunc for the container of every running server. A
+// server's next watch only starts once its previous one has returned, so
+// the two never overlap, even when the same container is started again.
+type Watcher struct {
+	running func(ctx context.Context) (map[string]string, error)
+	fn      WatchFunc
+	wake    chan struct{}
+
+	mu      sync.Mutex
+	watches map[string]*watch
+	// ending holds the last canceled watch of each server until the next
+	// watch of the server starts
+	ending map[string]*watch
+}
+
+type watch struct {
+	containerID string
+	cancel      context.CancelCauseFunc
+	done        chan struct{}
+}
+
+// NewWatcher watches the containers listed by running, which maps server
+// IDs to container IDs.
+func NewWatcher(running func(ctx context.Context) (map[string]string, error), fn WatchFunc) *Watcher {
+	return &Watcher{
+		running: running,
+		fn:      fn,
+		wake:    make(chan struct{}, 1),
+		watches: make(map[string]*watch),
+		ending:  make(map[string]*watch),
+	}
+}
+
+// Run watches running servers until ctx is done.
+func (w *Watcher) Run(ctx context.Context) {
+	ticker := time.NewTicker(ReconcileInterval)
+	defer ticker.Stop()
+
+	for {
+		w.reconcile(ctx)
+
+		select {
+		case <-ctx.Done():
+			w.mu.Lock()
+			for id, wt := range w.watches {
+				wt.cancel(ctx.Err())
+				delete(w.watches, id)
+			}
+			w.mu.Unlock()
+			return
+		case <-ticker.C:
+		case <-w.wake:
+		}
+	}
+}
+
+// Restart ends a server's watch and starts a new one right away if the
+// server still runs, e.g. to pick up changed settings.
+func (w *Watcher) Restart(serverID string) {
+	w.mu.Lock()
+	if wt, ok := w.watches[serverID]; ok {
+		w.endLocked(serverID, wt, context.Canceled)
+	}
+	w.mu.Unlock()
+
+	select {
+	case w.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (w *Watcher) reconcile(ctx context.Context) {
+	running, err := w.running(ctx)
+	if err != nil {
+		slog.Error("failed to list running servers", "error", err)
+		return
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	for id, wt := range w.watches {
+		select {
+		case <-wt.done:
+			// Returned on its own; try again
+			w.endLocked(id, wt, nil)
+			continue
+		default:
+		}
+		if running[id] != wt.containerID {
+			w.endLocked(id, wt, ErrContainerStopped)
+		}
+	}
+	for id, wt := range w.ending {
+		select {
+		case <-wt.done:
+			delete(w.ending, id)
+		default:
+		}
+	}
+
+	for id, containerID := range running {
+		if _, ok := w.watches[id]; ok {
+			continue
+		}
+		wctx, cancel := context.WithCancelCause(ctx)
+		wt := &watch{containerID: containerID, cancel: cancel, done: make(chan struct{})}
+		w.watches[id] = wt
+
+		prev := w.ending[id]
+		delete(w.ending, id)
+
+		go func(id, containerID string) {
+			defer close(wt.done)
+			if prev != nil {
+				<-prev.done
+			}
+			w.fn(wctx, id, containerID)
+		}(id, containerID)
+	}
+}
+
+// endLocked cancels a watch and keeps it until the server's next watch
+// starts. The caller holds w.mu.
+func (w *Watcher) endLocked(serverID string, wt *watch, cause error) {
+	wt.cancel(cause)
+	delete(w.watches, serverID)
+	w.ending[serverID] = wt
+}
+
+// Repeat calls follow until ctx is done, pausing RetryDelay whenever it
+// returns before that, e.g. because the log stream ended.
+func Repeat(ctx context.Context, follow func(ctx context.Context)) {
+	for {
+		follow(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(RetryDelay):
+		}
+	}
+}
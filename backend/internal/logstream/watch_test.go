@@ -0,0 +1,120 @@
+package logstream
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+)
+
+// recorder is a WatchFunc that logs when watches start and end, and holds
+// each watch open for linger after it was canceled.
+type recorder struct {
+	linger time.Duration
+
+	mu     sync.Mutex
+	events []string
+}
+
+func (r *recorder) watch(ctx context.Context, serverID, containerID string) {
+	r.log("start " + containerID)
+	<-ctx.Done()
+	cause := "shutdown"
+	if context.Cause(ctx) == ErrContainerStopped {
+		cause = "stopped"
+	}
+	time.Sleep(r.linger)
+	r.log("end " + containerID + " " + cause)
+}
+
+func (r *recorder) log(event string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.events = append(r.events, event)
+}
+
+func (r *recorder) wait(t *testing.T, n int) []string {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		r.mu.Lock()
+		events := append([]string(nil), r.events...)
+		r.mu.Unlock()
+		if len(events) >= n || time.Now().After(deadline) {
+			return events
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestWatcher(t *testing.T) {
+	tests := []struct {
+		name string
+		// states are the running containers of server "s" on each reconcile
+		states []string
+		// restart calls Restart after the first reconcile
+		restart bool
+		want    []string
+	}{
+		{
+			name:   "stopped",
+			states: []string{"c1", ""},
+			want:   []string{"start c1", "end c1 stopped"},
+		},
+		{
+			name:   "replaced",
+			states: []string{"c1", "c2"},
+			want:   []string{"start c1", "end c1 stopped", "start c2"},
+		},
+		{
+			// The second watch must not start before the first has
+			// finished with the container
+			name:   "started again",
+			states: []string{"c1", "", "c1"},
+			want:   []string{"start c1", "end c1 stopped", "start c1"},
+		},
+		{
+			name:    "restarted",
+			states:  []string{"c1", "c1"},
+			restart: true,
+			want:    []string{"start c1", "end c1 shutdown", "start c1"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			var current string
+			r := &recorder{linger: 50 * time.Millisecond}
+			w := NewWatcher(func(context.Context) (map[string]string, error) {
+				if current == "" {
+					return map[string]string{}, nil
+				}
+				return map[string]string{"s": current}, nil
+			}, r.watch)
+
+			for i, state := range tt.states {
+				current = state
+				w.reconcile(ctx)
+				if i == 0 {
+					r.wait(t, 1)
+					if tt.restart {
+						w.Restart("s")
+					}
+				}
+			}
+
+			got := r.wait(t, len(tt.want))
+			if len(got) != len(tt.want) {
+				t.Fatalf("events = %q, want %q", got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Fatalf("events = %q, want %q", got, tt.want)
+				}
+			}
+		})
+	}
+}
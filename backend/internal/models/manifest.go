@@ -1,5 +1,14 @@
 package models
 
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+	"text/template"
+)
+
 type Manifest struct {
 	ID          string           `yaml:"id" json:"id"`
 	Name        string           `yaml:"name" json:"name"`
@@ -16,10 +25,211 @@ type Manifest struct {
 	Shutdown    ShutdownConfig   `yaml:"shutdown" json:"shutdown"`
 	Mods        ModsConfig       `yaml:"mods" json:"mods"`
 	RCON        RCONConfig       `yaml:"rcon" json:"rcon"`
+	Services    []ServiceConfig  `yaml:"services" json:"services"`
+	Console     ConsoleConfig    `yaml:"console" json:"console"`
+	Players     PlayersConfig    `yaml:"players" json:"players"`
+	Moderation  ModerationConfig `yaml:"moderation" json:"moderation"`
+	Triggers    []TriggerConfig  `yaml:"triggers" json:"triggers,omitempty"`
+}
+
+// Trigger actions.
+const (
+	TriggerRestart = "restart"
+	TriggerBackup  = "backup"
+	TriggerRCON    = "rcon"
+	TriggerWebhook = "webhook"
+)
+
+// TriggerConfig performs an action when a log line matches Pattern. The
+// action fires at most once per Cooldown seconds (default 60).
+type TriggerConfig struct {
+	Name     string `yaml:"name" json:"name"`
+	Pattern  string `yaml:"pattern" json:"pattern"`
+	Action   string `yaml:"action" json:"action"` // restart, backup, rcon, webhook
+	Cooldown int    `yaml:"cooldown" json:"cooldown,omitempty"`
+	// Command is the RCON command for the rcon action, a Go template over
+	// the pattern's named groups and .line
+	Command string `yaml:"command" json:"command,omitempty"`
+	// URL receives a JSON POST for the webhook action
+	URL string `yaml:"url" json:"url,omitempty"`
+}
+
+// Moderation actions packs can map to their game's syntax.
+const (
+	ModerationKick            = "kick"
+	ModerationBan             = "ban"
+	ModerationUnban           = "unban"
+	ModerationWhitelistAdd    = "whitelistAdd"
+	ModerationWhitelistRemove = "whitelistRemove"
+	ModerationOp              = "op"
+	ModerationDeop            = "deop"
+)
+
+// ModerationActions lists every moderation action in display order.
+var ModerationActions = []string{
+	ModerationKick,
+	ModerationBan,
+	ModerationUnban,
+	ModerationWhitelistAdd,
+	ModerationWhitelistRemove,
+	ModerationOp,
+	ModerationDeop,
+}
+
+// ModerationConfig maps generic moderation actions to the game.
+type ModerationConfig struct {
+	Kick            *ModerationAction `yaml:"kick" json:"kick,omitempty"`
+	Ban             *ModerationAction `yaml:"ban" json:"ban,omitempty"`
+	Unban           *ModerationAction `yaml:"unban" json:"unban,omitempty"`
+	WhitelistAdd    *ModerationAction `yaml:"whitelistAdd" json:"whitelistAdd,omitempty"`
+	WhitelistRemove *ModerationAction `yaml:"whitelistRemove" json:"whitelistRemove,omitempty"`
+	Op              *ModerationAction `yaml:"op" json:"op,omitempty"`
+	Deop            *ModerationAction `yaml:"deop" json:"deop,omitempty"`
+}
+
+// Action returns the mapping of a moderation action, or nil if the pack
+// does not support it.
+func (c ModerationConfig) Action(name string) *ModerationAction {
+	switch name {
+	case ModerationKick:
+		return c.Kick
+	case ModerationBan:
+		return c.Ban
+	case ModerationUnban:
+		return c.Unban
+	case ModerationWhitelistAdd:
+		return c.WhitelistAdd
+	case ModerationWhitelistRemove:
+		return c.WhitelistRemove
+	case ModerationOp:
+		return c.Op
+	case ModerationDeop:
+		return c.Deop
+	}
+	return nil
+}
+
+// ModerationAction performs an action with an RCON command while the
+// server runs, or by editing a file in the data directory, which works
+// while it is stopped. Commands are Go templates over .player and .reason.
+type ModerationAction struct {
+	Command string          `yaml:"command" json:"command,omitempty"`
+	File    *ModerationFile `yaml:"file" json:"file,omitempty"`
+}
+
+// ModerationFile is a list of players kept in a file. Ban, whitelistAdd and
+// op add the player to it; the other actions remove them.
+type ModerationFile struct {
+	// Path is relative to the server's data directory
+	Path string `yaml:"path" json:"path"`
+	// Format is lines (one player per line) or json (an array of objects)
+	Format string `yaml:"format" json:"format"`
+	// Field is the object key holding the player in json files
+	Field string `yaml:"field" json:"field,omitempty"`
+	// UUID sets the "uuid" key of new json entries: mojang looks the player
+	// up with Mojang's API, offline derives the UUID of offline-mode
+	// Minecraft servers
+	UUID string `yaml:"uuid" json:"uuid,omitempty"`
+	// Fields are added to new json entries, e.g. an op's permission level
+	Fields map[string]any `yaml:"fields" json:"fields,omitempty"`
+}
+
+// PlayersConfig tells the player tracker how to find out who is online.
+// Packs may poll a list command over RCON, match join and leave lines in the
+// logs, or both: log lines are noticed immediately and polling corrects
+// anything the logs missed.
+type PlayersConfig struct {
+	List *PlayerListConfig `yaml:"list" json:"list,omitempty"`
+	// Join and Leave match log lines. Both need a "name" or "id" named
+	// group, e.g. `(?P<name>\w+) joined the game`.
+	Join  string `yaml:"join" json:"join,omitempty"`
+	Leave string `yaml:"leave" json:"leave,omitempty"`
+}
+
+// PlayerListConfig polls the player list over RCON.
+type PlayerListConfig struct {
+	Command string `yaml:"command" json:"command"`
+	// Pattern is matched repeatedly against the response; every match is
+	// one player, named by its "name" and/or "id" group.
+	Pattern string `yaml:"pattern" json:"pattern"`
+	// Interval is the poll interval in seconds (default 30)
+	Interval int `yaml:"interval" json:"interval"`
+}
+
+// Enabled reports whether the pack declares any way to track players.
+func (p PlayersConfig) Enabled() bool {
+	return p.List != nil || p.Join != "" || p.Leave != ""
+}
+
+// ConsoleConfig selects how console commands reach the game server.
+type ConsoleConfig struct {
+	// Mode is rcon (default) or stdin. Stdin runs the container with an open
+	// stdin and a TTY and attaches the console to it. Both are set when the
+	// container is created, so existing servers need a reinstall after a
+	// pack switches to stdin.
+	Mode string `yaml:"mode" json:"mode"`
+	// Commands is a catalog of the game's admin commands the UI can offer
+	// as forms.
+	Commands []ConsoleCommand `yaml:"commands" json:"commands,omitempty"`
+}
+
+// ConsoleCommand is a console command rendered from a Go template over its
+// params, e.g. "kick {{.player}} {{.reason}}".
+type ConsoleCommand struct {
+	Name        string `yaml:"name" json:"name"`
+	Description string `yaml:"description" json:"description"`
+	Template    string `yaml:"template" json:"template"`
+	// Dangerous commands must be confirmed before they run
+	Dangerous bool           `yaml:"dangerous" json:"dangerous"`
+	Params    []CommandParam `yaml:"params" json:"params"`
+}
+
+type CommandParam struct {
+	Name        string `yaml:"name" json:"name"`
+	Label       string `yaml:"label" json:"label"`
+	Description string `yaml:"description" json:"description"`
+	// Type is string, number, boolean, select or player. Player params are
+	// strings the UI can complete with online player names.
+	Type     string   `yaml:"type" json:"type"`
+	Required bool     `yaml:"required" json:"required"`
+	Default  any      `yaml:"default" json:"default,omitempty"`
+	Options  []string `yaml:"options" json:"options,omitempty"` // for select type
+	Min      *int     `yaml:"min" json:"min,omitempty"`         // for number type
+	Max      *int     `yaml:"max" json:"max,omitempty"`         // for number type
+}
+
+// UsesStdin reports whether the console talks to the process's stdin.
+func (c ConsoleConfig) UsesStdin() bool {
+	return c.Mode == "stdin"
+}
+
+// ServiceConfig describes a sidecar container that runs next to the game
+// server, e.g. a web map or a database used by a mod.
+type ServiceConfig struct {
+	Name        string            `yaml:"name" json:"name"`
+	Description string            `yaml:"description" json:"description"`
+	Image       string            `yaml:"image" json:"image"`
+	Workdir     string            `yaml:"workdir" json:"workdir"`
+	User        string            `yaml:"user" json:"user"`
+	Env         map[string]string `yaml:"env" json:"env"` // values are rendered with server variables
+	Command     []string          `yaml:"command" json:"command"`
+	Entrypoint  []string          `yaml:"entrypoint" json:"entrypoint"`
+	Ports       []PortConfig      `yaml:"ports" json:"ports"`
+	Mounts      []ServiceMount    `yaml:"mounts" json:"mounts"`
+	StartOrder  string            `yaml:"startOrder" json:"startOrder"` // before, after (default)
+}
+
+// ServiceMount mounts a path of the server's data directory into a sidecar.
+type ServiceMount struct {
+	Source   string `yaml:"source" json:"source"` // relative to the data dir, empty for all of it
+	Target   string `yaml:"target" json:"target"`
+	ReadOnly bool   `yaml:"readOnly" json:"readOnly"`
 }
 
 type RCONConfig struct {
-	Enabled          bool   `yaml:"enabled" json:"enabled"`
+	Enabled bool `yaml:"enabled" json:"enabled"`
+	// Protocol is source (default) or webrcon for Rust's WebSocket RCON
+	Protocol         string `yaml:"protocol" json:"protocol,omitempty"`
 	PortName         string `yaml:"portName" json:"portName"`
 	PasswordVariable string `yaml:"passwordVariable" json:"passwordVariable"`
 }
@@ -30,6 +240,7 @@ type RuntimeConfig struct {
 	User       string            `yaml:"user" json:"user"`
 	Env        map[string]string `yaml:"env" json:"env"`
 	Entrypoint []string          `yaml:"entrypoint" json:"entrypoint"`
+	Shell      []string          `yaml:"shell" json:"shell"` // for the exec console, defaults to /bin/sh
 }
 
 type StorageConfig struct {
@@ -57,6 +268,41 @@ type InstallConfig struct {
 	Branch   string `yaml:"branch" json:"branch"`
 }
 
+// Validate checks that a trigger can be compiled and run.
+func (c TriggerConfig) Validate() error {
+	if strings.TrimSpace(c.Name) == "" {
+		return errors.New("name is required")
+	}
+	if c.Pattern == "" {
+		return errors.New("pattern is required")
+	}
+	if _, err := regexp.Compile(c.Pattern); err != nil {
+		return fmt.Errorf("pattern is not a valid regular expression: %w", err)
+	}
+	if c.Cooldown < 0 {
+		return errors.New("cooldown must not be negative")
+	}
+
+	switch c.Action {
+	case TriggerRestart, TriggerBackup:
+	case TriggerRCON:
+		if c.Command == "" {
+			return errors.New("command is required for the rcon action")
+		}
+		if _, err := template.New(c.Name).Parse(c.Command); err != nil {
+			return fmt.Errorf("command is invalid: %w", err)
+		}
+	case TriggerWebhook:
+		u, err := url.Parse(c.URL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return errors.New("url must be an http or https URL")
+		}
+	default:
+		return errors.New("action must be restart, backup, rcon, or webhook")
+	}
+	return nil
+}
+
 type ConfigRendering struct {
 	Templates []TemplateConfig `yaml:"templates" json:"templates"`
 	EnvVars   []EnvVarConfig   `yaml:"envVars" json:"envVars"`
@@ -79,6 +325,60 @@ type PortConfig struct {
 	Protocol      string `yaml:"protocol" json:"protocol"` // tcp, udp
 	HostPortMode  string `yaml:"hostPortMode" json:"hostPortMode"` // auto, user
 	Description   string `yaml:"description" json:"description"`
+	// OffsetFrom derives the host port from another port plus Offset
+	// (default 1), e.g. a query port that must be the game port + 1.
+	OffsetFrom string `yaml:"offsetFrom,omitempty" json:"offsetFrom,omitempty"`
+	Offset     int    `yaml:"offset,omitempty" json:"offset,omitempty"`
+	// SameAs uses the same host port number as another port, typically
+	// to expose one port over both TCP and UDP.
+	SameAs string `yaml:"sameAs,omitempty" json:"sameAs,omitempty"`
+}
+
+// Link returns the port this port's host port is derived from, and the
+// offset from it. Ports without a link return an empty name.
+func (p PortConfig) Link() (string, int) {
+	if p.SameAs != "" {
+		return p.SameAs, 0
+	}
+	if p.OffsetFrom != "" {
+		if p.Offset == 0 {
+			return p.OffsetFrom, 1
+		}
+		return p.OffsetFrom, p.Offset
+	}
+	return "", 0
+}
+
+// ResolvePortLinks follows the offsetFrom/sameAs links of a set of ports and
+// returns, for every port name, the unlinked port it derives from and the
+// total offset from that port.
+func ResolvePortLinks(ports []PortConfig) (root map[string]string, offset map[string]int, err error) {
+	byName := make(map[string]PortConfig, len(ports))
+	for _, p := range ports {
+		byName[p.Name] = p
+	}
+
+	root = make(map[string]string, len(ports))
+	offset = make(map[string]int, len(ports))
+	for _, p := range ports {
+		name, total := p.Name, 0
+		for steps := 0; ; steps++ {
+			if steps > len(ports) {
+				return nil, nil, fmt.Errorf("port %q has a circular offsetFrom/sameAs reference", p.Name)
+			}
+			link, off := byName[name].Link()
+			if link == "" {
+				break
+			}
+			if _, ok := byName[link]; !ok {
+				return nil, nil, fmt.Errorf("port %q references unknown port %q", name, link)
+			}
+			name, total = link, total+off
+		}
+		root[p.Name] = name
+		offset[p.Name] = total
+	}
+	return root, offset, nil
 }
 
 type StartConfig struct {
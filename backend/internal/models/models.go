@@ -22,16 +22,18 @@ const (
 	JobStatusRunning   JobStatus = "running"
 	JobStatusCompleted JobStatus = "completed"
 	JobStatusFailed    JobStatus = "failed"
+	JobStatusCanceled  JobStatus = "canceled"
 )
 
 type JobType string
 
 const (
-	JobTypeInstall  JobType = "install"
-	JobTypeUpdate   JobType = "update"
-	JobTypeBackup   JobType = "backup"
-	JobTypeRestore  JobType = "restore"
-	JobTypeModApply JobType = "mod_apply"
+	JobTypeInstall     JobType = "install"
+	JobTypeUpdate      JobType = "update"
+	JobTypeBackup      JobType = "backup"
+	JobTypeRestore     JobType = "restore"
+	JobTypeModApply    JobType = "mod_apply"
+	JobTypePortMigrate JobType = "port_migrate"
 )
 
 type GamePack struct {
@@ -44,29 +46,40 @@ type GamePack struct {
 }
 
 type Server struct {
-	ID                string            `json:"id"`
-	Name              string            `json:"name"`
-	PackID            string            `json:"packId"`
-	PackVersion       int               `json:"packVersion"`
-	Vars              map[string]any    `json:"vars"`
-	VarsJSON          string            `json:"-"`
-	State             ServerState       `json:"state"`
-	DesiredState      ServerState       `json:"desiredState"`
-	DockerContainerID string            `json:"dockerContainerId,omitempty"`
-	Ports             []ServerPort      `json:"ports"`
-	Stats             *ServerStats      `json:"stats,omitempty"`
-	CreatedAt         time.Time         `json:"createdAt"`
-	UpdatedAt         time.Time         `json:"updatedAt"`
+	ID                string          `json:"id"`
+	Name              string          `json:"name"`
+	PackID            string          `json:"packId"`
+	PackVersion       int             `json:"packVersion"`
+	Vars              map[string]any  `json:"vars"`
+	VarsJSON          string          `json:"-"`
+	State             ServerState     `json:"state"`
+	DesiredState      ServerState     `json:"desiredState"`
+	DockerContainerID string          `json:"dockerContainerId,omitempty"`
+	Ports             []ServerPort    `json:"ports"`
+	Services          []ServerService `json:"services,omitempty"`
+	Networks          []string        `json:"networks"`
+	NetworksJSON      string          `json:"-"`
+	Stats             *ServerStats    `json:"stats,omitempty"`
+	RCON              *RCONStatus     `json:"rcon,omitempty"`
+	CreatedAt         time.Time       `json:"createdAt"`
+	UpdatedAt         time.Time       `json:"updatedAt"`
 }
 
 type ServerPort struct {
 	ServerID      string `json:"serverId"`
+	Service       string `json:"service,omitempty"`
 	Name          string `json:"name"`
 	Protocol      string `json:"protocol"`
 	ContainerPort int    `json:"containerPort"`
 	HostPort      int    `json:"hostPort"`
 }
 
+// ServerService is a sidecar container belonging to a server.
+type ServerService struct {
+	Name        string `json:"name"`
+	ContainerID string `json:"containerId"`
+}
+
 type ServerStats struct {
 	CPUPercent    float64 `json:"cpuPercent"`
 	MemoryUsage   int64   `json:"memoryUsage"`
@@ -74,15 +87,36 @@ type ServerStats struct {
 	MemoryPercent float64 `json:"memoryPercent"`
 }
 
+type RCONState string
+
+const (
+	RCONStateConnecting   RCONState = "connecting"
+	RCONStateConnected    RCONState = "connected"
+	RCONStateReconnecting RCONState = "reconnecting"
+	RCONStateDisconnected RCONState = "disconnected"
+)
+
+// RCONStatus describes a server's pooled RCON connection.
+type RCONStatus struct {
+	State       RCONState  `json:"state"`
+	Protocol    string     `json:"protocol,omitempty"`
+	Users       int        `json:"users"`
+	ConnectedAt *time.Time `json:"connectedAt,omitempty"`
+	Reconnects  int        `json:"reconnects"`
+	LastError   string     `json:"lastError,omitempty"`
+}
+
 type Job struct {
-	ID        string    `json:"id"`
-	Type      JobType   `json:"type"`
-	ServerID  string    `json:"serverId,omitempty"`
-	Status    JobStatus `json:"status"`
-	Progress  float64   `json:"progress"`
-	Logs      string    `json:"logs"`
-	CreatedAt time.Time `json:"createdAt"`
-	UpdatedAt time.Time `json:"updatedAt"`
+	ID        string     `json:"id"`
+	Type      JobType    `json:"type"`
+	ServerID  string     `json:"serverId,omitempty"`
+	Status    JobStatus  `json:"status"`
+	Progress  float64    `json:"progress"`
+	Logs      string     `json:"logs"`
+	Attempts  int        `json:"attempts"`
+	NextRunAt *time.Time `json:"nextRunAt,omitempty"` // when a failed job is retried
+	CreatedAt time.Time  `json:"createdAt"`
+	UpdatedAt time.Time  `json:"updatedAt"`
 }
 
 type ModProfile struct {
@@ -0,0 +1,82 @@
+package moderation
+
+import (
+	"database/sql"
+	"time"
+
+	"realmops/internal/auth"
+)
+
+// Ban is an entry of a pack's ban list. ServerID is empty for bans that
+// apply to every server of the pack.
+type Ban struct {
+	ID        int64     `json:"id"`
+	PackID    string    `json:"packId"`
+	ServerID  string    `json:"serverId,omitempty"`
+	Player    string    `json:"player"`
+	Reason    string    `json:"reason,omitempty"`
+	CreatedBy string    `json:"createdBy,omitempty"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// Bans returns the bans of a pack. With a server ID, only the bans that
+// apply to that server are returned.
+func (s *Service) Bans(packID, serverID string) ([]Ban, error) {
+	query := `SELECT id, pack_id, server_id, player, reason, created_by, created_at FROM bans WHERE pack_id = ?`
+	args := []any{packID}
+	if serverID != "" {
+		query += ` AND (server_id = '' OR server_id = ?)`
+		args = append(args, serverID)
+	}
+	query += ` ORDER BY created_at DESC`
+
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	bans := []Ban{}
+	for rows.Next() {
+		var b Ban
+		var reason, createdBy sql.NullString
+		if err := rows.Scan(&b.ID, &b.PackID, &b.ServerID, &b.Player, &reason, &createdBy, &b.CreatedAt); err != nil {
+			return nil, err
+		}
+		b.Reason = reason.String
+		b.CreatedBy = createdBy.String
+		bans = append(bans, b)
+	}
+	return bans, rows.Err()
+}
+
+// addBan records a ban, replacing an earlier one of the player in the same
+// scope.
+func (s *Service) addBan(packID, serverID, player, reason string, user *auth.User) error {
+	createdBy := ""
+	if user != nil {
+		createdBy = user.Name
+	}
+
+	return s.db.WithTx(func(tx *sql.Tx) error {
+		if _, err := tx.Exec(`DELETE FROM bans WHERE pack_id = ? AND server_id = ? AND player = ? COLLATE NOCASE`, packID, serverID, player); err != nil {
+			return err
+		}
+		_, err := tx.Exec(`
+			INSERT INTO bans (pack_id, server_id, player, reason, created_by, created_at)
+			VALUES (?, ?, ?, ?, ?, ?)
+		`, packID, serverID, player, reason, createdBy, time.Now())
+		return err
+	})
+}
+
+// removeBan lifts a player's bans in a scope. Lifting a pack-wide ban also
+// lifts the player's server bans, since the unban went to every server.
+func (s *Service) removeBan(packID, serverID, player string) error {
+	if serverID == "" {
+		_, err := s.db.Exec(`DELETE FROM bans WHERE pack_id = ? AND player = ? COLLATE NOCASE`, packID, player)
+		return err
+	}
+	_, err := s.db.Exec(`DELETE FROM bans WHERE pack_id = ? AND server_id = ? AND player = ? COLLATE NOCASE`, packID, serverID, player)
+	return err
+}
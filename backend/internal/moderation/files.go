@@ -0,0 +1,123 @@
+package moderation
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"realmops/internal/models"
+)
+
+// editPlayerFile adds a player to, or removes them from, a player list file.
+// Players are compared case-insensitively; adding a listed player and
+// removing an unlisted one are no-ops.
+func editPlayerFile(ctx context.Context, dataDir string, f *models.ModerationFile, player string, add bool) error {
+	path := filepath.Join(dataDir, f.Path)
+	if !strings.HasPrefix(path, dataDir+string(filepath.Separator)) {
+		return errors.New("invalid moderation file path")
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to read %s: %w", f.Path, err)
+	}
+
+	var out []byte
+	if f.Format == "json" {
+		newEntry := func() (map[string]any, error) {
+			return jsonEntry(ctx, f, player)
+		}
+		if out, err = editJSON(data, f.Field, player, add, newEntry); err != nil {
+			return fmt.Errorf("failed to edit %s: %w", f.Path, err)
+		}
+	} else {
+		out = editLines(data, player, add)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(path, out, 0644)
+}
+
+func editLines(data []byte, player string, add bool) []byte {
+	var lines []string
+	found := false
+	for _, line := range strings.Split(string(data), "\n") {
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" {
+			continue
+		}
+		if strings.EqualFold(trimmed, player) {
+			found = true
+			if !add {
+				continue
+			}
+		}
+		lines = append(lines, line)
+	}
+	if add && !found {
+		lines = append(lines, player)
+	}
+
+	if len(lines) == 0 {
+		return nil
+	}
+	return []byte(strings.Join(lines, "\n") + "\n")
+}
+
+// jsonEntry builds the entry of a player added to a json file.
+func jsonEntry(ctx context.Context, f *models.ModerationFile, player string) (map[string]any, error) {
+	entry := make(map[string]any, len(f.Fields)+2)
+	for k, v := range f.Fields {
+		entry[k] = v
+	}
+	entry[f.Field] = player
+
+	if f.UUID != "" {
+		id, name, err := playerUUID(ctx, f.UUID, player)
+		if err != nil {
+			return nil, err
+		}
+		entry["uuid"] = id
+		entry[f.Field] = name
+	}
+	return entry, nil
+}
+
+// editJSON edits a json array of player objects. newEntry is only called
+// when a player is actually added.
+func editJSON(data []byte, field, player string, add bool, newEntry func() (map[string]any, error)) ([]byte, error) {
+	entries := []map[string]any{}
+	if len(strings.TrimSpace(string(data))) > 0 {
+		if err := json.Unmarshal(data, &entries); err != nil {
+			return nil, err
+		}
+	}
+
+	kept := entries[:0]
+	found := false
+	for _, entry := range entries {
+		name, _ := entry[field].(string)
+		if strings.EqualFold(name, player) {
+			found = true
+			if !add {
+				continue
+			}
+		}
+		kept = append(kept, entry)
+	}
+	if add && !found {
+		entry, err := newEntry()
+		if err != nil {
+			return nil, err
+		}
+		kept = append(kept, entry)
+	}
+
+	return json.MarshalIndent(kept, "", "  ")
+}
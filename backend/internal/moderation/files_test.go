@@ -0,0 +1,231 @@
+package moderation
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"realmops/internal/models"
+)
+
+func TestEditLines(t *testing.T) {
+	tests := []struct {
+		name   string
+		data   string
+		player string
+		add    bool
+		want   string
+	}{
+		{name: "add to empty file", data: "", player: "Steve", add: true, want: "Steve\n"},
+		{name: "add", data: "Alex\n", player: "Steve", add: true, want: "Alex\nSteve\n"},
+		{name: "add listed player", data: "Alex\nsteve\n", player: "Steve", add: true, want: "Alex\nsteve\n"},
+		{name: "remove", data: "Alex\nSteve\n", player: "steve", want: "Alex\n"},
+		{name: "remove unlisted player", data: "Alex\n", player: "Steve", want: "Alex\n"},
+		{name: "remove last player", data: "Steve\n", player: "Steve", want: ""},
+		{name: "blank lines dropped", data: "Alex\n\n  \nHerobrine", player: "Steve", add: true, want: "Alex\nHerobrine\nSteve\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := string(editLines([]byte(tt.data), tt.player, tt.add))
+			if got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEditJSON(t *testing.T) {
+	const listed = `[{"uuid": "a", "name": "Alex", "level": 4}, {"uuid": "s", "name": "Steve"}]`
+
+	tests := []struct {
+		name     string
+		data     string
+		player   string
+		add      bool
+		want     []map[string]any
+		wantNew  bool
+		entryErr error
+		wantErr  bool
+	}{
+		{
+			name:    "add to missing file",
+			player:  "Herobrine",
+			add:     true,
+			want:    []map[string]any{{"name": "Herobrine", "uuid": "new"}},
+			wantNew: true,
+		},
+		{
+			name:   "add keeps other entries",
+			data:   listed,
+			player: "Herobrine",
+			add:    true,
+			want: []map[string]any{
+				{"uuid": "a", "name": "Alex", "level": float64(4)},
+				{"uuid": "s", "name": "Steve"},
+				{"name": "Herobrine", "uuid": "new"},
+			},
+			wantNew: true,
+		},
+		{
+			name:   "add listed player",
+			data:   listed,
+			player: "steve",
+			add:    true,
+			want: []map[string]any{
+				{"uuid": "a", "name": "Alex", "level": float64(4)},
+				{"uuid": "s", "name": "Steve"},
+			},
+		},
+		{
+			name:   "remove",
+			data:   listed,
+			player: "ALEX",
+			want:   []map[string]any{{"uuid": "s", "name": "Steve"}},
+		},
+		{
+			name:   "remove unlisted player",
+			data:   listed,
+			player: "Herobrine",
+			want: []map[string]any{
+				{"uuid": "a", "name": "Alex", "level": float64(4)},
+				{"uuid": "s", "name": "Steve"},
+			},
+		},
+		{
+			name:     "entry fails",
+			data:     listed,
+			player:   "Herobrine",
+			add:      true,
+			entryErr: errors.New("no such account"),
+			wantErr:  true,
+		},
+		{
+			name:    "not an array",
+			data:    `{"name": "Steve"}`,
+			player:  "Steve",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			called := false
+			newEntry := func() (map[string]any, error) {
+				called = true
+				if tt.entryErr != nil {
+					return nil, tt.entryErr
+				}
+				return map[string]any{"name": tt.player, "uuid": "new"}, nil
+			}
+
+			out, err := editJSON([]byte(tt.data), "name", tt.player, tt.add, newEntry)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if called != tt.wantNew {
+				t.Errorf("newEntry called = %v, want %v", called, tt.wantNew)
+			}
+
+			var got []map[string]any
+			if err := json.Unmarshal(out, &got); err != nil {
+				t.Fatalf("output %q: %v", out, err)
+			}
+			if len(got) == 0 && len(tt.want) == 0 {
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestOfflineUUID(t *testing.T) {
+	if got, want := offlineUUID("Notch"), "b50ad385-829d-3141-a216-7e7d7539ba7f"; got != want {
+		t.Errorf("offlineUUID = %s, want %s", got, want)
+	}
+}
+
+func TestEditPlayerFileMojang(t *testing.T) {
+	var lookups atomic.Int32
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lookups.Add(1)
+		if !strings.EqualFold(filepath.Base(r.URL.Path), "notch") {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Write([]byte(`{"id":"069a79f444e94726a5befca90e38aaf5","name":"Notch"}`))
+	}))
+	defer api.Close()
+	defer func(u string) { mojangProfileURL = u }(mojangProfileURL)
+	mojangProfileURL = api.URL + "/"
+
+	f := &models.ModerationFile{
+		Path:   "ops.json",
+		Format: "json",
+		Field:  "name",
+		UUID:   "mojang",
+		Fields: map[string]any{"level": 4, "bypassesPlayerLimit": false},
+	}
+	dataDir := t.TempDir()
+	read := func() []map[string]any {
+		t.Helper()
+		var entries []map[string]any
+		data, err := os.ReadFile(filepath.Join(dataDir, f.Path))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := json.Unmarshal(data, &entries); err != nil {
+			t.Fatal(err)
+		}
+		return entries
+	}
+	ctx := context.Background()
+
+	if err := editPlayerFile(ctx, dataDir, f, "notch", true); err != nil {
+		t.Fatalf("add: %v", err)
+	}
+	want := []map[string]any{{
+		"uuid":                "069a79f4-44e9-4726-a5be-fca90e38aaf5",
+		"name":                "Notch",
+		"level":               float64(4),
+		"bypassesPlayerLimit": false,
+	}}
+	if got := read(); !reflect.DeepEqual(got, want) {
+		t.Errorf("entries = %v, want %v", got, want)
+	}
+
+	// Listed players are not looked up again
+	if err := editPlayerFile(ctx, dataDir, f, "Notch", true); err != nil {
+		t.Fatalf("add again: %v", err)
+	}
+	if n := lookups.Load(); n != 1 {
+		t.Errorf("lookups = %d, want 1", n)
+	}
+
+	if err := editPlayerFile(ctx, dataDir, f, "nobody", true); err == nil {
+		t.Error("unknown account was added")
+	}
+	if got := read(); !reflect.DeepEqual(got, want) {
+		t.Errorf("entries after a failed add = %v, want %v", got, want)
+	}
+
+	if err := editPlayerFile(ctx, dataDir, f, "NOTCH", false); err != nil {
+		t.Fatalf("remove: %v", err)
+	}
+	if got := read(); len(got) != 0 {
+		t.Errorf("entries after remove = %v, want none", got)
+	}
+}
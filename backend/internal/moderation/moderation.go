@@ -0,0 +1,237 @@
+// Package moderation performs player moderation actions using each pack's
+// mapping to its game's commands and files.
+package moderation
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"realmops/internal/auth"
+	"realmops/internal/console"
+	"realmops/internal/db"
+	"realmops/internal/models"
+	"realmops/internal/packs"
+	"realmops/internal/rcon"
+	"realmops/internal/server"
+)
+
+const (
+	MethodRCON = "rcon"
+	MethodFile = "file"
+)
+
+// params are the params of every action's command. They are checked like
+// those of console catalog commands.
+var params = []models.CommandParam{
+	{Name: "player", Type: "player", Required: true},
+	{Name: "reason", Type: "string"},
+}
+
+// Request is a moderation action against one player.
+type Request struct {
+	Action string `json:"action"`
+	Player string `json:"player"`
+	Reason string `json:"reason"`
+	// AllServers applies the action to every server of the same pack. Bans
+	// made this way also apply to the pack's future servers via ApplyBans.
+	AllServers bool `json:"allServers"`
+}
+
+// Result is the outcome of an action on one server.
+type Result struct {
+	ServerID   string `json:"serverId"`
+	ServerName string `json:"serverName"`
+	Method     string `json:"method,omitempty"`
+	Response   string `json:"response,omitempty"`
+	Error      string `json:"error,omitempty"`
+}
+
+type Service struct {
+	db            *db.DB
+	serverManager *server.Manager
+	packLoader    *packs.Loader
+	rconManager   *rcon.Manager
+	history       *console.History
+}
+
+func NewService(database *db.DB, serverManager *server.Manager, packLoader *packs.Loader, rconManager *rcon.Manager, history *console.History) *Service {
+	return &Service{
+		db:            database,
+		serverManager: serverManager,
+		packLoader:    packLoader,
+		rconManager:   rconManager,
+		history:       history,
+	}
+}
+
+// Supported lists the moderation actions a pack maps.
+func Supported(manifest *models.Manifest) []string {
+	actions := []string{}
+	for _, name := range models.ModerationActions {
+		if manifest.Moderation.Action(name) != nil {
+			actions = append(actions, name)
+		}
+	}
+	return actions
+}
+
+// Apply performs an action on a server, or on every server of its pack,
+// and keeps the ban list up to date. Failures on individual servers are
+// reported in their Result.
+func (s *Service) Apply(ctx context.Context, srv *models.Server, req Request, user *auth.User) ([]Result, error) {
+	req.Player = strings.TrimSpace(req.Player)
+	if req.Player == "" {
+		return nil, errors.New("player is required")
+	}
+	// Bans reach files and future servers too, so bad input is rejected
+	// before any of it is applied
+	if _, err := console.CheckParam(params[0], req.Player); err != nil {
+		return nil, err
+	}
+	if _, err := console.CheckParam(params[1], req.Reason); err != nil {
+		return nil, err
+	}
+
+	manifest, err := s.packLoader.LoadFromDir(s.packLoader.GetPackPath(srv.PackID))
+	if err != nil {
+		return nil, fmt.Errorf("failed to load pack manifest: %w", err)
+	}
+	if manifest.Moderation.Action(req.Action) == nil {
+		return nil, fmt.Errorf("pack %s does not support %s", srv.PackID, req.Action)
+	}
+
+	targets := []*models.Server{srv}
+	if req.AllServers {
+		if targets, err = s.packServers(ctx, srv.PackID); err != nil {
+			return nil, err
+		}
+	}
+
+	results := make([]Result, 0, len(targets))
+	for _, target := range targets {
+		results = append(results, s.applyOne(ctx, target, manifest, req, user))
+	}
+
+	scope := srv.ID
+	if req.AllServers {
+		scope = ""
+	}
+	switch req.Action {
+	case models.ModerationBan:
+		err = s.addBan(srv.PackID, scope, req.Player, req.Reason, user)
+	case models.ModerationUnban:
+		err = s.removeBan(srv.PackID, scope, req.Player)
+	}
+	if err != nil {
+		return results, fmt.Errorf("failed to update ban list: %w", err)
+	}
+
+	return results, nil
+}
+
+// ApplyBans bans every player on the pack's ban list from all of its
+// servers, e.g. after creating a new server.
+func (s *Service) ApplyBans(ctx context.Context, packID string, user *auth.User) ([]Result, error) {
+	manifest, err := s.packLoader.LoadFromDir(s.packLoader.GetPackPath(packID))
+	if err != nil {
+		return nil, fmt.Errorf("failed to load pack manifest: %w", err)
+	}
+	if manifest.Moderation.Ban == nil {
+		return nil, fmt.Errorf("pack %s does not support ban", packID)
+	}
+
+	bans, err := s.Bans(packID, "")
+	if err != nil {
+		return nil, err
+	}
+	servers, err := s.packServers(ctx, packID)
+	if err != nil {
+		return nil, err
+	}
+
+	results := []Result{}
+	for _, srv := range servers {
+		for _, ban := range bans {
+			if ban.ServerID != "" && ban.ServerID != srv.ID {
+				continue
+			}
+			req := Request{Action: models.ModerationBan, Player: ban.Player, Reason: ban.Reason}
+			results = append(results, s.applyOne(ctx, srv, manifest, req, user))
+		}
+	}
+	return results, nil
+}
+
+func (s *Service) packServers(ctx context.Context, packID string) ([]*models.Server, error) {
+	all, err := s.serverManager.ListServers(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var servers []*models.Server
+	for _, srv := range all {
+		if srv.PackID == packID {
+			servers = append(servers, srv)
+		}
+	}
+	return servers, nil
+}
+
+// applyOne uses the action's command while the server runs and its file
+// otherwise, or when there is no command.
+func (s *Service) applyOne(ctx context.Context, srv *models.Server, manifest *models.Manifest, req Request, user *auth.User) Result {
+	result := Result{ServerID: srv.ID, ServerName: srv.Name}
+	action := manifest.Moderation.Action(req.Action)
+
+	var err error
+	switch {
+	case action.Command != "" && srv.State == models.ServerStateRunning:
+		result.Method = MethodRCON
+		result.Response, err = s.runCommand(ctx, srv, manifest, action.Command, req, user)
+	case action.File != nil:
+		result.Method = MethodFile
+		dataDir := filepath.Join(s.serverManager.GetDataDir(), "servers", srv.ID, "data")
+		err = editPlayerFile(ctx, dataDir, action.File, req.Player, addsPlayer(req.Action))
+	default:
+		err = errors.New("server must be running")
+	}
+	if err != nil {
+		result.Error = err.Error()
+	}
+	return result
+}
+
+func (s *Service) runCommand(ctx context.Context, srv *models.Server, manifest *models.Manifest, tmpl string, req Request, user *auth.User) (string, error) {
+	cmd := &models.ConsoleCommand{Name: req.Action, Template: tmpl, Params: params}
+	command, err := console.Render(cmd, map[string]any{"player": req.Player, "reason": req.Reason})
+	if err != nil {
+		return "", fmt.Errorf("%s command: %w", req.Action, err)
+	}
+
+	target, err := rcon.TargetFor(manifest, srv)
+	if err != nil {
+		return "", err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, rcon.DefaultTimeout)
+	defer cancel()
+
+	start := time.Now()
+	response, err := s.rconManager.Run(ctx, srv.ID, target, command)
+
+	s.history.RecordCommand(srv.ID, console.SourceModeration, user, command, response, err, time.Since(start))
+
+	return response, err
+}
+
+// addsPlayer reports whether an action adds the player to its file.
+func addsPlayer(action string) bool {
+	switch action {
+	case models.ModerationBan, models.ModerationWhitelistAdd, models.ModerationOp:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,81 @@
+package moderation
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// mojangProfileURL looks up a Minecraft account by name.
+var mojangProfileURL = "https://api.mojang.com/users/profiles/minecraft/"
+
+const uuidLookupTimeout = 10 * time.Second
+
+// playerUUID returns the UUID of a Minecraft player and the name to store
+// with it, using source (mojang or offline) as described by
+// models.ModerationFile.UUID.
+func playerUUID(ctx context.Context, source, player string) (string, string, error) {
+	switch source {
+	case "offline":
+		return offlineUUID(player), player, nil
+	case "mojang":
+		return mojangUUID(ctx, player)
+	}
+	return "", "", fmt.Errorf("unknown uuid source %q", source)
+}
+
+// offlineUUID is the name-based (version 3) UUID of "OfflinePlayer:<name>",
+// which offline-mode servers give players.
+func offlineUUID(player string) string {
+	sum := md5.Sum([]byte("OfflinePlayer:" + player))
+	sum[6] = sum[6]&0x0f | 0x30
+	sum[8] = sum[8]&0x3f | 0x80
+	return formatUUID(hex.EncodeToString(sum[:]))
+}
+
+// mojangUUID looks up a player's account, returning its UUID and the name
+// as spelled by Mojang.
+func mojangUUID(ctx context.Context, player string) (string, string, error) {
+	ctx, cancel := context.WithTimeout(ctx, uuidLookupTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, mojangProfileURL+url.PathEscape(player), nil)
+	if err != nil {
+		return "", "", err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to look up player %s: %w", player, err)
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNoContent, http.StatusNotFound:
+		return "", "", fmt.Errorf("no Minecraft account named %s", player)
+	default:
+		return "", "", fmt.Errorf("failed to look up player %s: %s", player, resp.Status)
+	}
+
+	var profile struct {
+		ID   string `json:"id"`
+		Name string `json:"name"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&profile); err != nil {
+		return "", "", fmt.Errorf("failed to look up player %s: %w", player, err)
+	}
+	if len(profile.ID) != 32 {
+		return "", "", fmt.Errorf("failed to look up player %s: invalid id %q", player, profile.ID)
+	}
+	return formatUUID(profile.ID), profile.Name, nil
+}
+
+// formatUUID adds the dashes to 32 hex digits.
+func formatUUID(h string) string {
+	return h[0:8] + "-" + h[8:12] + "-" + h[12:16] + "-" + h[16:20] + "-" + h[20:32]
+}
@@ -0,0 +1,345 @@
+package notifications
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"realmops/internal/events"
+)
+
+// Channel types.
+const (
+	ChannelDiscord = "discord"
+	ChannelSlack   = "slack"
+	ChannelWebhook = "webhook"
+)
+
+var ErrNotFound = errors.New("not found")
+
+// Channel is where notifications are sent. Webhook channels sign their
+// requests with Secret; it is never returned by the API.
+type Channel struct {
+	ID        string    `json:"id"`
+	Name      string    `json:"name"`
+	Type      string    `json:"type"`
+	URL       string    `json:"url"`
+	Secret    string    `json:"-"`
+	HasSecret bool      `json:"hasSecret"`
+	Enabled   bool      `json:"enabled"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+type ChannelRequest struct {
+	Name string `json:"name"`
+	Type string `json:"type"`
+	URL  string `json:"url"`
+	// Secret replaces the signing secret when set; an empty string keeps
+	// the current one
+	Secret  *string `json:"secret"`
+	Enabled *bool   `json:"enabled"`
+}
+
+// Rule subscribes a channel to events, of one server or of all servers if
+// ServerID is empty. Events lists event types; a type ending in "." matches
+// every type with that prefix, e.g. "job.".
+type Rule struct {
+	ID        string    `json:"id"`
+	ChannelID string    `json:"channelId"`
+	ServerID  string    `json:"serverId,omitempty"`
+	Events    []string  `json:"events"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+type RuleRequest struct {
+	ChannelID string   `json:"channelId"`
+	ServerID  string   `json:"serverId"`
+	Events    []string `json:"events"`
+}
+
+// EventTypes are the events rules can subscribe to.
+var EventTypes = []string{
+	events.ServerState,
+	events.ServerHealth,
+	events.ServerCrashed,
+	events.JobCreated,
+	events.JobStarted,
+	events.JobProgress,
+	events.JobCompleted,
+	events.JobFailed,
+	events.JobRetrying,
+	events.JobCanceled,
+	events.BackupCompleted,
+	events.SFTPSessionStarted,
+	events.SFTPSessionEnded,
+}
+
+func (r Rule) filter() events.Filter {
+	f := events.Filter{Types: r.Events}
+	if r.ServerID != "" {
+		f.ServerIDs = []string{r.ServerID}
+	}
+	return f
+}
+
+func validateChannel(req ChannelRequest) error {
+	if strings.TrimSpace(req.Name) == "" {
+		return errors.New("name is required")
+	}
+	switch req.Type {
+	case ChannelDiscord, ChannelSlack, ChannelWebhook:
+	default:
+		return errors.New("type must be discord, slack, or webhook")
+	}
+	u, err := url.Parse(req.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return errors.New("url must be an http or https URL")
+	}
+	if req.Secret != nil && *req.Secret != "" && req.Type != ChannelWebhook {
+		return errors.New("only webhook channels are signed")
+	}
+	return nil
+}
+
+func validateRule(req RuleRequest) error {
+	if req.ChannelID == "" {
+		return errors.New("channelId is required")
+	}
+	if len(req.Events) == 0 {
+		return errors.New("events is required")
+	}
+	for _, e := range req.Events {
+		if !knownEventType(e) {
+			return fmt.Errorf("unknown event type %q", e)
+		}
+	}
+	return nil
+}
+
+func knownEventType(t string) bool {
+	for _, known := range EventTypes {
+		if t == known || (strings.HasSuffix(t, ".") && strings.HasPrefix(known, t)) {
+			return true
+		}
+	}
+	return false
+}
+
+const channelColumns = `id, name, type, url, secret, enabled, created_at`
+
+func scanChannel(row interface{ Scan(...any) error }) (*Channel, error) {
+	var c Channel
+	var secret sql.NullString
+	if err := row.Scan(&c.ID, &c.Name, &c.Type, &c.URL, &secret, &c.Enabled, &c.CreatedAt); err != nil {
+		return nil, err
+	}
+	c.Secret = secret.String
+	c.HasSecret = c.Secret != ""
+	return &c, nil
+}
+
+func (s *Service) Channels() ([]*Channel, error) {
+	rows, err := s.db.Query(`SELECT ` + channelColumns + ` FROM notification_channels ORDER BY created_at`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	channels := []*Channel{}
+	for rows.Next() {
+		c, err := scanChannel(rows)
+		if err != nil {
+			return nil, err
+		}
+		channels = append(channels, c)
+	}
+	return channels, rows.Err()
+}
+
+func (s *Service) Channel(id string) (*Channel, error) {
+	c, err := scanChannel(s.db.QueryRow(`SELECT `+channelColumns+` FROM notification_channels WHERE id = ?`, id))
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	return c, err
+}
+
+func (s *Service) CreateChannel(req ChannelRequest) (*Channel, error) {
+	if err := validateChannel(req); err != nil {
+		return nil, err
+	}
+
+	c := &Channel{
+		ID:        fmt.Sprintf("chan_%d", time.Now().UnixNano()),
+		Name:      req.Name,
+		Type:      req.Type,
+		URL:       req.URL,
+		Enabled:   req.Enabled == nil || *req.Enabled,
+		CreatedAt: time.Now(),
+	}
+	if req.Secret != nil {
+		c.Secret = *req.Secret
+	}
+	c.HasSecret = c.Secret != ""
+
+	_, err := s.db.Exec(`
+		INSERT INTO notification_channels (id, name, type, url, secret, enabled, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
+	`, c.ID, c.Name, c.Type, c.URL, c.Secret, c.Enabled, c.CreatedAt)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create channel: %w", err)
+	}
+	return c, nil
+}
+
+func (s *Service) UpdateChannel(id string, req ChannelRequest) (*Channel, error) {
+	c, err := s.Channel(id)
+	if err != nil {
+		return nil, err
+	}
+	if err := validateChannel(req); err != nil {
+		return nil, err
+	}
+
+	c.Name = req.Name
+	c.Type = req.Type
+	c.URL = req.URL
+	if req.Secret != nil && *req.Secret != "" {
+		c.Secret = *req.Secret
+	}
+	if c.Type != ChannelWebhook {
+		c.Secret = ""
+	}
+	c.HasSecret = c.Secret != ""
+	if req.Enabled != nil {
+		c.Enabled = *req.Enabled
+	}
+
+	_, err = s.db.Exec(`
+		UPDATE notification_channels SET name = ?, type = ?, url = ?, secret = ?, enabled = ?
+		WHERE id = ?
+	`, c.Name, c.Type, c.URL, c.Secret, c.Enabled, id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to update channel: %w", err)
+	}
+	return c, nil
+}
+
+// DeleteChannel removes a channel with its rules. Its deliveries are kept.
+func (s *Service) DeleteChannel(id string) error {
+	return s.db.WithTx(func(tx *sql.Tx) error {
+		result, err := tx.Exec(`DELETE FROM notification_channels WHERE id = ?`, id)
+		if err != nil {
+			return err
+		}
+		if n, _ := result.RowsAffected(); n == 0 {
+			return ErrNotFound
+		}
+		_, err = tx.Exec(`DELETE FROM notification_rules WHERE channel_id = ?`, id)
+		return err
+	})
+}
+
+func scanRule(row interface{ Scan(...any) error }) (*Rule, error) {
+	var r Rule
+	var eventsJSON string
+	if err := row.Scan(&r.ID, &r.ChannelID, &r.ServerID, &eventsJSON, &r.CreatedAt); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal([]byte(eventsJSON), &r.Events); err != nil {
+		return nil, err
+	}
+	return &r, nil
+}
+
+// Rules lists the rules of a channel, or all rules if channelID is empty.
+func (s *Service) Rules(channelID string) ([]*Rule, error) {
+	query := `SELECT id, channel_id, server_id, events_json, created_at FROM notification_rules`
+	var args []any
+	if channelID != "" {
+		query += ` WHERE channel_id = ?`
+		args = append(args, channelID)
+	}
+	query += ` ORDER BY created_at`
+
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	rules := []*Rule{}
+	for rows.Next() {
+		r, err := scanRule(rows)
+		if err != nil {
+			return nil, err
+		}
+		rules = append(rules, r)
+	}
+	return rules, rows.Err()
+}
+
+func (s *Service) CreateRule(req RuleRequest) (*Rule, error) {
+	if err := validateRule(req); err != nil {
+		return nil, err
+	}
+	if _, err := s.Channel(req.ChannelID); err != nil {
+		return nil, fmt.Errorf("channel %s: %w", req.ChannelID, err)
+	}
+
+	r := &Rule{
+		ID:        fmt.Sprintf("rule_%d", time.Now().UnixNano()),
+		ChannelID: req.ChannelID,
+		ServerID:  req.ServerID,
+		Events:    req.Events,
+		CreatedAt: time.Now(),
+	}
+	eventsJSON, _ := json.Marshal(r.Events)
+
+	_, err := s.db.Exec(`
+		INSERT INTO notification_rules (id, channel_id, server_id, events_json, created_at)
+		VALUES (?, ?, ?, ?, ?)
+	`, r.ID, r.ChannelID, r.ServerID, string(eventsJSON), r.CreatedAt)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create rule: %w", err)
+	}
+	return r, nil
+}
+
+func (s *Service) UpdateRule(id string, req RuleRequest) (*Rule, error) {
+	if err := validateRule(req); err != nil {
+		return nil, err
+	}
+	if _, err := s.Channel(req.ChannelID); err != nil {
+		return nil, fmt.Errorf("channel %s: %w", req.ChannelID, err)
+	}
+
+	eventsJSON, _ := json.Marshal(req.Events)
+	result, err := s.db.Exec(`
+		UPDATE notification_rules SET channel_id = ?, server_id = ?, events_json = ?
+		WHERE id = ?
+	`, req.ChannelID, req.ServerID, string(eventsJSON), id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to update rule: %w", err)
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return nil, ErrNotFound
+	}
+
+	return scanRule(s.db.QueryRow(`SELECT id, channel_id, server_id, events_json, created_at FROM notification_rules WHERE id = ?`, id))
+}
+
+func (s *Service) DeleteRule(id string) error {
+	result, err := s.db.Exec(`DELETE FROM notification_rules WHERE id = ?`, id)
+	if err != nil {
+		return err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
@@ -0,0 +1,164 @@
+package notifications
+
+import (
+	"database/sql"
+	"time"
+)
+
+// Delivery states.
+const (
+	DeliveryPending   = "pending"
+	DeliveryDelivered = "delivered"
+	DeliveryFailed    = "failed"
+)
+
+const (
+	DefaultDeliveryLimit = 50
+	MaxDeliveryLimit     = 500
+)
+
+// Delivery is one notification sent, or being sent, to a channel.
+type Delivery struct {
+	ID           int64      `json:"id"`
+	ChannelID    string     `json:"channelId"`
+	EventID      int64      `json:"eventId"`
+	EventType    string     `json:"eventType"`
+	ServerID     string     `json:"serverId,omitempty"`
+	Status       string     `json:"status"`
+	Attempts     int        `json:"attempts"`
+	ResponseCode int        `json:"responseCode,omitempty"`
+	Error        string     `json:"error,omitempty"`
+	CreatedAt    time.Time  `json:"createdAt"`
+	UpdatedAt    time.Time  `json:"updatedAt"`
+	DeliveredAt  *time.Time `json:"deliveredAt,omitempty"`
+
+	payload     []byte
+	nextAttempt time.Time
+}
+
+type DeliveryQuery struct {
+	ChannelID string
+	ServerID  string
+	Status    string
+	Limit     int
+	// Before pages back from a delivery ID
+	Before int64
+}
+
+const deliveryColumns = `id, channel_id, event_id, event_type, server_id, status, attempts,
+	response_code, error, payload, next_attempt_at, created_at, updated_at, delivered_at`
+
+func scanDelivery(row interface{ Scan(...any) error }) (*Delivery, error) {
+	var d Delivery
+	var serverID, errMsg sql.NullString
+	var nextAttempt, deliveredAt sql.NullTime
+	err := row.Scan(&d.ID, &d.ChannelID, &d.EventID, &d.EventType, &serverID, &d.Status, &d.Attempts,
+		&d.ResponseCode, &errMsg, &d.payload, &nextAttempt, &d.CreatedAt, &d.UpdatedAt, &deliveredAt)
+	if err != nil {
+		return nil, err
+	}
+	d.ServerID = serverID.String
+	d.Error = errMsg.String
+	if nextAttempt.Valid {
+		d.nextAttempt = nextAttempt.Time
+	}
+	if deliveredAt.Valid {
+		d.DeliveredAt = &deliveredAt.Time
+	}
+	return &d, nil
+}
+
+// Deliveries lists deliveries, newest first.
+func (s *Service) Deliveries(q DeliveryQuery) ([]*Delivery, error) {
+	if q.Limit <= 0 {
+		q.Limit = DefaultDeliveryLimit
+	}
+	if q.Limit > MaxDeliveryLimit {
+		q.Limit = MaxDeliveryLimit
+	}
+
+	query := `SELECT ` + deliveryColumns + ` FROM notification_deliveries WHERE 1 = 1`
+	var args []any
+	if q.ChannelID != "" {
+		query += ` AND channel_id = ?`
+		args = append(args, q.ChannelID)
+	}
+	if q.ServerID != "" {
+		query += ` AND server_id = ?`
+		args = append(args, q.ServerID)
+	}
+	if q.Status != "" {
+		query += ` AND status = ?`
+		args = append(args, q.Status)
+	}
+	if q.Before > 0 {
+		query += ` AND id < ?`
+		args = append(args, q.Before)
+	}
+	query += ` ORDER BY id DESC LIMIT ?`
+	args = append(args, q.Limit)
+
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	deliveries := []*Delivery{}
+	for rows.Next() {
+		d, err := scanDelivery(rows)
+		if err != nil {
+			return nil, err
+		}
+		deliveries = append(deliveries, d)
+	}
+	return deliveries, rows.Err()
+}
+
+func (s *Service) pendingDeliveries() ([]*Delivery, error) {
+	rows, err := s.db.Query(`SELECT `+deliveryColumns+` FROM notification_deliveries WHERE status = ? ORDER BY id`, DeliveryPending)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var deliveries []*Delivery
+	for rows.Next() {
+		d, err := scanDelivery(rows)
+		if err != nil {
+			return nil, err
+		}
+		deliveries = append(deliveries, d)
+	}
+	return deliveries, rows.Err()
+}
+
+func (s *Service) insertDelivery(d *Delivery) error {
+	now := time.Now()
+	d.Status = DeliveryPending
+	d.CreatedAt = now
+	d.UpdatedAt = now
+
+	result, err := s.db.Exec(`
+		INSERT INTO notification_deliveries (channel_id, event_id, event_type, server_id, status, attempts, response_code, payload, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, 0, 0, ?, ?, ?)
+	`, d.ChannelID, d.EventID, d.EventType, d.ServerID, d.Status, d.payload, now, now)
+	if err != nil {
+		return err
+	}
+	d.ID, err = result.LastInsertId()
+	return err
+}
+
+func (s *Service) saveDelivery(d *Delivery) {
+	d.UpdatedAt = time.Now()
+	var nextAttempt any
+	if !d.nextAttempt.IsZero() {
+		nextAttempt = d.nextAttempt
+	}
+	s.db.Exec(`
+		UPDATE notification_deliveries
+		SET status = ?, attempts = ?, response_code = ?, error = ?, next_attempt_at = ?, updated_at = ?, delivered_at = ?
+		WHERE id = ?
+	`, d.Status, d.Attempts, d.ResponseCode, d.Error, nextAttempt, d.UpdatedAt, d.DeliveredAt, d.ID)
+}
@@ -0,0 +1,95 @@
+package notifications
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"realmops/internal/events"
+)
+
+// WebhookPayload is the body posted to generic webhook channels.
+type WebhookPayload struct {
+	Event      events.Event `json:"event"`
+	ServerName string       `json:"serverName,omitempty"`
+	Message    string       `json:"message"`
+}
+
+// render builds the request body of an event for a channel.
+func (s *Service) render(ctx context.Context, channel *Channel, e events.Event) ([]byte, error) {
+	name := s.serverName(ctx, e.ServerID)
+
+	// Server names are set in bold, which Discord and Slack mark up
+	// differently
+	switch channel.Type {
+	case ChannelDiscord:
+		return json.Marshal(map[string]any{"username": "RealmOps", "content": message(e, bold(name, "**"))})
+	case ChannelSlack:
+		return json.Marshal(map[string]any{"text": message(e, bold(name, "*"))})
+	default:
+		return json.Marshal(WebhookPayload{Event: e, ServerName: name, Message: message(e, name)})
+	}
+}
+
+func bold(text, mark string) string {
+	if text == "" {
+		return ""
+	}
+	return mark + text + mark
+}
+
+func (s *Service) serverName(ctx context.Context, serverID string) string {
+	if serverID == "" {
+		return ""
+	}
+	srv, err := s.serverManager.GetServer(ctx, serverID)
+	if err != nil {
+		// The server may be gone by now
+		return serverID
+	}
+	return srv.Name
+}
+
+// message describes an event in a sentence for chat channels.
+func message(e events.Event, server string) string {
+	data, _ := e.Data.(map[string]any)
+	field := func(key string) any {
+		return data[key]
+	}
+
+	switch e.Type {
+	case TestEvent:
+		return "Test notification from RealmOps."
+	case events.ServerCrashed:
+		return fmt.Sprintf("Server %s crashed (exit code %v).", server, field("exitCode"))
+	case events.ServerState:
+		return fmt.Sprintf("Server %s is now %v.", server, field("state"))
+	case events.ServerHealth:
+		if healthy, _ := field("healthy").(bool); healthy {
+			return fmt.Sprintf("Server %s is healthy again.", server)
+		}
+		return fmt.Sprintf("Server %s is unhealthy.", server)
+	case events.JobFailed:
+		return fmt.Sprintf("%v job on %s failed: %v", field("type"), server, field("error"))
+	case events.JobRetrying:
+		return fmt.Sprintf("%v job on %s failed and will be retried: %v", field("type"), server, field("error"))
+	case events.JobCanceled:
+		return fmt.Sprintf("%v job on %s was canceled.", field("type"), server)
+	case events.JobCompleted:
+		return fmt.Sprintf("%v job on %s completed.", field("type"), server)
+	case events.JobStarted:
+		return fmt.Sprintf("%v job on %s started.", field("type"), server)
+	case events.JobCreated:
+		return fmt.Sprintf("%v job on %s queued.", field("type"), server)
+	case events.JobProgress:
+		return fmt.Sprintf("%v job on %s is at %v%%.", field("type"), server, field("progress"))
+	case events.BackupCompleted:
+		return fmt.Sprintf("Backup of %s completed.", server)
+	case events.SFTPSessionStarted:
+		return fmt.Sprintf("SFTP session from %v opened on %s.", field("remoteAddr"), server)
+	case events.SFTPSessionEnded:
+		return fmt.Sprintf("SFTP session from %v on %s closed.", field("remoteAddr"), server)
+	default:
+		return fmt.Sprintf("%s on %s.", e.Type, server)
+	}
+}
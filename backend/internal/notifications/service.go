@@ -0,0 +1,294 @@
+// Package notifications sends server and job events to Discord, Slack and
+// generic webhooks, as subscribed to by per-channel rules.
+package notifications
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"realmops/internal/db"
+	"realmops/internal/events"
+	"realmops/internal/server"
+)
+
+const (
+	// MaxAttempts is how often a delivery is tried before it fails.
+	MaxAttempts    = 5
+	maxRetryDelay  = 5 * time.Minute
+	requestTimeout = 10 * time.Second
+	// deliveryRetention is how long the delivery log is kept.
+	deliveryRetention = 30 * 24 * time.Hour
+
+	// TestEvent is the event type of test notifications.
+	TestEvent = "test"
+)
+
+// Webhook request headers. The signature is the hex encoded HMAC-SHA256 of
+// "<timestamp>.<body>" keyed with the channel secret.
+const (
+	HeaderEvent     = "X-RealmOps-Event"
+	HeaderDelivery  = "X-RealmOps-Delivery"
+	HeaderTimestamp = "X-RealmOps-Timestamp"
+	HeaderSignature = "X-RealmOps-Signature"
+)
+
+// retryBaseDelay doubles with every attempt, up to maxRetryDelay.
+var retryBaseDelay = 5 * time.Second
+
+type Service struct {
+	db            *db.DB
+	bus           *events.Bus
+	serverManager *server.Manager
+	client        *http.Client
+}
+
+func NewService(database *db.DB, bus *events.Bus, serverManager *server.Manager) *Service {
+	return &Service{
+		db:            database,
+		bus:           bus,
+		serverManager: serverManager,
+		client:        &http.Client{Timeout: requestTimeout},
+	}
+}
+
+// Start sends notifications for events until ctx is done. Deliveries still
+// pending from a previous run are resumed.
+func (s *Service) Start(ctx context.Context) {
+	s.db.Exec(`DELETE FROM notification_deliveries WHERE created_at < ?`, time.Now().Add(-deliveryRetention))
+
+	pending, err := s.pendingDeliveries()
+	if err != nil {
+		slog.Error("failed to load pending notifications", "error", err)
+	}
+	for _, d := range pending {
+		go s.deliver(ctx, d)
+	}
+
+	var cursor int64
+	for {
+		// After falling behind, pick up where we left off from the bus buffer
+		sub, backlog, complete := s.bus.Subscribe(events.Filter{}, cursor)
+		if !complete {
+			slog.Warn("notifications fell behind the event stream; some events were skipped")
+		}
+		for _, e := range backlog {
+			s.dispatch(ctx, e)
+			cursor = e.ID
+		}
+
+	stream:
+		for {
+			select {
+			case <-ctx.Done():
+				sub.Cancel()
+				return
+			case e, ok := <-sub.C:
+				if !ok {
+					break stream
+				}
+				s.dispatch(ctx, e)
+				cursor = e.ID
+			}
+		}
+	}
+}
+
+// dispatch queues a delivery of an event to every enabled channel with a
+// matching rule.
+func (s *Service) dispatch(ctx context.Context, e events.Event) {
+	rules, err := s.Rules("")
+	if err != nil {
+		slog.Error("failed to load notification rules", "error", err)
+		return
+	}
+
+	queued := make(map[string]bool)
+	for _, rule := range rules {
+		if queued[rule.ChannelID] || !rule.filter().Match(e) {
+			continue
+		}
+		channel, err := s.Channel(rule.ChannelID)
+		if err != nil || !channel.Enabled {
+			continue
+		}
+		queued[channel.ID] = true
+
+		d, err := s.queue(ctx, channel, e)
+		if err != nil {
+			slog.Error("failed to queue notification", "channelId", channel.ID, "event", e.Type, "error", err)
+			continue
+		}
+		go s.deliver(ctx, d)
+	}
+}
+
+func (s *Service) queue(ctx context.Context, channel *Channel, e events.Event) (*Delivery, error) {
+	payload, err := s.render(ctx, channel, e)
+	if err != nil {
+		return nil, err
+	}
+
+	d := &Delivery{
+		ChannelID: channel.ID,
+		EventID:   e.ID,
+		EventType: e.Type,
+		ServerID:  e.ServerID,
+		payload:   payload,
+	}
+	if err := s.insertDelivery(d); err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+// deliver sends a delivery until it succeeds, fails permanently or runs
+// out of attempts.
+func (s *Service) deliver(ctx context.Context, d *Delivery) {
+	if wait := time.Until(d.nextAttempt); wait > 0 {
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(wait):
+		}
+	}
+
+	for {
+		channel, err := s.Channel(d.ChannelID)
+		if err != nil {
+			d.Status = DeliveryFailed
+			d.Error = "channel was deleted"
+			d.nextAttempt = time.Time{}
+			s.saveDelivery(d)
+			return
+		}
+
+		retryAfter, retry := s.attempt(ctx, channel, d)
+		if d.Status != DeliveryPending || !retry {
+			return
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(retryAfter):
+		}
+	}
+}
+
+// attempt sends a delivery once and records the outcome. It returns how
+// long to wait before trying again, and whether to.
+func (s *Service) attempt(ctx context.Context, channel *Channel, d *Delivery) (time.Duration, bool) {
+	d.Attempts++
+	code, retryAfter, err := s.send(ctx, channel, d)
+	d.ResponseCode = code
+	d.nextAttempt = time.Time{}
+
+	if err == nil {
+		now := time.Now()
+		d.Status = DeliveryDelivered
+		d.Error = ""
+		d.DeliveredAt = &now
+		s.saveDelivery(d)
+		return 0, false
+	}
+
+	d.Error = err.Error()
+	retryable := code == 0 || code == http.StatusTooManyRequests || code >= 500
+	if !retryable || d.Attempts >= MaxAttempts || ctx.Err() != nil {
+		if ctx.Err() == nil {
+			d.Status = DeliveryFailed
+		}
+		s.saveDelivery(d)
+		return 0, false
+	}
+
+	if retryAfter <= 0 {
+		retryAfter = retryBaseDelay << (d.Attempts - 1)
+		if retryAfter > maxRetryDelay {
+			retryAfter = maxRetryDelay
+		}
+	}
+	d.nextAttempt = time.Now().Add(retryAfter)
+	s.saveDelivery(d)
+	return retryAfter, true
+}
+
+// send posts a delivery's payload. It returns the response status, if there
+// was a response, and the delay the receiver asked for in Retry-After.
+func (s *Service) send(ctx context.Context, channel *Channel, d *Delivery) (int, time.Duration, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, channel.URL, bytes.NewReader(d.payload))
+	if err != nil {
+		return 0, 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	if channel.Type == ChannelWebhook {
+		timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+		req.Header.Set(HeaderEvent, d.EventType)
+		req.Header.Set(HeaderDelivery, strconv.FormatInt(d.ID, 10))
+		req.Header.Set(HeaderTimestamp, timestamp)
+		if channel.Secret != "" {
+			req.Header.Set(HeaderSignature, "sha256="+Sign(channel.Secret, timestamp, d.payload))
+		}
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64*1024))
+
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return resp.StatusCode, 0, nil
+	}
+
+	var retryAfter time.Duration
+	if secs, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil && secs > 0 {
+		retryAfter = time.Duration(secs) * time.Second
+		if retryAfter > maxRetryDelay {
+			retryAfter = maxRetryDelay
+		}
+	}
+	return resp.StatusCode, retryAfter, fmt.Errorf("receiver returned %s", resp.Status)
+}
+
+// Sign computes the signature of a webhook request.
+func Sign(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// Test sends a test notification to a channel once, without retrying, and
+// returns the recorded delivery.
+func (s *Service) Test(ctx context.Context, channelID string) (*Delivery, error) {
+	channel, err := s.Channel(channelID)
+	if err != nil {
+		return nil, err
+	}
+
+	e := events.Event{Type: TestEvent, Time: time.Now()}
+	d, err := s.queue(ctx, channel, e)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, retry := s.attempt(ctx, channel, d); retry {
+		d.Status = DeliveryFailed
+		d.nextAttempt = time.Time{}
+		s.saveDelivery(d)
+	}
+	return d, nil
+}
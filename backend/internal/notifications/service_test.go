@@ -0,0 +1,289 @@
+package notifications
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"realmops/internal/db"
+	"realmops/internal/events"
+)
+
+func newTestService(t *testing.T) *Service {
+	t.Helper()
+	database, err := db.New(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { database.Close() })
+	if err := database.Migrate(); err != nil {
+		t.Fatal(err)
+	}
+	return NewService(database, events.NewBus(0), nil)
+}
+
+// receiver answers requests with the given responses in turn, repeating
+// the last one, and records what it received.
+type receiver struct {
+	*httptest.Server
+
+	mu        sync.Mutex
+	responses []response
+	requests  []receivedRequest
+}
+
+type response struct {
+	code       int
+	retryAfter string
+}
+
+type receivedRequest struct {
+	header http.Header
+	body   []byte
+	at     time.Time
+}
+
+func newReceiver(t *testing.T, responses ...response) *receiver {
+	t.Helper()
+	rcv := &receiver{responses: responses}
+	rcv.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+
+		rcv.mu.Lock()
+		rcv.requests = append(rcv.requests, receivedRequest{header: r.Header.Clone(), body: body, at: time.Now()})
+		resp := rcv.responses[0]
+		if len(rcv.responses) > 1 {
+			rcv.responses = rcv.responses[1:]
+		}
+		rcv.mu.Unlock()
+
+		if resp.retryAfter != "" {
+			w.Header().Set("Retry-After", resp.retryAfter)
+		}
+		w.WriteHeader(resp.code)
+	}))
+	t.Cleanup(rcv.Close)
+	return rcv
+}
+
+func (rcv *receiver) received() []receivedRequest {
+	rcv.mu.Lock()
+	defer rcv.mu.Unlock()
+	return append([]receivedRequest(nil), rcv.requests...)
+}
+
+func createChannel(t *testing.T, s *Service, channelType, url, secret string) *Channel {
+	t.Helper()
+	req := ChannelRequest{Name: "test", Type: channelType, URL: url}
+	if secret != "" {
+		req.Secret = &secret
+	}
+	channel, err := s.CreateChannel(req)
+	if err != nil {
+		t.Fatalf("CreateChannel: %v", err)
+	}
+	return channel
+}
+
+func TestDeliver(t *testing.T) {
+	defer func(d time.Duration) { retryBaseDelay = d }(retryBaseDelay)
+	retryBaseDelay = 10 * time.Millisecond
+
+	tests := []struct {
+		name         string
+		responses    []response
+		wantStatus   string
+		wantAttempts int
+		wantCode     int
+		// wantWait is the least time between the first and last request
+		wantWait time.Duration
+	}{
+		{
+			name:         "delivered",
+			responses:    []response{{code: 204}},
+			wantStatus:   DeliveryDelivered,
+			wantAttempts: 1,
+			wantCode:     204,
+		},
+		{
+			name:         "server errors are retried",
+			responses:    []response{{code: 500}, {code: 503}, {code: 200}},
+			wantStatus:   DeliveryDelivered,
+			wantAttempts: 3,
+			wantCode:     200,
+		},
+		{
+			name:         "rate limit is retried after Retry-After",
+			responses:    []response{{code: 429, retryAfter: "1"}, {code: 200}},
+			wantStatus:   DeliveryDelivered,
+			wantAttempts: 2,
+			wantCode:     200,
+			wantWait:     time.Second,
+		},
+		{
+			name:         "client errors are not retried",
+			responses:    []response{{code: 400}},
+			wantStatus:   DeliveryFailed,
+			wantAttempts: 1,
+			wantCode:     400,
+		},
+		{
+			name:         "gives up after MaxAttempts",
+			responses:    []response{{code: 502}},
+			wantStatus:   DeliveryFailed,
+			wantAttempts: MaxAttempts,
+			wantCode:     502,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestService(t)
+			rcv := newReceiver(t, tt.responses...)
+			channel := createChannel(t, s, ChannelWebhook, rcv.URL, "")
+
+			ctx := context.Background()
+			d, err := s.queue(ctx, channel, events.Event{ID: 1, Type: events.JobFailed, Time: time.Now()})
+			if err != nil {
+				t.Fatalf("queue: %v", err)
+			}
+			s.deliver(ctx, d)
+
+			received := rcv.received()
+			if len(received) != tt.wantAttempts {
+				t.Fatalf("requests = %d, want %d", len(received), tt.wantAttempts)
+			}
+			if wait := received[len(received)-1].at.Sub(received[0].at); wait < tt.wantWait {
+				t.Errorf("retried after %v, want at least %v", wait, tt.wantWait)
+			}
+
+			logged, err := s.Deliveries(DeliveryQuery{ChannelID: channel.ID})
+			if err != nil {
+				t.Fatalf("Deliveries: %v", err)
+			}
+			if len(logged) != 1 {
+				t.Fatalf("logged %d deliveries, want 1", len(logged))
+			}
+			got := logged[0]
+			if got.Status != tt.wantStatus || got.Attempts != tt.wantAttempts || got.ResponseCode != tt.wantCode {
+				t.Errorf("delivery = %s after %d attempts (code %d), want %s after %d (code %d)",
+					got.Status, got.Attempts, got.ResponseCode, tt.wantStatus, tt.wantAttempts, tt.wantCode)
+			}
+			if (got.DeliveredAt != nil) != (tt.wantStatus == DeliveryDelivered) {
+				t.Errorf("deliveredAt = %v", got.DeliveredAt)
+			}
+		})
+	}
+}
+
+func TestWebhookSignature(t *testing.T) {
+	tests := []struct {
+		name   string
+		secret string
+	}{
+		{name: "signed", secret: "s3cret"},
+		{name: "unsigned"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestService(t)
+			rcv := newReceiver(t, response{code: 200})
+			channel := createChannel(t, s, ChannelWebhook, rcv.URL, tt.secret)
+
+			d, err := s.Test(context.Background(), channel.ID)
+			if err != nil {
+				t.Fatalf("Test: %v", err)
+			}
+
+			req := rcv.received()[0]
+			if got := req.header.Get(HeaderEvent); got != TestEvent {
+				t.Errorf("%s = %q, want %q", HeaderEvent, got, TestEvent)
+			}
+			if got := req.header.Get(HeaderDelivery); got != strconv.FormatInt(d.ID, 10) {
+				t.Errorf("%s = %q, want %d", HeaderDelivery, got, d.ID)
+			}
+
+			timestamp := req.header.Get(HeaderTimestamp)
+			if _, err := strconv.ParseInt(timestamp, 10, 64); err != nil {
+				t.Errorf("%s = %q, want a Unix time", HeaderTimestamp, timestamp)
+			}
+
+			signature := req.header.Get(HeaderSignature)
+			if tt.secret == "" {
+				if signature != "" {
+					t.Errorf("%s = %q, want none", HeaderSignature, signature)
+				}
+				return
+			}
+			mac := hmac.New(sha256.New, []byte(tt.secret))
+			mac.Write([]byte(timestamp + "." + string(req.body)))
+			want := "sha256=" + hex.EncodeToString(mac.Sum(nil))
+			if signature != want {
+				t.Errorf("%s = %q, want %q", HeaderSignature, signature, want)
+			}
+			if got := Sign(tt.secret, timestamp, req.body); "sha256="+got != want {
+				t.Errorf("Sign = %q, want %q", got, want)
+			}
+		})
+	}
+}
+
+func TestPayloads(t *testing.T) {
+	tests := []struct {
+		channelType string
+		want        map[string]any
+	}{
+		{
+			channelType: ChannelDiscord,
+			want:        map[string]any{"username": "RealmOps", "content": "Test notification from RealmOps."},
+		},
+		{
+			channelType: ChannelSlack,
+			want:        map[string]any{"text": "Test notification from RealmOps."},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.channelType, func(t *testing.T) {
+			s := newTestService(t)
+			rcv := newReceiver(t, response{code: 200})
+			channel := createChannel(t, s, tt.channelType, rcv.URL, "")
+
+			if _, err := s.Test(context.Background(), channel.ID); err != nil {
+				t.Fatalf("Test: %v", err)
+			}
+
+			req := rcv.received()[0]
+			if got := req.header.Get("Content-Type"); got != "application/json" {
+				t.Errorf("Content-Type = %q", got)
+			}
+			if got := req.header.Get(HeaderSignature); got != "" {
+				t.Errorf("%s = %q, want none", HeaderSignature, got)
+			}
+
+			var got map[string]any
+			if err := json.Unmarshal(req.body, &got); err != nil {
+				t.Fatalf("body %q: %v", req.body, err)
+			}
+			if len(got) != len(tt.want) {
+				t.Errorf("body = %v, want %v", got, tt.want)
+			}
+			for key, want := range tt.want {
+				if got[key] != want {
+					t.Errorf("%s = %v, want %v", key, got[key], want)
+				}
+			}
+		})
+	}
+}
@@ -8,9 +8,12 @@ import (
 	"io"
 	"os"
 	"path/filepath"
+	"regexp"
 	"strings"
+	"text/template"
 
 	"gopkg.in/yaml.v3"
+	"realmops/internal/console"
 	"realmops/internal/models"
 )
 
@@ -245,18 +248,44 @@ func (l *Loader) Validate(m *models.Manifest) error {
 		errs = append(errs, "at least one port must be defined")
 	}
 
+	portNames := make(map[string]bool)
 	for i, port := range m.Ports {
-		if port.Name == "" {
-			errs = append(errs, fmt.Sprintf("ports[%d].name is required", i))
+		errs = append(errs, validatePort(fmt.Sprintf("ports[%d]", i), port, portNames)...)
+	}
+
+	serviceNames := make(map[string]bool)
+	for i, svc := range m.Services {
+		prefix := fmt.Sprintf("services[%d]", i)
+		if !serviceNamePattern.MatchString(svc.Name) {
+			errs = append(errs, prefix+".name must be lowercase letters, digits and '-'")
+		} else if svc.Name == "game" {
+			errs = append(errs, prefix+".name \"game\" is reserved for the main container")
+		} else if serviceNames[svc.Name] {
+			errs = append(errs, fmt.Sprintf("%s.name %q is used more than once", prefix, svc.Name))
 		}
-		if port.ContainerPort <= 0 || port.ContainerPort > 65535 {
-			errs = append(errs, fmt.Sprintf("ports[%d].containerPort must be 1-65535", i))
+		serviceNames[svc.Name] = true
+
+		if svc.Image == "" {
+			errs = append(errs, prefix+".image is required")
+		}
+		if svc.StartOrder != "" && svc.StartOrder != "before" && svc.StartOrder != "after" {
+			errs = append(errs, prefix+".startOrder must be before or after")
+		}
+		for j, port := range svc.Ports {
+			errs = append(errs, validatePort(fmt.Sprintf("%s.ports[%d]", prefix, j), port, portNames)...)
 		}
-		if port.Protocol != "tcp" && port.Protocol != "udp" {
-			errs = append(errs, fmt.Sprintf("ports[%d].protocol must be tcp or udp", i))
+		for j, mnt := range svc.Mounts {
+			if !strings.HasPrefix(mnt.Target, "/") {
+				errs = append(errs, fmt.Sprintf("%s.mounts[%d].target must be an absolute path", prefix, j))
+			}
+			if filepath.IsAbs(mnt.Source) || strings.Contains(mnt.Source, "..") {
+				errs = append(errs, fmt.Sprintf("%s.mounts[%d].source must be relative to the data directory", prefix, j))
+			}
 		}
 	}
 
+	errs = append(errs, validatePortLinks(m)...)
+
 	for i, v := range m.Variables {
 		if v.Name == "" {
 			errs = append(errs, fmt.Sprintf("variables[%d].name is required", i))
@@ -285,6 +314,27 @@ func (l *Loader) Validate(m *models.Manifest) error {
 		errs = append(errs, "install.appId is required for steamcmd method")
 	}
 
+	if m.Console.Mode != "" && m.Console.Mode != "rcon" && m.Console.Mode != "stdin" {
+		errs = append(errs, "console.mode must be rcon or stdin")
+	}
+	if m.RCON.Protocol != "" && m.RCON.Protocol != "source" && m.RCON.Protocol != "webrcon" {
+		errs = append(errs, "rcon.protocol must be source or webrcon")
+	}
+	errs = append(errs, validateConsoleCommands(m)...)
+	errs = append(errs, validatePlayers(m)...)
+	errs = append(errs, validateModeration(m)...)
+
+	triggerNames := make(map[string]bool)
+	for i, t := range m.Triggers {
+		if err := t.Validate(); err != nil {
+			errs = append(errs, fmt.Sprintf("triggers[%d]: %v", i, err))
+		}
+		if triggerNames[t.Name] {
+			errs = append(errs, fmt.Sprintf("triggers[%d]: duplicate trigger name %q", i, t.Name))
+		}
+		triggerNames[t.Name] = true
+	}
+
 	for i, target := range m.Mods.Targets {
 		if target.Name == "" {
 			errs = append(errs, fmt.Sprintf("mods.targets[%d].name is required", i))
@@ -305,6 +355,205 @@ func (l *Loader) Validate(m *models.Manifest) error {
 	return nil
 }
 
+var serviceNamePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9-]{0,31}$`)
+
+// validatePort checks a port definition. Port names must be unique across the
+// main container and all services since they share the server's port table.
+func validatePort(prefix string, port models.PortConfig, seen map[string]bool) []string {
+	var errs []string
+	if port.Name == "" {
+		errs = append(errs, prefix+".name is required")
+	} else if seen[port.Name] {
+		errs = append(errs, fmt.Sprintf("%s.name %q is used more than once", prefix, port.Name))
+	}
+	seen[port.Name] = true
+	if port.ContainerPort <= 0 || port.ContainerPort > 65535 {
+		errs = append(errs, prefix+".containerPort must be 1-65535")
+	}
+	if port.Protocol != "tcp" && port.Protocol != "udp" {
+		errs = append(errs, prefix+".protocol must be tcp or udp")
+	}
+	return errs
+}
+
+// validateConsoleCommands checks that every console command has a unique name
+// and a parseable template, and that its params are well formed.
+func validateConsoleCommands(m *models.Manifest) []string {
+	var errs []string
+	names := make(map[string]bool)
+
+	for i, cmd := range m.Console.Commands {
+		prefix := fmt.Sprintf("console.commands[%d]", i)
+		if cmd.Name == "" {
+			errs = append(errs, prefix+".name is required")
+		} else if names[cmd.Name] {
+			errs = append(errs, fmt.Sprintf("%s: duplicate command name %q", prefix, cmd.Name))
+		}
+		names[cmd.Name] = true
+
+		if cmd.Template == "" {
+			errs = append(errs, prefix+".template is required")
+		} else if _, err := template.New(cmd.Name).Parse(cmd.Template); err != nil {
+			errs = append(errs, fmt.Sprintf("%s.template is invalid: %v", prefix, err))
+		}
+
+		params := make(map[string]bool)
+		for j, p := range cmd.Params {
+			if p.Name == "" {
+				errs = append(errs, fmt.Sprintf("%s.params[%d].name is required", prefix, j))
+			} else if params[p.Name] {
+				errs = append(errs, fmt.Sprintf("%s.params[%d]: duplicate param name %q", prefix, j, p.Name))
+			}
+			params[p.Name] = true
+
+			if !console.ParamTypes[p.Type] {
+				errs = append(errs, fmt.Sprintf("%s.params[%d].type must be string, number, boolean, select, or player", prefix, j))
+			}
+			if p.Type == "select" && len(p.Options) == 0 {
+				errs = append(errs, fmt.Sprintf("%s.params[%d]: select type requires options", prefix, j))
+			}
+		}
+	}
+
+	return errs
+}
+
+func validatePlayers(m *models.Manifest) []string {
+	var errs []string
+
+	checkPattern := func(field, pattern string) {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			errs = append(errs, fmt.Sprintf("%s is not a valid regular expression: %v", field, err))
+			return
+		}
+		if re.SubexpIndex("name") < 0 && re.SubexpIndex("id") < 0 {
+			errs = append(errs, fmt.Sprintf("%s needs a \"name\" or \"id\" named group", field))
+		}
+	}
+
+	if list := m.Players.List; list != nil {
+		if list.Command == "" {
+			errs = append(errs, "players.list.command is required")
+		}
+		if list.Pattern == "" {
+			errs = append(errs, "players.list.pattern is required")
+		} else {
+			checkPattern("players.list.pattern", list.Pattern)
+		}
+		if list.Interval < 0 {
+			errs = append(errs, "players.list.interval must not be negative")
+		}
+		if !m.RCON.Enabled {
+			errs = append(errs, "players.list requires rcon to be enabled")
+		}
+	}
+	if m.Players.Join != "" {
+		checkPattern("players.join", m.Players.Join)
+	}
+	if m.Players.Leave != "" {
+		checkPattern("players.leave", m.Players.Leave)
+	}
+	if (m.Players.Join == "") != (m.Players.Leave == "") {
+		errs = append(errs, "players.join and players.leave must be set together")
+	}
+
+	return errs
+}
+
+func validateModeration(m *models.Manifest) []string {
+	var errs []string
+
+	for _, name := range models.ModerationActions {
+		action := m.Moderation.Action(name)
+		if action == nil {
+			continue
+		}
+		prefix := "moderation." + name
+		if action.Command == "" && action.File == nil {
+			errs = append(errs, prefix+" needs a command or a file")
+		}
+		if action.Command != "" {
+			if !m.RCON.Enabled {
+				errs = append(errs, prefix+".command requires rcon to be enabled")
+			}
+			if _, err := template.New(name).Parse(action.Command); err != nil {
+				errs = append(errs, fmt.Sprintf("%s.command is invalid: %v", prefix, err))
+			}
+		}
+		if f := action.File; f != nil {
+			if name == models.ModerationKick {
+				errs = append(errs, prefix+": kick cannot be done with a file")
+			}
+			if f.Path == "" || filepath.IsAbs(f.Path) || strings.HasPrefix(filepath.Clean(f.Path), "..") {
+				errs = append(errs, prefix+".file.path must be relative to the data directory")
+			}
+			switch f.Format {
+			case "lines":
+				if f.UUID != "" || len(f.Fields) > 0 {
+					errs = append(errs, prefix+".file: uuid and fields only apply to json files")
+				}
+			case "json":
+				if f.Field == "" {
+					errs = append(errs, prefix+".file.field is required for json files")
+				}
+			default:
+				errs = append(errs, prefix+".file.format must be lines or json")
+			}
+			switch f.UUID {
+			case "", "mojang", "offline":
+			default:
+				errs = append(errs, prefix+".file.uuid must be mojang or offline")
+			}
+		}
+	}
+
+	return errs
+}
+
+// validatePortLinks checks the offsetFrom/sameAs relationships between all
+// ports of the pack, including those of its services.
+func validatePortLinks(m *models.Manifest) []string {
+	all := append([]models.PortConfig{}, m.Ports...)
+	for _, svc := range m.Services {
+		all = append(all, svc.Ports...)
+	}
+
+	var errs []string
+	for _, p := range all {
+		if p.SameAs != "" && p.OffsetFrom != "" {
+			errs = append(errs, fmt.Sprintf("port %q cannot set both sameAs and offsetFrom", p.Name))
+		}
+		if p.Offset < 0 {
+			errs = append(errs, fmt.Sprintf("port %q: offset must not be negative", p.Name))
+		}
+		if p.Offset != 0 && p.OffsetFrom == "" {
+			errs = append(errs, fmt.Sprintf("port %q: offset requires offsetFrom", p.Name))
+		}
+	}
+	if len(errs) > 0 {
+		return errs
+	}
+
+	root, offset, err := models.ResolvePortLinks(all)
+	if err != nil {
+		return []string{err.Error()}
+	}
+
+	// Linked ports share a block of host ports, so two of them can only land
+	// on the same number when their protocols differ.
+	taken := make(map[string]string)
+	for _, p := range all {
+		key := fmt.Sprintf("%s+%d/%s", root[p.Name], offset[p.Name], p.Protocol)
+		if other, ok := taken[key]; ok {
+			errs = append(errs, fmt.Sprintf("ports %q and %q would use the same host port and protocol", other, p.Name))
+			continue
+		}
+		taken[key] = p.Name
+	}
+	return errs
+}
+
 func (l *Loader) ManifestToJSON(m *models.Manifest) (string, error) {
 	data, err := json.Marshal(m)
 	if err != nil {
@@ -0,0 +1,127 @@
+package players
+
+import (
+	"database/sql"
+	"time"
+)
+
+// Player is a player currently on a server.
+type Player struct {
+	Name     string    `json:"name"`
+	ID       string    `json:"id,omitempty"`
+	JoinedAt time.Time `json:"joinedAt"`
+
+	sessionID int64
+}
+
+// Session is one visit of a player to a server. LeftAt is nil while the
+// player is online.
+type Session struct {
+	ID         int64      `json:"id"`
+	ServerID   string     `json:"serverId"`
+	PlayerName string     `json:"playerName"`
+	PlayerID   string     `json:"playerId,omitempty"`
+	JoinedAt   time.Time  `json:"joinedAt"`
+	LeftAt     *time.Time `json:"leftAt,omitempty"`
+}
+
+// HistoryQuery filters Tracker.History. Results are newest first; Before
+// pages backwards by session ID.
+type HistoryQuery struct {
+	Limit  int
+	Before int64
+	// Player matches the player's name or ID
+	Player string
+}
+
+func (t *Tracker) openSession(serverID string, p *Player) error {
+	result, err := t.db.Exec(`
+		INSERT INTO player_sessions (server_id, player_name, player_id, joined_at)
+		VALUES (?, ?, ?, ?)
+	`, serverID, p.Name, p.ID, p.JoinedAt)
+	if err != nil {
+		return err
+	}
+	p.sessionID, _ = result.LastInsertId()
+	return nil
+}
+
+func (t *Tracker) closeSession(p *Player, at time.Time) error {
+	_, err := t.db.Exec(`UPDATE player_sessions SET left_at = ? WHERE id = ?`, at, p.sessionID)
+	return err
+}
+
+// loadOpenSessions restores the players that were online when the backend
+// last stopped; the first reconcile closes the sessions of servers that are
+// no longer running.
+func (t *Tracker) loadOpenSessions() error {
+	rows, err := t.db.Query(`
+		SELECT id, server_id, player_name, player_id, joined_at
+		FROM player_sessions WHERE left_at IS NULL
+	`)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for rows.Next() {
+		var p Player
+		var serverID string
+		var playerID sql.NullString
+		if err := rows.Scan(&p.sessionID, &serverID, &p.Name, &playerID, &p.JoinedAt); err != nil {
+			return err
+		}
+		p.ID = playerID.String
+		t.serverPlayers(serverID)[key(p.Name, p.ID)] = &p
+	}
+	return rows.Err()
+}
+
+// History returns a server's player sessions, newest first.
+func (t *Tracker) History(serverID string, q HistoryQuery) ([]*Session, error) {
+	if q.Limit <= 0 || q.Limit > 500 {
+		q.Limit = 100
+	}
+
+	query := `
+		SELECT id, server_id, player_name, player_id, joined_at, left_at
+		FROM player_sessions
+		WHERE server_id = ?`
+	args := []any{serverID}
+
+	if q.Before > 0 {
+		query += ` AND id < ?`
+		args = append(args, q.Before)
+	}
+	if q.Player != "" {
+		query += ` AND (player_name = ? OR player_id = ?)`
+		args = append(args, q.Player, q.Player)
+	}
+	query += ` ORDER BY id DESC LIMIT ?`
+	args = append(args, q.Limit)
+
+	rows, err := t.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	sessions := []*Session{}
+	for rows.Next() {
+		var s Session
+		var playerID sql.NullString
+		var leftAt sql.NullTime
+		if err := rows.Scan(&s.ID, &s.ServerID, &s.PlayerName, &playerID, &s.JoinedAt, &leftAt); err != nil {
+			return nil, err
+		}
+		s.PlayerID = playerID.String
+		if leftAt.Valid {
+			s.LeftAt = &leftAt.Time
+		}
+		sessions = append(sessions, &s)
+	}
+	return sessions, rows.Err()
+}
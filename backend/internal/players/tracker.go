@@ -0,0 +1,327 @@
+// Package players keeps track of who is online on each running server.
+package players
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"realmops/internal/db"
+	"realmops/internal/logstream"
+	"realmops/internal/packs"
+	"realmops/internal/rcon"
+	"realmops/internal/runtime"
+	"realmops/internal/server"
+)
+
+// defaultPollInterval applies to list commands without an interval.
+const defaultPollInterval = 30 * time.Second
+
+// Tracker follows the players of every running server whose pack declares
+// how to find them, and records their sessions.
+type Tracker struct {
+	db            *db.DB
+	serverManager *server.Manager
+	packLoader    *packs.Loader
+	runtime       runtime.Runtime
+	rconManager   *rcon.Manager
+
+	mu sync.Mutex
+	// online maps server ID to the players on it, keyed by key()
+	online map[string]map[string]*Player
+}
+
+func NewTracker(database *db.DB, serverManager *server.Manager, packLoader *packs.Loader, containerRuntime runtime.Runtime, rconManager *rcon.Manager) *Tracker {
+	return &Tracker{
+		db:            database,
+		serverManager: serverManager,
+		packLoader:    packLoader,
+		runtime:       containerRuntime,
+		rconManager:   rconManager,
+		online:        make(map[string]map[string]*Player),
+	}
+}
+
+// Start tracks players until ctx is done. Sessions stay open across backend
+// restarts and are reconciled once the tracker runs again.
+func (t *Tracker) Start(ctx context.Context) {
+	if err := t.loadOpenSessions(); err != nil {
+		slog.Error("failed to load open player sessions", "error", err)
+	}
+
+	logstream.NewWatcher(t.running, t.watch).Run(ctx)
+}
+
+// Online returns the players on a server, longest online first.
+func (t *Tracker) Online(serverID string) []Player {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	players := []Player{}
+	for _, p := range t.online[serverID] {
+		players = append(players, *p)
+	}
+	sort.Slice(players, func(i, j int) bool {
+		return players[i].JoinedAt.Before(players[j].JoinedAt)
+	})
+	return players
+}
+
+// running lists the running servers and ends the sessions of players still
+// online on servers that are not running, e.g. after a backend restart.
+func (t *Tracker) running(ctx context.Context) (map[string]string, error) {
+	running, err := t.serverManager.RunningContainers(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	t.mu.Lock()
+	for id := range t.online {
+		if _, ok := running[id]; !ok {
+			t.leaveAllLocked(id, now)
+		}
+	}
+	t.mu.Unlock()
+	return running, nil
+}
+
+// watch tracks a server's players for the lifetime of its container. When
+// the container stops or is replaced, everyone on it has left.
+func (t *Tracker) watch(ctx context.Context, serverID, containerID string) {
+	srv, err := t.serverManager.GetServer(ctx, serverID)
+	if err != nil {
+		// Try again on the next reconcile
+		return
+	}
+
+	var wg sync.WaitGroup
+	defer func() {
+		wg.Wait()
+		if context.Cause(ctx) == logstream.ErrContainerStopped {
+			t.mu.Lock()
+			t.leaveAllLocked(serverID, time.Now())
+			t.mu.Unlock()
+		}
+	}()
+
+	manifest, err := t.packLoader.LoadFromDir(t.packLoader.GetPackPath(srv.PackID))
+	if err != nil {
+		slog.Warn("player tracking disabled: failed to load pack", "serverId", serverID, "error", err)
+		<-ctx.Done()
+		return
+	}
+
+	cfg := manifest.Players
+	if cfg.Join != "" && cfg.Leave != "" {
+		join, err1 := regexp.Compile(cfg.Join)
+		leave, err2 := regexp.Compile(cfg.Leave)
+		if err1 == nil && err2 == nil {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				t.followLogs(ctx, serverID, containerID, join, leave)
+			}()
+		}
+	}
+
+	if cfg.List != nil {
+		if target, err := rcon.TargetFor(manifest, srv); err != nil {
+			slog.Warn("player list polling disabled", "serverId", serverID, "error", err)
+		} else if pattern, err := regexp.Compile(cfg.List.Pattern); err == nil {
+			interval := defaultPollInterval
+			if cfg.List.Interval > 0 {
+				interval = time.Duration(cfg.List.Interval) * time.Second
+			}
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				t.poll(ctx, serverID, target, cfg.List.Command, pattern, interval)
+			}()
+		}
+	}
+
+	<-ctx.Done()
+}
+
+func (t *Tracker) followLogs(ctx context.Context, serverID, containerID string, join, leave *regexp.Regexp) {
+	logstream.Repeat(ctx, func(ctx context.Context) {
+		err := logstream.Follow(ctx, t.runtime, containerID, func(line logstream.Line) {
+			if name, id, ok := match(join, line.Text); ok {
+				t.join(serverID, name, id, line.Time)
+			} else if name, id, ok := match(leave, line.Text); ok {
+				t.leave(serverID, name, id, line.Time)
+			}
+		})
+		if err != nil {
+			slog.Debug("player log tracking interrupted", "serverId", serverID, "error", err)
+		}
+	})
+}
+
+func (t *Tracker) poll(ctx context.Context, serverID string, target rcon.Target, command string, pattern *regexp.Regexp, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if listed, err := t.list(ctx, serverID, target, command, pattern); err == nil {
+			t.sync(serverID, listed)
+		} else if ctx.Err() == nil {
+			slog.Debug("failed to poll player list", "serverId", serverID, "error", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (t *Tracker) list(ctx context.Context, serverID string, target rcon.Target, command string, pattern *regexp.Regexp) ([]Player, error) {
+	ctx, cancel := context.WithTimeout(ctx, rcon.DefaultTimeout)
+	defer cancel()
+
+	response, err := t.rconManager.Run(ctx, serverID, target, command)
+	if err != nil {
+		return nil, fmt.Errorf("failed to run %q: %w", command, err)
+	}
+
+	var players []Player
+	for _, m := range pattern.FindAllStringSubmatch(response, -1) {
+		p := Player{Name: group(pattern, m, "name"), ID: group(pattern, m, "id")}
+		if p.Name == "" && p.ID == "" {
+			continue
+		}
+		players = append(players, p)
+	}
+	return players, nil
+}
+
+func (t *Tracker) join(serverID, name, id string, at time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.joinLocked(serverID, name, id, at)
+}
+
+func (t *Tracker) joinLocked(serverID, name, id string, at time.Time) {
+	players := t.serverPlayers(serverID)
+	if p := find(players, name, id); p != nil {
+		if p.ID == "" && id != "" {
+			p.ID = id
+			t.db.Exec(`UPDATE player_sessions SET player_id = ? WHERE id = ?`, id, p.sessionID)
+		}
+		return
+	}
+
+	if name == "" {
+		name = id
+	}
+	p := &Player{Name: name, ID: id, JoinedAt: at}
+	if err := t.openSession(serverID, p); err != nil {
+		slog.Error("failed to record player join", "serverId", serverID, "player", name, "error", err)
+		return
+	}
+	players[key(name, id)] = p
+}
+
+func (t *Tracker) leave(serverID, name, id string, at time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.leaveLocked(serverID, t.online[serverID], find(t.online[serverID], name, id), at)
+}
+
+func (t *Tracker) leaveLocked(serverID string, players map[string]*Player, p *Player, at time.Time) {
+	if p == nil {
+		return
+	}
+	if err := t.closeSession(p, at); err != nil {
+		slog.Error("failed to record player leave", "serverId", serverID, "player", p.Name, "error", err)
+	}
+	delete(players, key(p.Name, p.ID))
+}
+
+// sync makes the online list match a polled player list.
+func (t *Tracker) sync(serverID string, listed []Player) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	now := time.Now()
+	players := t.serverPlayers(serverID)
+
+	seen := make(map[*Player]bool)
+	for _, l := range listed {
+		t.joinLocked(serverID, l.Name, l.ID, now)
+		if p := find(players, l.Name, l.ID); p != nil {
+			seen[p] = true
+		}
+	}
+	for _, p := range players {
+		if !seen[p] {
+			t.leaveLocked(serverID, players, p, now)
+		}
+	}
+}
+
+func (t *Tracker) leaveAllLocked(serverID string, at time.Time) {
+	players := t.online[serverID]
+	for _, p := range players {
+		t.leaveLocked(serverID, players, p, at)
+	}
+	delete(t.online, serverID)
+}
+
+func (t *Tracker) serverPlayers(serverID string) map[string]*Player {
+	players, ok := t.online[serverID]
+	if !ok {
+		players = make(map[string]*Player)
+		t.online[serverID] = players
+	}
+	return players
+}
+
+// key identifies a player by name, which both logs and player lists
+// usually carry, falling back to the ID.
+func key(name, id string) string {
+	if name != "" {
+		return "name:" + strings.ToLower(name)
+	}
+	return "id:" + id
+}
+
+func find(players map[string]*Player, name, id string) *Player {
+	if name != "" {
+		if p, ok := players[key(name, "")]; ok {
+			return p
+		}
+	}
+	if id != "" {
+		for _, p := range players {
+			if p.ID == id {
+				return p
+			}
+		}
+	}
+	return nil
+}
+
+func match(re *regexp.Regexp, text string) (name, id string, ok bool) {
+	m := re.FindStringSubmatch(text)
+	if m == nil {
+		return "", "", false
+	}
+	name, id = group(re, m, "name"), group(re, m, "id")
+	return name, id, name != "" || id != ""
+}
+
+func group(re *regexp.Regexp, m []string, name string) string {
+	if i := re.SubexpIndex(name); i >= 0 && i < len(m) {
+		return strings.TrimSpace(m[i])
+	}
+	return ""
+}
@@ -0,0 +1,64 @@
+package podman
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"realmops/internal/docker"
+	"realmops/internal/runtime"
+)
+
+var _ runtime.Runtime = (*Provider)(nil)
+
+// Provider runs game servers on Podman through its Docker-compatible API
+// socket. Everything except container creation is handled by the Docker
+// client unchanged.
+type Provider struct {
+	*docker.Provider
+	rootless bool
+}
+
+// NewProvider connects to the Podman API socket at host. An empty host picks
+// the default socket: the per-user one when running rootless, the system one
+// otherwise.
+func NewProvider(host string) (*Provider, error) {
+	rootless := os.Geteuid() != 0
+	if host == "" {
+		host = DefaultHost(rootless)
+	}
+
+	p, err := docker.NewProviderForHost(host)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to podman at %s: %w", host, err)
+	}
+
+	return &Provider{Provider: p, rootless: rootless}, nil
+}
+
+// DefaultHost returns the conventional location of the Podman API socket.
+func DefaultHost(rootless bool) string {
+	if !rootless {
+		return "unix:///run/podman/podman.sock"
+	}
+	runtimeDir := os.Getenv("XDG_RUNTIME_DIR")
+	if runtimeDir == "" {
+		runtimeDir = filepath.Join("/run/user", fmt.Sprint(os.Geteuid()))
+	}
+	return "unix://" + filepath.Join(runtimeDir, "podman", "podman.sock")
+}
+
+func (p *Provider) Name() string {
+	return "podman"
+}
+
+// CreateContainer keeps the host user's ID inside rootless containers so that
+// files written to the bind-mounted data directory stay owned by that user
+// and remain manageable from the panel and SFTP.
+func (p *Provider) CreateContainer(ctx context.Context, opts runtime.CreateContainerOptions) (string, error) {
+	if p.rootless && opts.UsernsMode == "" {
+		opts.UsernsMode = "keep-id"
+	}
+	return p.Provider.CreateContainer(ctx, opts)
+}
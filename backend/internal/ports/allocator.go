@@ -1,16 +1,41 @@
 package ports
 
 import (
+	"database/sql"
 	"errors"
+	"fmt"
 	"sync"
 
 	"realmops/internal/db"
 )
 
+var (
+	ErrPortOutOfRange = errors.New("port outside allowed range")
+	ErrPortReserved   = errors.New("port already reserved")
+	ErrPortExcluded   = errors.New("port is excluded from allocation")
+	ErrPortInUse      = errors.New("port is in use by another process on the host")
+)
+
+// PortError reports which port of a group could not be reserved.
+type PortError struct {
+	Port int
+	Err  error
+}
+
+func (e *PortError) Error() string {
+	return fmt.Sprintf("port %d: %v", e.Port, e.Err)
+}
+
+func (e *PortError) Unwrap() error {
+	return e.Err
+}
+
 type Allocator struct {
 	db         *db.DB
 	rangeStart int
 	rangeEnd   int
+	excluded   map[int]bool
+	probe      bool
 	mu         sync.Mutex
 }
 
@@ -22,69 +47,280 @@ func NewAllocator(database *db.DB, rangeStart, rangeEnd int) *Allocator {
 	}
 }
 
-func (a *Allocator) AllocatePorts(serverID string, count int) ([]int, error) {
+// SetRange changes the range new ports are allocated from. Existing
+// reservations outside the new range are kept until they are migrated.
+func (a *Allocator) SetRange(start, end int) {
 	a.mu.Lock()
 	defer a.mu.Unlock()
 
-	reserved, err := a.getReservedPorts()
-	if err != nil {
-		return nil, err
+	a.rangeStart = start
+	a.rangeEnd = end
+}
+
+// InRange reports whether a port lies within the allocation range.
+func (a *Allocator) InRange(port int) bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	return port >= a.rangeStart && port <= a.rangeEnd
+}
+
+// SetExcluded replaces the list of ports that are never allocated.
+func (a *Allocator) SetExcluded(ports []int) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	a.excluded = make(map[int]bool, len(ports))
+	for _, p := range ports {
+		a.excluded[p] = true
 	}
+}
 
-	reservedSet := make(map[int]bool)
-	for _, p := range reserved {
-		reservedSet[p] = true
+// SetProbe enables checking the host for ports bound by other processes
+// before they are allocated.
+func (a *Allocator) SetProbe(enabled bool) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	a.probe = enabled
+}
+
+// checkUsable reports why an unreserved port cannot be allocated, if at all.
+// Callers must hold a.mu.
+func (a *Allocator) checkUsable(port int) error {
+	if port < a.rangeStart || port > a.rangeEnd {
+		return ErrPortOutOfRange
+	}
+	if a.excluded[port] {
+		return ErrPortExcluded
+	}
+	if a.probe && !HostPortFree(port) {
+		return ErrPortInUse
 	}
+	return nil
+}
 
+func (a *Allocator) AllocatePorts(serverID string, count int) ([]int, error) {
 	var allocated []int
-	for port := a.rangeStart; port <= a.rangeEnd && len(allocated) < count; port++ {
-		if !reservedSet[port] {
-			allocated = append(allocated, port)
+	err := a.WithTx(func(tx *sql.Tx) error {
+		reservedSet, err := a.reservedSet(tx)
+		if err != nil {
+			return err
 		}
-	}
 
-	if len(allocated) < count {
-		return nil, errors.New("not enough ports available")
-	}
+		for port := a.rangeStart; port <= a.rangeEnd && len(allocated) < count; port++ {
+			if !reservedSet[port] && a.checkUsable(port) == nil {
+				allocated = append(allocated, port)
+			}
+		}
 
-	for _, port := range allocated {
-		_, err := a.db.Exec(
-			"INSERT INTO port_reservations (host_port, server_id) VALUES (?, ?)",
-			port, serverID,
-		)
-		if err != nil {
-			a.rollbackAllocations(serverID)
-			return nil, err
+		if len(allocated) < count {
+			return errors.New("not enough ports available")
+		}
+
+		for _, port := range allocated {
+			if err := a.insert(tx, serverID, port); err != nil {
+				return err
+			}
 		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
 	}
 
 	return allocated, nil
 }
 
 func (a *Allocator) AllocateSpecificPort(serverID string, port int) error {
+	return a.ReserveGroup(serverID, port, []int{0})
+}
+
+// AllocateGroup finds the lowest base port for which every base+offset is
+// free, reserves the whole block in one transaction and returns the base.
+// Offsets [0, 1] give a game port followed by its query port.
+func (a *Allocator) AllocateGroup(serverID string, offsets []int) (int, error) {
+	var base int
+	err := a.WithTx(func(tx *sql.Tx) error {
+		var err error
+		base, err = a.AllocateGroupTx(tx, serverID, offsets)
+		return err
+	})
+	return base, err
+}
+
+// WithTx runs fn in a transaction while holding the allocator lock, for
+// callers that reserve ports together with their own writes. The lock is
+// always taken before the transaction begins, never while one is open, so
+// no one waits on the lock while holding the SQLite write lock.
+func (a *Allocator) WithTx(fn func(tx *sql.Tx) error) error {
 	a.mu.Lock()
 	defer a.mu.Unlock()
 
-	if port < a.rangeStart || port > a.rangeEnd {
-		return errors.New("port outside allowed range")
-	}
+	return a.db.WithTx(fn)
+}
 
-	var count int
-	err := a.db.QueryRow("SELECT COUNT(*) FROM port_reservations WHERE host_port = ?", port).Scan(&count)
+// AllocateGroupTx is AllocateGroup as part of a transaction run by WithTx.
+func (a *Allocator) AllocateGroupTx(tx *sql.Tx, serverID string, offsets []int) (int, error) {
+	reservedSet, err := a.reservedSet(tx)
 	if err != nil {
-		return err
+		return 0, err
+	}
+
+	span := 0
+	for _, off := range offsets {
+		if off > span {
+			span = off
+		}
+	}
+
+	for base := a.rangeStart; base+span <= a.rangeEnd; base++ {
+		free := true
+		for _, off := range offsets {
+			if reservedSet[base+off] || a.checkUsable(base+off) != nil {
+				free = false
+				break
+			}
+		}
+		if free {
+			return base, a.reserve(tx, serverID, base, offsets)
+		}
 	}
-	if count > 0 {
-		return errors.New("port already reserved")
+
+	return 0, errors.New("not enough ports available")
+}
+
+// ReserveGroup reserves base+offset for every offset, or nothing if any of
+// them cannot be used. Failures are reported as a *PortError.
+func (a *Allocator) ReserveGroup(serverID string, base int, offsets []int) error {
+	return a.WithTx(func(tx *sql.Tx) error {
+		return a.ReserveGroupTx(tx, serverID, base, offsets)
+	})
+}
+
+// ReserveGroupTx is ReserveGroup as part of a transaction run by WithTx.
+func (a *Allocator) ReserveGroupTx(tx *sql.Tx, serverID string, base int, offsets []int) error {
+	for _, off := range offsets {
+		port := base + off
+
+		var count int
+		err := tx.QueryRow("SELECT COUNT(*) FROM port_reservations WHERE host_port = ?", port).Scan(&count)
+		if err != nil {
+			return err
+		}
+		if count > 0 {
+			return &PortError{Port: port, Err: ErrPortReserved}
+		}
+
+		if err := a.checkUsable(port); err != nil {
+			return &PortError{Port: port, Err: err}
+		}
+	}
+
+	return a.reserve(tx, serverID, base, offsets)
+}
+
+// reserve inserts the reservations of a block, skipping offsets that land
+// on the same port.
+func (a *Allocator) reserve(q db.Querier, serverID string, base int, offsets []int) error {
+	inserted := make(map[int]bool)
+	for _, off := range offsets {
+		port := base + off
+		if inserted[port] {
+			continue
+		}
+		inserted[port] = true
+
+		if err := a.insert(q, serverID, port); err != nil {
+			return err
+		}
 	}
+	return nil
+}
 
-	_, err = a.db.Exec(
+func (a *Allocator) insert(q db.Querier, serverID string, port int) error {
+	_, err := q.Exec(
 		"INSERT INTO port_reservations (host_port, server_id) VALUES (?, ?)",
 		port, serverID,
 	)
 	return err
 }
 
+// ReassignPorts moves a server's reservations from each old port to its new
+// port in one transaction, so a server can also swap ports between its own
+// mappings. Nothing changes if any new port is out of range or taken.
+func (a *Allocator) ReassignPorts(serverID string, moves map[int]int) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	tx, err := a.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for oldPort := range moves {
+		if _, err := tx.Exec("DELETE FROM port_reservations WHERE host_port = ? AND server_id = ?", oldPort, serverID); err != nil {
+			return err
+		}
+	}
+
+	for _, newPort := range moves {
+		var count int
+		if err := tx.QueryRow("SELECT COUNT(*) FROM port_reservations WHERE host_port = ?", newPort).Scan(&count); err != nil {
+			return err
+		}
+		if count > 0 {
+			return ErrPortReserved
+		}
+
+		// A port freed by this move may still be bound by the server's own
+		// container, so only ports new to the server are probed.
+		if _, freed := moves[newPort]; freed {
+			if a.excluded[newPort] {
+				return ErrPortExcluded
+			}
+		} else if err := a.checkUsable(newPort); err != nil {
+			return err
+		}
+
+		if _, err := tx.Exec(
+			"INSERT INTO port_reservations (host_port, server_id) VALUES (?, ?)",
+			newPort, serverID,
+		); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// ReservedBy returns the ID of the server holding a port, or an empty string
+// if the port is free.
+func (a *Allocator) ReservedBy(port int) (string, error) {
+	var serverID string
+	err := a.db.QueryRow("SELECT server_id FROM port_reservations WHERE host_port = ?", port).Scan(&serverID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", nil
+	}
+	return serverID, err
+}
+
+// ReleasePort releases a single port reserved by a server.
+func (a *Allocator) ReleasePort(serverID string, port int) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	_, err := a.db.Exec("DELETE FROM port_reservations WHERE host_port = ? AND server_id = ?", port, serverID)
+	return err
+}
+
+// ReleasePortTx is ReleasePort as part of a transaction run by WithTx.
+func (a *Allocator) ReleasePortTx(tx *sql.Tx, serverID string, port int) error {
+	_, err := tx.Exec("DELETE FROM port_reservations WHERE host_port = ? AND server_id = ?", port, serverID)
+	return err
+}
+
 func (a *Allocator) ReleasePorts(serverID string) error {
 	a.mu.Lock()
 	defer a.mu.Unlock()
@@ -112,7 +348,10 @@ func (a *Allocator) GetServerPorts(serverID string) ([]int, error) {
 }
 
 func (a *Allocator) IsPortAvailable(port int) (bool, error) {
-	if port < a.rangeStart || port > a.rangeEnd {
+	a.mu.Lock()
+	usable := a.checkUsable(port) == nil
+	a.mu.Unlock()
+	if !usable {
 		return false, nil
 	}
 
@@ -124,24 +363,20 @@ func (a *Allocator) IsPortAvailable(port int) (bool, error) {
 	return count == 0, nil
 }
 
-func (a *Allocator) getReservedPorts() ([]int, error) {
-	rows, err := a.db.Query("SELECT host_port FROM port_reservations")
+func (a *Allocator) reservedSet(q db.Querier) (map[int]bool, error) {
+	rows, err := q.Query("SELECT host_port FROM port_reservations")
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 
-	var ports []int
+	reserved := make(map[int]bool)
 	for rows.Next() {
 		var port int
 		if err := rows.Scan(&port); err != nil {
 			return nil, err
 		}
-		ports = append(ports, port)
+		reserved[port] = true
 	}
-	return ports, rows.Err()
-}
-
-func (a *Allocator) rollbackAllocations(serverID string) {
-	a.db.Exec("DELETE FROM port_reservations WHERE server_id = ?", serverID)
+	return reserved, rows.Err()
 }
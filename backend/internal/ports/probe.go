@@ -0,0 +1,31 @@
+package ports
+
+import (
+	"net"
+	"strconv"
+)
+
+// HostPortFree reports whether both the TCP and UDP variants of a port can be
+// bound on the host. Game servers often use both protocols on the same port,
+// so a port is only handed out when neither is taken.
+//
+// The probe binds in the backend's own network namespace. It only sees host
+// processes when the backend runs on the host or in a container with
+// network_mode: host; on a bridge network every port looks free.
+func HostPortFree(port int) bool {
+	addr := net.JoinHostPort("", strconv.Itoa(port))
+
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return false
+	}
+	l.Close()
+
+	pc, err := net.ListenPacket("udp", addr)
+	if err != nil {
+		return false
+	}
+	pc.Close()
+
+	return true
+}
@@ -0,0 +1,63 @@
+package ports
+
+// Leak is a reservation that no server port uses, left behind by a server
+// that was deleted or whose creation failed half-way.
+type Leak struct {
+	HostPort int    `json:"hostPort"`
+	ServerID string `json:"serverId"`
+	Reason   string `json:"reason"`
+}
+
+// FindLeaks returns the reservations held by servers that no longer exist
+// and those not used by any port of an existing server.
+func (a *Allocator) FindLeaks() ([]Leak, error) {
+	rows, err := a.db.Query(`
+		SELECT pr.host_port, pr.server_id,
+		       EXISTS (SELECT 1 FROM servers s WHERE s.id = pr.server_id)
+		FROM port_reservations pr
+		WHERE NOT EXISTS (SELECT 1 FROM servers s WHERE s.id = pr.server_id)
+		   OR NOT EXISTS (
+		       SELECT 1 FROM server_ports sp
+		       WHERE sp.server_id = pr.server_id AND sp.host_port = pr.host_port
+		   )
+		ORDER BY pr.host_port
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var leaks []Leak
+	for rows.Next() {
+		var l Leak
+		var serverExists bool
+		if err := rows.Scan(&l.HostPort, &l.ServerID, &serverExists); err != nil {
+			return nil, err
+		}
+		if serverExists {
+			l.Reason = "not used by any port of the server"
+		} else {
+			l.Reason = "server no longer exists"
+		}
+		leaks = append(leaks, l)
+	}
+	return leaks, rows.Err()
+}
+
+// RepairLeaks releases every leaked reservation and returns what it released.
+func (a *Allocator) RepairLeaks() ([]Leak, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	leaks, err := a.FindLeaks()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, l := range leaks {
+		if _, err := a.db.Exec("DELETE FROM port_reservations WHERE host_port = ? AND server_id = ?", l.HostPort, l.ServerID); err != nil {
+			return nil, err
+		}
+	}
+	return leaks, nil
+}
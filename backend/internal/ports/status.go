@@ -0,0 +1,143 @@
+package ports
+
+import (
+	"database/sql"
+	"sort"
+	"time"
+)
+
+type Reservation struct {
+	HostPort   int    `json:"hostPort"`
+	ServerID   string `json:"serverId"`
+	ServerName string `json:"serverName,omitempty"`
+	// PortName and Protocol list every port sharing the host port, comma
+	// separated, e.g. "game,query" for a TCP/UDP pair.
+	PortName   string    `json:"portName,omitempty"`
+	Protocol   string    `json:"protocol,omitempty"`
+	ReservedAt time.Time `json:"reservedAt"`
+}
+
+// Conflict is a reservation the allocator would not hand out today.
+type Conflict struct {
+	HostPort int    `json:"hostPort"`
+	ServerID string `json:"serverId"`
+	Reason   string `json:"reason"`
+}
+
+type RangeStats struct {
+	Start    int `json:"start"`
+	End      int `json:"end"`
+	Total    int `json:"total"`
+	Reserved int `json:"reserved"`
+	Excluded int `json:"excluded"`
+	// Free counts ports neither reserved nor excluded. Ports bound by other
+	// host processes are not probed here and count as free.
+	Free int `json:"free"`
+}
+
+type Status struct {
+	Range        RangeStats    `json:"range"`
+	Probe        bool          `json:"probe"`
+	Excluded     []int         `json:"excluded"`
+	Reservations []Reservation `json:"reservations"`
+	Conflicts    []Conflict    `json:"conflicts"`
+}
+
+// Status reports every reservation, the reservations that conflict with the
+// current range, exclusions or host, and how much of the range is left.
+// The host is probed without holding the allocator lock, so a slow probe
+// does not hold up allocations.
+func (a *Allocator) Status() (*Status, error) {
+	a.mu.Lock()
+	rangeStart, rangeEnd, probe := a.rangeStart, a.rangeEnd, a.probe
+	excluded := make(map[int]bool, len(a.excluded))
+	for p := range a.excluded {
+		excluded[p] = true
+	}
+	a.mu.Unlock()
+
+	rows, err := a.db.Query(`
+		SELECT pr.host_port, pr.server_id, pr.reserved_at,
+		       s.name, s.state, GROUP_CONCAT(sp.name, ','), GROUP_CONCAT(sp.protocol, ',')
+		FROM port_reservations pr
+		LEFT JOIN servers s ON s.id = pr.server_id
+		LEFT JOIN server_ports sp ON sp.server_id = pr.server_id AND sp.host_port = pr.host_port
+		GROUP BY pr.host_port
+		ORDER BY pr.host_port
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	status := &Status{
+		Probe:        probe,
+		Excluded:     []int{},
+		Reservations: []Reservation{},
+		Conflicts:    []Conflict{},
+	}
+
+	reserved := make(map[int]bool)
+	for rows.Next() {
+		var r Reservation
+		var reservedAt sql.NullTime
+		var serverName, state, portName, protocol sql.NullString
+		if err := rows.Scan(&r.HostPort, &r.ServerID, &reservedAt, &serverName, &state, &portName, &protocol); err != nil {
+			return nil, err
+		}
+		r.ReservedAt = reservedAt.Time
+		r.ServerName = serverName.String
+		r.PortName = portName.String
+		r.Protocol = protocol.String
+		status.Reservations = append(status.Reservations, r)
+		reserved[r.HostPort] = true
+
+		reason := ""
+		switch {
+		case !serverName.Valid:
+			reason = "reserved by a server that no longer exists"
+		case !portName.Valid:
+			reason = "not used by any port of the server"
+		case r.HostPort < rangeStart || r.HostPort > rangeEnd:
+			reason = "outside the allowed port range"
+		case excluded[r.HostPort]:
+			reason = "excluded from allocation"
+		case probe && state.String != "running" && !HostPortFree(r.HostPort):
+			reason = "in use by another process on the host"
+		}
+		if reason != "" {
+			status.Conflicts = append(status.Conflicts, Conflict{
+				HostPort: r.HostPort,
+				ServerID: r.ServerID,
+				Reason:   reason,
+			})
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for p := range excluded {
+		status.Excluded = append(status.Excluded, p)
+	}
+	sort.Ints(status.Excluded)
+
+	stats := RangeStats{
+		Start: rangeStart,
+		End:   rangeEnd,
+		Total: rangeEnd - rangeStart + 1,
+	}
+	for port := rangeStart; port <= rangeEnd; port++ {
+		switch {
+		case reserved[port]:
+			stats.Reserved++
+		case excluded[port]:
+			stats.Excluded++
+		default:
+			stats.Free++
+		}
+	}
+	status.Range = stats
+
+	return status, nil
+}
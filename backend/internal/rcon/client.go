@@ -2,11 +2,14 @@ package rcon
 
 import (
 	"bytes"
+	"context"
 	"encoding/binary"
 	"errors"
 	"fmt"
 	"io"
 	"net"
+	"strconv"
+	"strings"
 	"sync"
 	"sync/atomic"
 	"time"
@@ -18,7 +21,10 @@ const (
 	PacketTypeAuthResponse int32 = 2
 	PacketTypeAuth         int32 = 3
 
+	// MaxPacketSize limits the packets we send. Servers may send larger
+	// packets, up to MaxReadPacketSize.
 	MaxPacketSize     = 4096
+	MaxReadPacketSize = 64 * 1024
 	AuthFailedID      = -1
 	DefaultTimeout    = 10 * time.Second
 	DefaultReadBuffer = 4096
@@ -31,14 +37,29 @@ var (
 	ErrInvalidPacket  = errors.New("invalid packet received")
 )
 
+// Client is a Source RCON client. Commands may be executed concurrently:
+// each one is matched to its responses by request ID by a single reader
+// goroutine, so callers only contend for the duration of a write.
 type Client struct {
-	conn      net.Conn
 	host      string
 	port      int
 	password  string
 	requestID atomic.Int32
-	mu        sync.Mutex
-	connected bool
+
+	// mu guards sess; Connect and Close replace it
+	mu   sync.Mutex
+	sess *session
+}
+
+// session is one authenticated connection and the requests waiting on it.
+type session struct {
+	conn net.Conn
+	// writeMu keeps the packets of one command together on the wire
+	writeMu sync.Mutex
+
+	mu      sync.Mutex
+	pending map[int32]*pendingRequest
+	err     error
 }
 
 type Packet struct {
@@ -48,6 +69,19 @@ type Packet struct {
 	Body      string
 }
 
+// pendingRequest collects the response packets of one command. Responses
+// longer than a packet are split over several packets with the command's
+// request ID, so each command is followed by an empty RESPONSE_VALUE packet
+// with a sentinel ID. Servers answer packets in order, so the sentinel's
+// reply marks the end of the command's response.
+type pendingRequest struct {
+	id       int32
+	sentinel int32
+	body     strings.Builder
+	done     chan struct{}
+	err      error
+}
+
 func NewClient(host string, port int, password string) *Client {
 	return &Client{
 		host:     host,
@@ -60,29 +94,31 @@ func (c *Client) Connect() error {
 	c.mu.Lock()
 	defer c.mu.Unlock()
 
-	if c.connected {
+	if c.sess != nil && c.sess.alive() {
 		return nil
 	}
 
-	addr := fmt.Sprintf("%s:%d", c.host, c.port)
+	addr := net.JoinHostPort(c.host, strconv.Itoa(c.port))
 	conn, err := net.DialTimeout("tcp", addr, DefaultTimeout)
 	if err != nil {
 		return fmt.Errorf("failed to connect to rcon: %w", err)
 	}
 
-	c.conn = conn
-	c.connected = true
-
-	if err := c.authenticateInternal(); err != nil {
-		c.conn.Close()
-		c.connected = false
+	if err := c.authenticateInternal(conn); err != nil {
+		conn.Close()
 		return err
 	}
 
+	c.sess = &session{
+		conn:    conn,
+		pending: make(map[int32]*pendingRequest),
+	}
+	go c.sess.readLoop()
+
 	return nil
 }
 
-func (c *Client) authenticateInternal() error {
+func (c *Client) authenticateInternal(conn net.Conn) error {
 	id := c.nextRequestID()
 	packet := &Packet{
 		RequestID: id,
@@ -90,75 +126,211 @@ func (c *Client) authenticateInternal() error {
 		Body:      c.password,
 	}
 
-	if err := c.writePacketInternal(packet); err != nil {
+	if err := writePacket(conn, packet); err != nil {
 		return fmt.Errorf("failed to send auth packet: %w", err)
 	}
 
-	response, err := c.readPacketInternal()
-	if err != nil {
-		return fmt.Errorf("failed to read auth response: %w", err)
-	}
-
-	if response.RequestID == AuthFailedID {
-		return ErrAuthFailed
+	// Source servers send an empty RESPONSE_VALUE before the auth response
+	for {
+		conn.SetReadDeadline(time.Now().Add(DefaultTimeout))
+		response, err := readPacket(conn)
+		if err != nil {
+			return fmt.Errorf("failed to read auth response: %w", err)
+		}
+
+		if response.RequestID == AuthFailedID {
+			return ErrAuthFailed
+		}
+		if response.Type == PacketTypeAuthResponse {
+			conn.SetReadDeadline(time.Time{})
+			return nil
+		}
 	}
-
-	return nil
 }
 
 func (c *Client) Execute(command string) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), DefaultTimeout)
+	defer cancel()
+	return c.ExecuteContext(ctx, command)
+}
+
+// ExecuteContext runs a command and returns its full response, however many
+// packets the server splits it into.
+func (c *Client) ExecuteContext(ctx context.Context, command string) (string, error) {
 	c.mu.Lock()
-	defer c.mu.Unlock()
+	sess := c.sess
+	c.mu.Unlock()
 
-	if !c.connected {
+	if sess == nil {
 		return "", ErrNotConnected
 	}
 
-	id := c.nextRequestID()
-	packet := &Packet{
-		RequestID: id,
-		Type:      PacketTypeExecCommand,
-		Body:      command,
+	req := &pendingRequest{
+		id:       c.nextRequestID(),
+		sentinel: c.nextRequestID(),
+		done:     make(chan struct{}),
 	}
 
-	if err := c.writePacketInternal(packet); err != nil {
+	if err := sess.register(req); err != nil {
+		return "", err
+	}
+	defer sess.forget(req)
+
+	sess.writeMu.Lock()
+	err := writePacket(sess.conn, &Packet{RequestID: req.id, Type: PacketTypeExecCommand, Body: command})
+	if err == nil {
+		err = writePacket(sess.conn, &Packet{RequestID: req.sentinel, Type: PacketTypeResponse})
+	}
+	sess.writeMu.Unlock()
+	if err != nil {
 		return "", fmt.Errorf("failed to send command: %w", err)
 	}
 
-	response, err := c.readPacketInternal()
+	select {
+	case <-req.done:
+		if req.err != nil {
+			return "", fmt.Errorf("failed to read response: %w", req.err)
+		}
+		return req.body.String(), nil
+	case <-ctx.Done():
+		return "", ctx.Err()
+	}
+}
+
+// Ping sends a lone empty RESPONSE_VALUE packet, which servers answer
+// without running anything.
+func (c *Client) Ping(ctx context.Context) error {
+	c.mu.Lock()
+	sess := c.sess
+	c.mu.Unlock()
+
+	if sess == nil {
+		return ErrNotConnected
+	}
+
+	id := c.nextRequestID()
+	req := &pendingRequest{id: id, sentinel: id, done: make(chan struct{})}
+
+	if err := sess.register(req); err != nil {
+		return err
+	}
+	defer sess.forget(req)
+
+	sess.writeMu.Lock()
+	err := writePacket(sess.conn, &Packet{RequestID: id, Type: PacketTypeResponse})
+	sess.writeMu.Unlock()
 	if err != nil {
-		return "", fmt.Errorf("failed to read response: %w", err)
+		return fmt.Errorf("failed to send ping: %w", err)
 	}
 
-	return response.Body, nil
+	select {
+	case <-req.done:
+		return req.err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
 }
 
 func (c *Client) Close() error {
 	c.mu.Lock()
 	defer c.mu.Unlock()
 
-	if !c.connected {
+	if c.sess == nil {
 		return nil
 	}
 
-	c.connected = false
-	if c.conn != nil {
-		return c.conn.Close()
-	}
-	return nil
+	err := c.sess.conn.Close()
+	c.sess = nil
+	return err
 }
 
 func (c *Client) IsConnected() bool {
 	c.mu.Lock()
 	defer c.mu.Unlock()
-	return c.connected
+	return c.sess != nil && c.sess.alive()
+}
+
+func (s *session) alive() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.err == nil
+}
+
+func (s *session) register(req *pendingRequest) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.err != nil {
+		return ErrNotConnected
+	}
+	s.pending[req.id] = req
+	s.pending[req.sentinel] = req
+	return nil
+}
+
+func (s *session) forget(req *pendingRequest) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.pending, req.id)
+	delete(s.pending, req.sentinel)
+}
+
+// readLoop dispatches incoming packets to the requests waiting for them
+// until the connection fails, then fails every pending request.
+func (s *session) readLoop() {
+	for {
+		packet, err := readPacket(s.conn)
+		if err != nil {
+			s.fail(err)
+			return
+		}
+
+		s.mu.Lock()
+		if req, ok := s.pending[packet.RequestID]; ok {
+			if packet.RequestID == req.sentinel {
+				// Some servers answer the sentinel with more than one
+				// packet; only the first one matters.
+				delete(s.pending, req.id)
+				delete(s.pending, req.sentinel)
+				close(req.done)
+			} else {
+				req.body.WriteString(packet.Body)
+			}
+		}
+		s.mu.Unlock()
+	}
+}
+
+func (s *session) fail(err error) {
+	s.conn.Close()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.err = err
+	for id, req := range s.pending {
+		delete(s.pending, id)
+		if id == req.id {
+			req.err = err
+			close(req.done)
+		}
+	}
+}
+
+// Subscribe never delivers messages: Source RCON servers only ever answer
+// commands. The channel is closed on unsubscribe.
+func (c *Client) Subscribe() (<-chan Message, func()) {
+	sub := make(chan Message)
+	var once sync.Once
+	return sub, func() { once.Do(func() { close(sub) }) }
 }
 
 func (c *Client) nextRequestID() int32 {
 	return c.requestID.Add(1)
 }
 
-func (c *Client) writePacketInternal(p *Packet) error {
+func writePacket(conn net.Conn, p *Packet) error {
 	bodyBytes := []byte(p.Body)
 	p.Length = int32(4 + 4 + len(bodyBytes) + 2)
 
@@ -181,25 +353,23 @@ func (c *Client) writePacketInternal(p *Packet) error {
 	buf.WriteByte(0)
 	buf.WriteByte(0)
 
-	c.conn.SetWriteDeadline(time.Now().Add(DefaultTimeout))
-	_, err := c.conn.Write(buf.Bytes())
+	conn.SetWriteDeadline(time.Now().Add(DefaultTimeout))
+	_, err := conn.Write(buf.Bytes())
 	return err
 }
 
-func (c *Client) readPacketInternal() (*Packet, error) {
-	c.conn.SetReadDeadline(time.Now().Add(DefaultTimeout))
-
+func readPacket(conn net.Conn) (*Packet, error) {
 	var length int32
-	if err := binary.Read(c.conn, binary.LittleEndian, &length); err != nil {
+	if err := binary.Read(conn, binary.LittleEndian, &length); err != nil {
 		return nil, err
 	}
 
-	if length < 10 || length > MaxPacketSize {
+	if length < 10 || length > MaxReadPacketSize {
 		return nil, ErrInvalidPacket
 	}
 
 	data := make([]byte, length)
-	if _, err := io.ReadFull(c.conn, data); err != nil {
+	if _, err := io.ReadFull(conn, data); err != nil {
 		return nil, err
 	}
 
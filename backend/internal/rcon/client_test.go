@@ -0,0 +1,141 @@
+package rcon
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func connect(t *testing.T, port int) *Client {
+	t.Helper()
+	c := NewClient("127.0.0.1", port, "secret")
+	if err := c.Connect(); err != nil {
+		t.Fatalf("Connect: %v", err)
+	}
+	t.Cleanup(func() { c.Close() })
+	return c
+}
+
+func TestExecuteMultiPacket(t *testing.T) {
+	tests := []struct {
+		name string
+		size int
+	}{
+		{name: "empty", size: 0},
+		{name: "one packet", size: sourceChunk - 1},
+		{name: "exactly one packet", size: sourceChunk},
+		{name: "several packets", size: 10*sourceChunk + 3},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			want := strings.Repeat("x", tt.size)
+			c := connect(t, serveSource(t, func(string) string { return want }))
+
+			got, err := c.Execute("status")
+			if err != nil {
+				t.Fatalf("Execute: %v", err)
+			}
+			if got != want {
+				t.Errorf("response = %d bytes, want %d", len(got), len(want))
+			}
+		})
+	}
+}
+
+func TestExecuteConcurrent(t *testing.T) {
+	respond := func(command string) string {
+		return strings.Repeat(command+";", 5)
+	}
+	c := connect(t, serveSource(t, respond))
+
+	const n = 20
+	var wg sync.WaitGroup
+	errs := make(chan error, n)
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			command := fmt.Sprintf("say %d", i)
+			got, err := c.ExecuteContext(context.Background(), command)
+			if err != nil {
+				errs <- err
+				return
+			}
+			if want := respond(command); got != want {
+				errs <- fmt.Errorf("%q: response = %q, want %q", command, got, want)
+			}
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		t.Error(err)
+	}
+}
+
+func TestExecuteConnectionDropped(t *testing.T) {
+	const pending = 3
+
+	// The server authenticates, reads the pending commands and their
+	// sentinels without answering them, then hangs up
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	go func() {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		p, err := readPacket(conn)
+		if err != nil {
+			return
+		}
+		if writePacket(conn, &Packet{RequestID: p.RequestID, Type: PacketTypeAuthResponse}) != nil {
+			return
+		}
+		for i := 0; i < 2*pending; i++ {
+			if _, err := readPacket(conn); err != nil {
+				return
+			}
+		}
+	}()
+
+	c := connect(t, l.Addr().(*net.TCPAddr).Port)
+
+	errs := make(chan error, pending)
+	for i := 0; i < pending; i++ {
+		go func() {
+			_, err := c.ExecuteContext(context.Background(), "status")
+			errs <- err
+		}()
+	}
+
+	for i := 0; i < pending; i++ {
+		select {
+		case err := <-errs:
+			if err == nil {
+				t.Error("command succeeded on a dropped connection")
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("pending command did not fail")
+		}
+	}
+
+	if c.IsConnected() {
+		t.Error("client still reports a connection")
+	}
+	if _, err := c.Execute("status"); !errors.Is(err, ErrNotConnected) {
+		t.Errorf("Execute after drop = %v, want %v", err, ErrNotConnected)
+	}
+}
@@ -0,0 +1,53 @@
+package rcon
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+const (
+	ProtocolSource  = "source"
+	ProtocolWebRCON = "webrcon"
+)
+
+// Conn is an RCON connection, independent of the wire protocol.
+type Conn interface {
+	Connect() error
+	Execute(command string) (string, error)
+	ExecuteContext(ctx context.Context, command string) (string, error)
+	Close() error
+	IsConnected() bool
+	// Ping checks that the server still answers without running a command.
+	Ping(ctx context.Context) error
+	// Subscribe returns a channel of messages the server sends on its own,
+	// such as chat or kill feed lines, and a function that ends the
+	// subscription. Protocols without such messages never send any.
+	Subscribe() (<-chan Message, func())
+}
+
+// Message is an unsolicited message from the server.
+type Message struct {
+	Type string    `json:"type"` // e.g. "chat", "log", "warning", "error"
+	Body string    `json:"body"`
+	Time time.Time `json:"time"`
+}
+
+// Target describes where and how to reach a server's RCON.
+type Target struct {
+	Protocol string
+	Host     string
+	Port     int
+	Password string
+}
+
+// NewConn returns an unconnected Conn speaking the target's protocol.
+func NewConn(target Target) (Conn, error) {
+	switch target.Protocol {
+	case "", ProtocolSource:
+		return NewClient(target.Host, target.Port, target.Password), nil
+	case ProtocolWebRCON:
+		return NewWebClient(target.Host, target.Port, target.Password), nil
+	}
+	return nil, fmt.Errorf("unsupported rcon protocol %q", target.Protocol)
+}
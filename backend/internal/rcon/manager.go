@@ -1,90 +1,446 @@
 package rcon
 
 import (
+	"context"
 	"fmt"
+	"log/slog"
 	"sync"
+	"time"
+
+	"realmops/internal/models"
+)
+
+const (
+	// KeepaliveInterval is how often an idle pooled connection is pinged.
+	KeepaliveInterval = 30 * time.Second
+	// IdleGrace is how long a connection outlives its last user, so that a
+	// page reload or back-to-back commands reuse it.
+	IdleGrace = 30 * time.Second
+
+	// checkInterval is how quickly a dropped connection is noticed
+	checkInterval = 2 * time.Second
+	minBackoff    = time.Second
+	maxBackoff    = time.Minute
 )
 
+// Manager keeps one pooled connection per server. Users Acquire a server's
+// connection and Release it when done; the connection is kept alive,
+// reconnected with backoff when it drops, and closed once the last user has
+// been gone for IdleGrace.
 type Manager struct {
-	connections map[string]*Client
+	connections map[string]*pooledConn
 	mu          sync.RWMutex
 }
 
+type pooledConn struct {
+	serverID string
+	target   Target
+
+	mu          sync.Mutex
+	conn        Conn
+	refs        int
+	state       models.RCONState
+	lastError   string
+	connectedAt *time.Time
+	reconnects  int
+	idleTimer   *time.Timer
+	subs        map[chan Message]struct{}
+
+	// wake nudges the monitor to reconnect right away
+	wake chan struct{}
+	stop chan struct{}
+}
+
 func NewManager() *Manager {
 	return &Manager{
-		connections: make(map[string]*Client),
+		connections: make(map[string]*pooledConn),
 	}
 }
 
-func (m *Manager) Connect(serverID, host string, port int, password string) error {
+// Handle is one user's claim on a pooled connection, returned by Acquire.
+type Handle struct {
+	m    *Manager
+	pc   *pooledConn
+	once sync.Once
+}
+
+// Acquire registers a user of the server's connection, connecting first if
+// there is no connection yet. Every successful Acquire must be paired with a
+// Release of the returned handle.
+func (m *Manager) Acquire(serverID string, target Target) (*Handle, error) {
 	m.mu.Lock()
-	defer m.mu.Unlock()
+	pc, ok := m.connections[serverID]
+	if ok && pc.target != target {
+		// The port or password changed; the old connection is useless
+		m.closeLocked(pc)
+		ok = false
+	}
+	if !ok {
+		conn, err := NewConn(target)
+		if err != nil {
+			m.mu.Unlock()
+			return nil, err
+		}
+		pc = &pooledConn{
+			serverID: serverID,
+			target:   target,
+			conn:     conn,
+			state:    models.RCONStateConnecting,
+			subs:     make(map[chan Message]struct{}),
+			wake:     make(chan struct{}, 1),
+			stop:     make(chan struct{}),
+		}
+		m.connections[serverID] = pc
+
+		// Conns keep their subscribers across reconnects, so one relay
+		// serves the pooled connection's whole life
+		messages, cancel := conn.Subscribe()
+		go pc.relay(messages, cancel)
+	}
 
-	if existing, ok := m.connections[serverID]; ok {
-		if existing.IsConnected() {
-			return nil
+	pc.mu.Lock()
+	pc.refs++
+	if pc.idleTimer != nil {
+		pc.idleTimer.Stop()
+		pc.idleTimer = nil
+	}
+	pc.mu.Unlock()
+	m.mu.Unlock()
+
+	h := &Handle{m: m, pc: pc}
+	if ok {
+		if !pc.connected() {
+			// Give callers an immediate answer rather than waiting out
+			// the backoff
+			pc.nudge()
 		}
-		existing.Close()
-		delete(m.connections, serverID)
+		return h, nil
 	}
 
-	client := NewClient(host, port, password)
-	if err := client.Connect(); err != nil {
-		return fmt.Errorf("failed to connect to rcon: %w", err)
+	err := pc.connect()
+	go pc.monitor()
+	if err != nil {
+		h.Release()
+		return nil, fmt.Errorf("failed to connect to rcon: %w", err)
 	}
+	return h, nil
+}
 
-	m.connections[serverID] = client
-	return nil
+// Release drops the user registered by Acquire. It only affects the
+// connection the handle was acquired on, so releasing after that connection
+// was replaced or disconnected leaves its successor alone. Releasing twice
+// is a no-op.
+func (h *Handle) Release() {
+	h.once.Do(func() {
+		h.m.release(h.pc)
+	})
 }
 
+func (m *Manager) release(pc *pooledConn) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	pc.mu.Lock()
+	defer pc.mu.Unlock()
+
+	if pc.refs > 0 {
+		pc.refs--
+	}
+	if pc.refs > 0 || pc.idleTimer != nil || m.connections[pc.serverID] != pc {
+		return
+	}
+
+	serverID := pc.serverID
+
+	pc.idleTimer = time.AfterFunc(IdleGrace, func() {
+		m.mu.Lock()
+		defer m.mu.Unlock()
+
+		pc.mu.Lock()
+		idle := pc.refs == 0
+		pc.mu.Unlock()
+
+		if idle && m.connections[serverID] == pc {
+			m.closeLocked(pc)
+		}
+	})
+}
+
+// Disconnect closes the server's connection regardless of its users, e.g.
+// when the server is deleted. Users see ErrNotConnected until they acquire
+// it again.
 func (m *Manager) Disconnect(serverID string) error {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
-	if client, ok := m.connections[serverID]; ok {
-		err := client.Close()
-		delete(m.connections, serverID)
-		return err
+	if pc, ok := m.connections[serverID]; ok {
+		m.closeLocked(pc)
 	}
 	return nil
 }
 
-func (m *Manager) Execute(serverID, command string) (string, error) {
+// closeLocked tears a pooled connection down; the caller holds m.mu.
+func (m *Manager) closeLocked(pc *pooledConn) {
+	delete(m.connections, pc.serverID)
+	close(pc.stop)
+
+	pc.mu.Lock()
+	defer pc.mu.Unlock()
+
+	if pc.idleTimer != nil {
+		pc.idleTimer.Stop()
+		pc.idleTimer = nil
+	}
+	pc.conn.Close()
+	pc.state = models.RCONStateDisconnected
+	for sub := range pc.subs {
+		delete(pc.subs, sub)
+		close(sub)
+	}
+}
+
+func (m *Manager) get(serverID string) (*pooledConn, bool) {
 	m.mu.RLock()
-	client, ok := m.connections[serverID]
-	m.mu.RUnlock()
+	defer m.mu.RUnlock()
+	pc, ok := m.connections[serverID]
+	return pc, ok
+}
 
+func (m *Manager) Execute(serverID, command string) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), DefaultTimeout)
+	defer cancel()
+	return m.ExecuteContext(ctx, serverID, command)
+}
+
+// ExecuteContext runs a command on the server's connection, giving up when
+// ctx is done.
+func (m *Manager) ExecuteContext(ctx context.Context, serverID, command string) (string, error) {
+	pc, ok := m.get(serverID)
 	if !ok {
 		return "", ErrNotConnected
 	}
 
-	return client.Execute(command)
+	pc.mu.Lock()
+	conn := pc.conn
+	pc.mu.Unlock()
+
+	response, err := conn.ExecuteContext(ctx, command)
+	if err != nil && !conn.IsConnected() {
+		pc.nudge()
+	}
+	return response, err
 }
 
-func (m *Manager) IsConnected(serverID string) bool {
-	m.mu.RLock()
-	defer m.mu.RUnlock()
+// Run executes a single command on the server's pooled connection,
+// connecting first if nobody else holds it. The connection stays around for
+// IdleGrace, so a script issuing several commands reuses it.
+func (m *Manager) Run(ctx context.Context, serverID string, target Target, command string) (string, error) {
+	h, err := m.Acquire(serverID, target)
+	if err != nil {
+		return "", err
+	}
+	defer h.Release()
+
+	return m.ExecuteContext(ctx, serverID, command)
+}
 
-	if client, ok := m.connections[serverID]; ok {
-		return client.IsConnected()
+// Subscribe returns the unsolicited messages of the server's connection.
+// The subscription survives reconnects and ends when the connection is
+// closed or cancel is called.
+func (m *Manager) Subscribe(serverID string) (<-chan Message, func(), error) {
+	pc, ok := m.get(serverID)
+	if !ok {
+		return nil, nil, ErrNotConnected
 	}
-	return false
+
+	sub := make(chan Message, subscriberBuffer)
+
+	pc.mu.Lock()
+	pc.subs[sub] = struct{}{}
+	pc.mu.Unlock()
+
+	cancel := func() {
+		pc.mu.Lock()
+		defer pc.mu.Unlock()
+		if _, ok := pc.subs[sub]; ok {
+			delete(pc.subs, sub)
+			close(sub)
+		}
+	}
+	return sub, cancel, nil
 }
 
-func (m *Manager) GetConnection(serverID string) (*Client, bool) {
-	m.mu.RLock()
-	defer m.mu.RUnlock()
+func (m *Manager) IsConnected(serverID string) bool {
+	pc, ok := m.get(serverID)
+	return ok && pc.connected()
+}
+
+// Status reports the state of the server's pooled connection, or nil when
+// there is none.
+func (m *Manager) Status(serverID string) *models.RCONStatus {
+	pc, ok := m.get(serverID)
+	if !ok {
+		return nil
+	}
+
+	pc.mu.Lock()
+	defer pc.mu.Unlock()
 
-	client, ok := m.connections[serverID]
-	return client, ok
+	state := pc.state
+	if state == models.RCONStateConnected && !pc.conn.IsConnected() {
+		// Dropped, and the monitor has not noticed yet
+		state = models.RCONStateReconnecting
+	}
+
+	return &models.RCONStatus{
+		State:       state,
+		Protocol:    pc.target.Protocol,
+		Users:       pc.refs,
+		ConnectedAt: pc.connectedAt,
+		Reconnects:  pc.reconnects,
+		LastError:   pc.lastError,
+	}
 }
 
 func (m *Manager) DisconnectAll() {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
-	for id, client := range m.connections {
-		client.Close()
-		delete(m.connections, id)
+	for _, pc := range m.connections {
+		m.closeLocked(pc)
+	}
+}
+
+func (pc *pooledConn) connected() bool {
+	pc.mu.Lock()
+	conn := pc.conn
+	pc.mu.Unlock()
+	return conn.IsConnected()
+}
+
+func (pc *pooledConn) nudge() {
+	select {
+	case pc.wake <- struct{}{}:
+	default:
+	}
+}
+
+// connect (re)establishes the connection.
+func (pc *pooledConn) connect() error {
+	pc.mu.Lock()
+	conn := pc.conn
+	pc.mu.Unlock()
+
+	err := conn.Connect()
+
+	pc.mu.Lock()
+	defer pc.mu.Unlock()
+
+	select {
+	case <-pc.stop:
+		conn.Close()
+		return ErrNotConnected
+	default:
+	}
+
+	if err != nil {
+		pc.state = models.RCONStateReconnecting
+		pc.lastError = err.Error()
+		pc.connectedAt = nil
+		return err
+	}
+
+	now := time.Now()
+	pc.state = models.RCONStateConnected
+	pc.lastError = ""
+	pc.connectedAt = &now
+	return nil
+}
+
+func (pc *pooledConn) relay(messages <-chan Message, cancel func()) {
+	defer cancel()
+
+	for {
+		select {
+		case msg, ok := <-messages:
+			if !ok {
+				return
+			}
+			pc.mu.Lock()
+			for sub := range pc.subs {
+				select {
+				case sub <- msg:
+				default:
+				}
+			}
+			pc.mu.Unlock()
+		case <-pc.stop:
+			return
+		}
+	}
+}
+
+// monitor pings the connection while it is up and reconnects with
+// exponential backoff when it is not, until the connection is closed.
+func (pc *pooledConn) monitor() {
+	backoff := minBackoff
+	lastPing := time.Now()
+	ticker := time.NewTicker(checkInterval)
+	defer ticker.Stop()
+
+	for {
+		if pc.connected() {
+			backoff = minBackoff
+			select {
+			case <-pc.stop:
+				return
+			case <-pc.wake:
+			case <-ticker.C:
+				if time.Since(lastPing) >= KeepaliveInterval {
+					pc.keepalive()
+					lastPing = time.Now()
+				}
+			}
+			continue
+		}
+
+		pc.mu.Lock()
+		pc.state = models.RCONStateReconnecting
+		pc.mu.Unlock()
+
+		select {
+		case <-pc.stop:
+			return
+		case <-pc.wake:
+		case <-time.After(backoff):
+		}
+
+		if err := pc.connect(); err != nil {
+			slog.Debug("rcon reconnect failed", "serverId", pc.serverID, "error", err, "retryIn", backoff)
+			backoff = min(backoff*2, maxBackoff)
+			continue
+		}
+
+		pc.mu.Lock()
+		pc.reconnects++
+		pc.mu.Unlock()
+		slog.Info("rcon reconnected", "serverId", pc.serverID)
+	}
+}
+
+func (pc *pooledConn) keepalive() {
+	pc.mu.Lock()
+	conn := pc.conn
+	pc.mu.Unlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), DefaultTimeout)
+	defer cancel()
+
+	if err := conn.Ping(ctx); err != nil {
+		pc.mu.Lock()
+		pc.lastError = err.Error()
+		pc.mu.Unlock()
+		// A connection that stopped answering is as good as gone
+		conn.Close()
 	}
 }
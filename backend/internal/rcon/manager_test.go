@@ -0,0 +1,161 @@
+package rcon
+
+import (
+	"net"
+	"testing"
+)
+
+// sourceChunk is the body size at which serveSource splits responses into
+// several packets, far below what real servers use so tests can cross it.
+const sourceChunk = 16
+
+// serveSource runs a Source RCON server that accepts any password and
+// answers every command with respond(command), or an empty response if
+// respond is nil. Like real servers it splits long responses over several
+// packets and mirrors empty RESPONSE_VALUE packets, followed by a second
+// packet the way some servers do.
+func serveSource(t *testing.T, respond func(command string) string) int {
+	t.Helper()
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.Close() })
+
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				for {
+					p, err := readPacket(conn)
+					if err != nil {
+						return
+					}
+
+					var replies []*Packet
+					switch p.Type {
+					case PacketTypeAuth:
+						replies = []*Packet{{RequestID: p.RequestID, Type: PacketTypeAuthResponse}}
+					case PacketTypeExecCommand:
+						var body string
+						if respond != nil {
+							body = respond(p.Body)
+						}
+						for {
+							n := min(len(body), sourceChunk)
+							replies = append(replies, &Packet{RequestID: p.RequestID, Type: PacketTypeResponse, Body: body[:n]})
+							body = body[n:]
+							if body == "" {
+								break
+							}
+						}
+					case PacketTypeResponse:
+						replies = []*Packet{
+							{RequestID: p.RequestID, Type: PacketTypeResponse},
+							{RequestID: p.RequestID, Type: PacketTypeResponse, Body: "\x00\x00\x00\x01"},
+						}
+					}
+
+					for _, reply := range replies {
+						if err := writePacket(conn, reply); err != nil {
+							return
+						}
+					}
+				}
+			}()
+		}
+	}()
+
+	return l.Addr().(*net.TCPAddr).Port
+}
+
+func TestRelease(t *testing.T) {
+	tests := []struct {
+		name string
+		// run acquires and releases handles and returns the handles still
+		// held at the end
+		run       func(t *testing.T, m *Manager, target Target) []*Handle
+		wantUsers int
+	}{
+		{
+			name: "stale handle after the target changed",
+			run: func(t *testing.T, m *Manager, target Target) []*Handle {
+				old := acquire(t, m, target)
+				target.Password = "changed"
+				current := acquire(t, m, target)
+				old.Release()
+				return []*Handle{current}
+			},
+			wantUsers: 1,
+		},
+		{
+			name: "stale handle after a disconnect",
+			run: func(t *testing.T, m *Manager, target Target) []*Handle {
+				old := acquire(t, m, target)
+				m.Disconnect("srv")
+				current := acquire(t, m, target)
+				old.Release()
+				return []*Handle{current}
+			},
+			wantUsers: 1,
+		},
+		{
+			name: "released twice",
+			run: func(t *testing.T, m *Manager, target Target) []*Handle {
+				h := acquire(t, m, target)
+				other := acquire(t, m, target)
+				h.Release()
+				h.Release()
+				return []*Handle{other}
+			},
+			wantUsers: 1,
+		},
+		{
+			name: "last user gone",
+			run: func(t *testing.T, m *Manager, target Target) []*Handle {
+				acquire(t, m, target).Release()
+				return nil
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := NewManager()
+			defer m.DisconnectAll()
+			target := Target{Protocol: ProtocolSource, Host: "127.0.0.1", Port: serveSource(t, nil), Password: "secret"}
+
+			held := tt.run(t, m, target)
+
+			status := m.Status("srv")
+			if status == nil {
+				t.Fatal("connection was closed")
+			}
+			if status.Users != tt.wantUsers {
+				t.Errorf("users = %d, want %d", status.Users, tt.wantUsers)
+			}
+
+			pc, _ := m.get("srv")
+			pc.mu.Lock()
+			idle := pc.idleTimer != nil
+			pc.mu.Unlock()
+			if idle != (len(held) == 0) {
+				t.Errorf("idle timer armed = %v with %d users", idle, len(held))
+			}
+		})
+	}
+}
+
+func acquire(t *testing.T, m *Manager, target Target) *Handle {
+	t.Helper()
+	h, err := m.Acquire("srv", target)
+	if err != nil {
+		t.Fatalf("Acquire: %v", err)
+	}
+	return h
+}
@@ -0,0 +1,42 @@
+package rcon
+
+import (
+	"errors"
+
+	"realmops/internal/models"
+)
+
+// TargetFor works out how to reach a server's RCON from its pack manifest:
+// the host port mapped to the pack's RCON port and the password stored in
+// the server variable the pack names.
+func TargetFor(manifest *models.Manifest, server *models.Server) (Target, error) {
+	if !manifest.RCON.Enabled {
+		return Target{}, errors.New("RCON is not enabled for this server type")
+	}
+
+	var port int
+	for _, p := range server.Ports {
+		if p.Name == manifest.RCON.PortName {
+			port = p.HostPort
+			break
+		}
+	}
+	if port == 0 {
+		return Target{}, errors.New("RCON port not found")
+	}
+
+	password := ""
+	if passVar, ok := server.Vars[manifest.RCON.PasswordVariable]; ok {
+		password, _ = passVar.(string)
+	}
+	if password == "" {
+		return Target{}, errors.New("RCON password not configured")
+	}
+
+	return Target{
+		Protocol: manifest.RCON.Protocol,
+		Host:     "127.0.0.1",
+		Port:     port,
+		Password: password,
+	}, nil
+}
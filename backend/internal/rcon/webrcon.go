@@ -0,0 +1,303 @@
+package rcon
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// webRCONName identifies us to the server, which echoes it in its logs.
+const webRCONName = "RealmOps"
+
+// subscriberBuffer is how many broadcasts a slow subscriber may fall
+// behind before messages to it are dropped.
+const subscriberBuffer = 64
+
+type webRCONRequest struct {
+	Identifier int32  `json:"Identifier"`
+	Message    string `json:"Message"`
+	Name       string `json:"Name"`
+}
+
+type webRCONResponse struct {
+	Identifier int32  `json:"Identifier"`
+	Message    string `json:"Message"`
+	Type       string `json:"Type"` // Generic, Log, Warning, Error, Chat, Report
+	Stacktrace string `json:"Stacktrace"`
+}
+
+type webRCONChat struct {
+	Channel  int    `json:"Channel"`
+	Message  string `json:"Message"`
+	UserID   string `json:"UserId"`
+	Username string `json:"Username"`
+}
+
+// WebClient speaks WebRCON, the JSON over WebSocket protocol used by Rust
+// (rcon.web 1). Each command carries an identifier that the server echoes in
+// its reply; messages with any other identifier are broadcasts.
+type WebClient struct {
+	host      string
+	port      int
+	password  string
+	requestID atomic.Int32
+
+	mu      sync.Mutex
+	conn    *websocket.Conn
+	writeMu sync.Mutex
+	pong    chan struct{}
+
+	pendingMu sync.Mutex
+	pending   map[int32]chan webRCONResponse
+
+	subsMu sync.Mutex
+	subs   map[chan Message]struct{}
+}
+
+func NewWebClient(host string, port int, password string) *WebClient {
+	c := &WebClient{
+		host:     host,
+		port:     port,
+		password: password,
+		pending:  make(map[int32]chan webRCONResponse),
+		subs:     make(map[chan Message]struct{}),
+		pong:     make(chan struct{}, 1),
+	}
+	// Rust uses small identifiers for its own messages
+	c.requestID.Store(1000)
+	return c
+}
+
+func (c *WebClient) Connect() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.conn != nil {
+		return nil
+	}
+
+	// The password is the request path; a wrong one closes the socket
+	u := url.URL{
+		Scheme: "ws",
+		Host:   net.JoinHostPort(c.host, strconv.Itoa(c.port)),
+		Path:   "/" + c.password,
+	}
+
+	dialer := websocket.Dialer{HandshakeTimeout: DefaultTimeout}
+	conn, _, err := dialer.Dial(u.String(), nil)
+	if err != nil {
+		return fmt.Errorf("failed to connect to webrcon: %w", err)
+	}
+
+	conn.SetPongHandler(func(string) error {
+		select {
+		case c.pong <- struct{}{}:
+		default:
+		}
+		return nil
+	})
+
+	c.conn = conn
+	go c.readLoop(conn)
+
+	return nil
+}
+
+func (c *WebClient) Execute(command string) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), DefaultTimeout)
+	defer cancel()
+	return c.ExecuteContext(ctx, command)
+}
+
+func (c *WebClient) ExecuteContext(ctx context.Context, command string) (string, error) {
+	c.mu.Lock()
+	conn := c.conn
+	c.mu.Unlock()
+
+	if conn == nil {
+		return "", ErrNotConnected
+	}
+
+	id := c.requestID.Add(1)
+	reply := make(chan webRCONResponse, 1)
+
+	c.pendingMu.Lock()
+	c.pending[id] = reply
+	c.pendingMu.Unlock()
+
+	defer func() {
+		c.pendingMu.Lock()
+		delete(c.pending, id)
+		c.pendingMu.Unlock()
+	}()
+
+	data, _ := json.Marshal(webRCONRequest{Identifier: id, Message: command, Name: webRCONName})
+
+	c.writeMu.Lock()
+	conn.SetWriteDeadline(time.Now().Add(DefaultTimeout))
+	err := conn.WriteMessage(websocket.TextMessage, data)
+	c.writeMu.Unlock()
+	if err != nil {
+		return "", fmt.Errorf("failed to send command: %w", err)
+	}
+
+	select {
+	case resp, ok := <-reply:
+		if !ok {
+			return "", ErrNotConnected
+		}
+		return resp.Message, nil
+	case <-ctx.Done():
+		return "", ctx.Err()
+	}
+}
+
+// Ping sends a WebSocket ping and waits for the pong.
+func (c *WebClient) Ping(ctx context.Context) error {
+	c.mu.Lock()
+	conn := c.conn
+	c.mu.Unlock()
+
+	if conn == nil {
+		return ErrNotConnected
+	}
+
+	select {
+	case <-c.pong:
+	default:
+	}
+
+	if err := conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(DefaultTimeout)); err != nil {
+		return fmt.Errorf("failed to send ping: %w", err)
+	}
+
+	select {
+	case <-c.pong:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (c *WebClient) readLoop(conn *websocket.Conn) {
+	defer c.drop(conn)
+
+	for {
+		_, data, err := conn.ReadMessage()
+		if err != nil {
+			return
+		}
+
+		var resp webRCONResponse
+		if err := json.Unmarshal(data, &resp); err != nil {
+			continue
+		}
+
+		c.pendingMu.Lock()
+		reply, ok := c.pending[resp.Identifier]
+		if ok {
+			delete(c.pending, resp.Identifier)
+		}
+		c.pendingMu.Unlock()
+
+		if ok {
+			reply <- resp
+			continue
+		}
+
+		c.broadcast(toMessage(resp))
+	}
+}
+
+// drop forgets a dead connection and fails the commands waiting on it.
+func (c *WebClient) drop(conn *websocket.Conn) {
+	conn.Close()
+
+	c.mu.Lock()
+	if c.conn == conn {
+		c.conn = nil
+	}
+	c.mu.Unlock()
+
+	c.pendingMu.Lock()
+	for id, reply := range c.pending {
+		delete(c.pending, id)
+		close(reply)
+	}
+	c.pendingMu.Unlock()
+}
+
+func toMessage(resp webRCONResponse) Message {
+	msg := Message{
+		Type: strings.ToLower(resp.Type),
+		Body: resp.Message,
+		Time: time.Now(),
+	}
+	if msg.Type == "chat" {
+		var chat webRCONChat
+		if err := json.Unmarshal([]byte(resp.Message), &chat); err == nil {
+			msg.Body = fmt.Sprintf("%s: %s", chat.Username, chat.Message)
+		}
+	}
+	if msg.Type == "" {
+		msg.Type = "generic"
+	}
+	return msg
+}
+
+func (c *WebClient) broadcast(msg Message) {
+	c.subsMu.Lock()
+	defer c.subsMu.Unlock()
+
+	for sub := range c.subs {
+		select {
+		case sub <- msg:
+		default:
+		}
+	}
+}
+
+func (c *WebClient) Subscribe() (<-chan Message, func()) {
+	sub := make(chan Message, subscriberBuffer)
+
+	c.subsMu.Lock()
+	c.subs[sub] = struct{}{}
+	c.subsMu.Unlock()
+
+	var once sync.Once
+	return sub, func() {
+		once.Do(func() {
+			c.subsMu.Lock()
+			delete(c.subs, sub)
+			close(sub)
+			c.subsMu.Unlock()
+		})
+	}
+}
+
+func (c *WebClient) Close() error {
+	c.mu.Lock()
+	conn := c.conn
+	c.conn = nil
+	c.mu.Unlock()
+
+	if conn == nil {
+		return nil
+	}
+	return conn.Close()
+}
+
+func (c *WebClient) IsConnected() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.conn != nil
+}
@@ -0,0 +1,408 @@
+// Package fake provides an in-memory runtime.Runtime for exercising the
+// server manager without a container engine.
+package fake
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"sync"
+
+	"github.com/docker/docker/pkg/stdcopy"
+	"realmops/internal/models"
+	"realmops/internal/runtime"
+)
+
+var _ runtime.Runtime = (*Runtime)(nil)
+
+// Container is the in-memory state of a created container.
+type Container struct {
+	ID       string
+	Options  runtime.CreateContainerOptions
+	Running  bool
+	Networks map[string][]string // network name -> aliases
+	Logs     []string
+	Health   string
+}
+
+// Runtime records every call and keeps containers, images and networks in
+// memory. Errors can be injected per operation through FailOn.
+type Runtime struct {
+	mu         sync.Mutex
+	nextID     int
+	containers map[string]*Container
+	networks   map[string]map[string]string
+	images     map[string]bool
+	calls      []string
+
+	// FailOn maps an operation name (e.g. "StartContainer") to the error
+	// it should return.
+	FailOn map[string]error
+	// ExecOutput is returned as the output of every Exec session.
+	ExecOutput string
+}
+
+func New() *Runtime {
+	return &Runtime{
+		containers: make(map[string]*Container),
+		networks:   make(map[string]map[string]string),
+		images:     make(map[string]bool),
+		FailOn:     make(map[string]error),
+	}
+}
+
+func (r *Runtime) record(op string) error {
+	r.calls = append(r.calls, op)
+	return r.FailOn[op]
+}
+
+// Calls returns the operations performed so far, in order.
+func (r *Runtime) Calls() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]string(nil), r.calls...)
+}
+
+// Container returns a copy of the container with the given ID or name.
+func (r *Runtime) Container(idOrName string) (Container, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	c := r.lookup(idOrName)
+	if c == nil {
+		return Container{}, false
+	}
+	return *c, true
+}
+
+// Networks returns the names of existing networks.
+func (r *Runtime) Networks() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var names []string
+	for name := range r.networks {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// AppendLogs adds output lines to a container's log.
+func (r *Runtime) AppendLogs(containerID string, lines ...string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if c := r.lookup(containerID); c != nil {
+		c.Logs = append(c.Logs, lines...)
+	}
+}
+
+// SetHealth sets the healthcheck status InspectContainer reports for a
+// container.
+func (r *Runtime) SetHealth(containerID, status string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if c := r.lookup(containerID); c != nil {
+		c.Health = status
+	}
+}
+
+func (r *Runtime) lookup(idOrName string) *Container {
+	if c, ok := r.containers[idOrName]; ok {
+		return c
+	}
+	for _, c := range r.containers {
+		if c.Options.Name == idOrName {
+			return c
+		}
+	}
+	return nil
+}
+
+func (r *Runtime) Name() string      { return "fake" }
+func (r *Runtime) IsConnected() bool { return true }
+func (r *Runtime) Close() error      { return nil }
+
+func (r *Runtime) PullImage(ctx context.Context, imageName string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if err := r.record("PullImage"); err != nil {
+		return err
+	}
+	r.images[imageName] = true
+	return nil
+}
+
+func (r *Runtime) CreateContainer(ctx context.Context, opts runtime.CreateContainerOptions) (string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if err := r.record("CreateContainer"); err != nil {
+		return "", err
+	}
+	if opts.Name != "" && r.lookup(opts.Name) != nil {
+		return "", fmt.Errorf("container name %s already in use", opts.Name)
+	}
+	if !r.images[opts.Image] {
+		return "", fmt.Errorf("image %s not pulled", opts.Image)
+	}
+
+	r.nextID++
+	c := &Container{
+		ID:       fmt.Sprintf("fake-%d", r.nextID),
+		Options:  opts,
+		Networks: make(map[string][]string),
+	}
+	if opts.Network != "" {
+		if _, ok := r.networks[opts.Network]; !ok {
+			return "", fmt.Errorf("network %s not found", opts.Network)
+		}
+		c.Networks[opts.Network] = opts.NetworkAliases
+	}
+	r.containers[c.ID] = c
+	return c.ID, nil
+}
+
+func (r *Runtime) StartContainer(ctx context.Context, containerID string) error {
+	return r.setRunning("StartContainer", containerID, true)
+}
+
+func (r *Runtime) StopContainer(ctx context.Context, containerID string, timeout int) error {
+	return r.setRunning("StopContainer", containerID, false)
+}
+
+func (r *Runtime) setRunning(op, containerID string, running bool) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if err := r.record(op); err != nil {
+		return err
+	}
+	c := r.lookup(containerID)
+	if c == nil {
+		return fmt.Errorf("no such container: %s", containerID)
+	}
+	c.Running = running
+	return nil
+}
+
+func (r *Runtime) RemoveContainer(ctx context.Context, containerID string, force bool) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if err := r.record("RemoveContainer"); err != nil {
+		return err
+	}
+	c := r.lookup(containerID)
+	if c == nil {
+		return fmt.Errorf("no such container: %s", containerID)
+	}
+	if c.Running && !force {
+		return fmt.Errorf("container %s is running", containerID)
+	}
+	delete(r.containers, c.ID)
+	return nil
+}
+
+func (r *Runtime) InspectContainer(ctx context.Context, containerID string) (*runtime.ContainerInfo, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if err := r.record("InspectContainer"); err != nil {
+		return nil, err
+	}
+	c := r.lookup(containerID)
+	if c == nil {
+		return nil, fmt.Errorf("no such container: %s", containerID)
+	}
+	state := models.ServerStateStopped
+	if c.Running {
+		state = models.ServerStateRunning
+	}
+	return &runtime.ContainerInfo{ID: c.ID, State: state, Tty: c.Options.Tty, Health: c.Health}, nil
+}
+
+func (r *Runtime) GetContainerStats(ctx context.Context, containerID string) (*models.ServerStats, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if err := r.record("GetContainerStats"); err != nil {
+		return nil, err
+	}
+	if r.lookup(containerID) == nil {
+		return nil, fmt.Errorf("no such container: %s", containerID)
+	}
+	return &models.ServerStats{}, nil
+}
+
+// GetContainerLogs returns the container's log lines as a raw (TTY style)
+// stream. Only Tail is honored; the reader ends after the current lines.
+func (r *Runtime) GetContainerLogs(ctx context.Context, containerID string, opts runtime.LogsOptions) (io.ReadCloser, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if err := r.record("GetContainerLogs"); err != nil {
+		return nil, err
+	}
+	c := r.lookup(containerID)
+	if c == nil {
+		return nil, fmt.Errorf("no such container: %s", containerID)
+	}
+	lines := c.Logs
+	if n, err := strconv.Atoi(opts.Tail); err == nil && n >= 0 && n < len(lines) {
+		lines = lines[len(lines)-n:]
+	}
+	// Like Docker, logs of containers without a TTY are multiplexed
+	var buf bytes.Buffer
+	var w io.Writer = &buf
+	if !c.Options.Tty {
+		w = stdcopy.NewStdWriter(&buf, stdcopy.Stdout)
+	}
+	for _, line := range lines {
+		io.WriteString(w, line+"\n")
+	}
+	return io.NopCloser(&buf), nil
+}
+
+func (r *Runtime) ListContainersByLabel(ctx context.Context, labels map[string]string) ([]string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if err := r.record("ListContainersByLabel"); err != nil {
+		return nil, err
+	}
+	var ids []string
+	for id, c := range r.containers {
+		match := true
+		for k, v := range labels {
+			if c.Options.Labels[k] != v {
+				match = false
+				break
+			}
+		}
+		if match {
+			ids = append(ids, id)
+		}
+	}
+	sort.Strings(ids)
+	return ids, nil
+}
+
+func (r *Runtime) Exec(ctx context.Context, containerID string, opts runtime.ExecOptions) (runtime.ExecSession, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if err := r.record("Exec"); err != nil {
+		return nil, err
+	}
+	c := r.lookup(containerID)
+	if c == nil {
+		return nil, fmt.Errorf("no such container: %s", containerID)
+	}
+	if !c.Running {
+		return nil, fmt.Errorf("container %s is not running", containerID)
+	}
+	return &execSession{output: bytes.NewBufferString(r.ExecOutput)}, nil
+}
+
+func (r *Runtime) Attach(ctx context.Context, containerID string) (io.ReadWriteCloser, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if err := r.record("Attach"); err != nil {
+		return nil, err
+	}
+	c := r.lookup(containerID)
+	if c == nil {
+		return nil, fmt.Errorf("no such container: %s", containerID)
+	}
+	if !c.Running {
+		return nil, fmt.Errorf("container %s is not running", containerID)
+	}
+	var buf bytes.Buffer
+	for _, line := range c.Logs {
+		buf.WriteString(line + "\n")
+	}
+	return &execSession{output: &buf}, nil
+}
+
+func (r *Runtime) EnsureNetwork(ctx context.Context, name string, labels map[string]string) (string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if err := r.record("EnsureNetwork"); err != nil {
+		return "", err
+	}
+	if _, ok := r.networks[name]; !ok {
+		r.networks[name] = labels
+	}
+	return name, nil
+}
+
+func (r *Runtime) RemoveNetwork(ctx context.Context, name string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if err := r.record("RemoveNetwork"); err != nil {
+		return err
+	}
+	if r.networkInUse(name) {
+		return fmt.Errorf("network %s has active endpoints", name)
+	}
+	delete(r.networks, name)
+	return nil
+}
+
+func (r *Runtime) RemoveNetworkIfUnused(ctx context.Context, name string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if err := r.record("RemoveNetworkIfUnused"); err != nil {
+		return err
+	}
+	if !r.networkInUse(name) {
+		delete(r.networks, name)
+	}
+	return nil
+}
+
+func (r *Runtime) networkInUse(name string) bool {
+	for _, c := range r.containers {
+		if _, ok := c.Networks[name]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *Runtime) ConnectNetwork(ctx context.Context, networkName, containerID string, aliases []string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if err := r.record("ConnectNetwork"); err != nil {
+		return err
+	}
+	c := r.lookup(containerID)
+	if c == nil {
+		return fmt.Errorf("no such container: %s", containerID)
+	}
+	if _, ok := r.networks[networkName]; !ok {
+		return fmt.Errorf("network %s not found", networkName)
+	}
+	c.Networks[networkName] = aliases
+	return nil
+}
+
+func (r *Runtime) DisconnectNetwork(ctx context.Context, networkName, containerID string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if err := r.record("DisconnectNetwork"); err != nil {
+		return err
+	}
+	if c := r.lookup(containerID); c != nil {
+		delete(c.Networks, networkName)
+	}
+	return nil
+}
+
+// execSession plays back canned output and collects whatever is written.
+type execSession struct {
+	output *bytes.Buffer
+	Input  bytes.Buffer
+}
+
+func (e *execSession) Read(b []byte) (int, error)  { return e.output.Read(b) }
+func (e *execSession) Write(b []byte) (int, error) { return e.Input.Write(b) }
+func (e *execSession) Close() error                { return nil }
+
+func (e *execSession) Resize(ctx context.Context, cols, rows uint) error { return nil }
+
+func (e *execSession) ExitCode(ctx context.Context) (int, error) { return 0, nil }
@@ -0,0 +1,119 @@
+package runtime
+
+import (
+	"context"
+	"io"
+	"time"
+
+	"realmops/internal/models"
+)
+
+// Runtime is a container engine game servers run on. Docker is the default
+// implementation; Podman is supported through its Docker-compatible API.
+type Runtime interface {
+	// Name identifies the engine, e.g. "docker" or "podman".
+	Name() string
+	IsConnected() bool
+	Close() error
+
+	PullImage(ctx context.Context, imageName string) error
+	CreateContainer(ctx context.Context, opts CreateContainerOptions) (string, error)
+	StartContainer(ctx context.Context, containerID string) error
+	StopContainer(ctx context.Context, containerID string, timeout int) error
+	RemoveContainer(ctx context.Context, containerID string, force bool) error
+	InspectContainer(ctx context.Context, containerID string) (*ContainerInfo, error)
+	GetContainerStats(ctx context.Context, containerID string) (*models.ServerStats, error)
+	// GetContainerLogs returns the container's output with an RFC 3339
+	// timestamp in front of every line, multiplexed into stdout and stderr
+	// frames unless the container has a TTY.
+	GetContainerLogs(ctx context.Context, containerID string, opts LogsOptions) (io.ReadCloser, error)
+	ListContainersByLabel(ctx context.Context, labels map[string]string) ([]string, error)
+	Exec(ctx context.Context, containerID string, opts ExecOptions) (ExecSession, error)
+	// Attach connects to the main process of a running container. Reads
+	// return its combined output, writes go to its stdin.
+	Attach(ctx context.Context, containerID string) (io.ReadWriteCloser, error)
+
+	EnsureNetwork(ctx context.Context, name string, labels map[string]string) (string, error)
+	RemoveNetwork(ctx context.Context, name string) error
+	RemoveNetworkIfUnused(ctx context.Context, name string) error
+	ConnectNetwork(ctx context.Context, networkName, containerID string, aliases []string) error
+	DisconnectNetwork(ctx context.Context, networkName, containerID string) error
+}
+
+type CreateContainerOptions struct {
+	Name       string
+	Image      string
+	Workdir    string
+	User       string
+	Env        []string
+	Command    []string
+	Entrypoint []string
+	Mounts     []MountConfig
+	Ports      []PortMapping
+	Labels     map[string]string
+	// Network is the network the container is attached to at creation.
+	// Empty means the default bridge.
+	Network        string
+	NetworkAliases []string
+	// UsernsMode sets the user namespace mode, e.g. "keep-id" on rootless Podman.
+	UsernsMode string
+	// OpenStdin keeps stdin open so a console can be attached later.
+	OpenStdin bool
+	Tty       bool
+}
+
+type LogsOptions struct {
+	// Tail is how many lines to return from the end of the log, e.g. "100",
+	// or "all".
+	Tail   string
+	Follow bool
+	// Since skips older output when set.
+	Since time.Time
+}
+
+type MountConfig struct {
+	Source   string
+	Target   string
+	ReadOnly bool
+}
+
+type PortMapping struct {
+	ContainerPort int
+	HostPort      int
+	Protocol      string
+}
+
+type ContainerInfo struct {
+	ID       string
+	State    models.ServerState
+	ExitCode int
+	Started  string
+	Finished string
+	// Tty is set for containers with a pseudo terminal, whose logs are one
+	// raw stream instead of multiplexed stdout and stderr frames
+	Tty bool
+	// Health is the status of the image's healthcheck: starting, healthy
+	// or unhealthy, or empty for images without one
+	Health string
+}
+
+type ExecOptions struct {
+	Cmd        []string
+	Env        []string
+	User       string
+	WorkingDir string
+	// Tty allocates a pseudo terminal; the stream is then raw instead of
+	// multiplexed into stdout and stderr frames.
+	Tty  bool
+	Cols uint
+	Rows uint
+}
+
+// ExecSession is a process started inside a running container. Reads return
+// its output and writes go to its stdin.
+type ExecSession interface {
+	io.ReadWriteCloser
+	Resize(ctx context.Context, cols, rows uint) error
+	// ExitCode reports the exit code once the process has finished.
+	ExitCode(ctx context.Context) (int, error)
+}
@@ -0,0 +1,96 @@
+package server
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"realmops/internal/events"
+	"realmops/internal/models"
+)
+
+// healthInterval is how often MonitorHealth inspects running containers.
+const healthInterval = 10 * time.Second
+
+// Docker healthcheck statuses reported in runtime.ContainerInfo.Health.
+const (
+	healthHealthy   = "healthy"
+	healthUnhealthy = "unhealthy"
+)
+
+// MonitorHealth watches the containers of running servers until ctx is
+// done. A server whose container exited on its own is marked as errored and
+// a crash is published; changes of a container's healthcheck status are
+// published as they happen.
+func (m *Manager) MonitorHealth(ctx context.Context) {
+	ticker := time.NewTicker(healthInterval)
+	defer ticker.Stop()
+
+	// health holds the last healthcheck verdict of each server; a server's
+	// first verdict only records it
+	health := make(map[string]string)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		m.checkHealth(ctx, health)
+	}
+}
+
+func (m *Manager) checkHealth(ctx context.Context, health map[string]string) {
+	running, err := m.RunningContainers(ctx)
+	if err != nil {
+		slog.Error("failed to list running servers", "error", err)
+		return
+	}
+	for id := range health {
+		if _, ok := running[id]; !ok {
+			delete(health, id)
+		}
+	}
+
+	for id, containerID := range running {
+		info, err := m.runtime.InspectContainer(ctx, containerID)
+		if err != nil {
+			continue
+		}
+
+		if info.State == models.ServerStateStopped || info.State == models.ServerStateError {
+			m.markCrashed(ctx, id, info.ExitCode, info.Finished)
+			delete(health, id)
+			continue
+		}
+
+		// Only a verdict counts: images without a healthcheck report
+		// nothing, and "starting" lasts until the first check passes
+		if info.Health != healthHealthy && info.Health != healthUnhealthy {
+			continue
+		}
+		if was, known := health[id]; known && was != info.Health {
+			m.events.Publish(events.ServerHealth, id, map[string]any{
+				"healthy": info.Health == healthHealthy,
+				"status":  info.Health,
+			})
+		}
+		health[id] = info.Health
+	}
+}
+
+func (m *Manager) markCrashed(ctx context.Context, id string, exitCode int, finishedAt string) {
+	// The server may have been stopped since it was listed
+	srv, err := m.GetServer(ctx, id)
+	if err != nil || srv.State != models.ServerStateRunning {
+		return
+	}
+
+	slog.Warn("server container exited unexpectedly", "serverId", id, "exitCode", exitCode)
+	m.updateServerState(id, models.ServerStateError, models.ServerStateStopped)
+	m.events.Publish(events.ServerCrashed, id, map[string]any{
+		"name":       srv.Name,
+		"exitCode":   exitCode,
+		"finishedAt": finishedAt,
+	})
+}
@@ -0,0 +1,67 @@
+package server
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"realmops/internal/events"
+)
+
+func TestCheckHealth(t *testing.T) {
+	tests := []struct {
+		name     string
+		statuses []string
+		want     []string
+	}{
+		{
+			name:     "no healthcheck",
+			statuses: []string{"", "", ""},
+		},
+		{
+			name:     "becomes healthy",
+			statuses: []string{"starting", "healthy", "healthy"},
+		},
+		{
+			name:     "turns unhealthy",
+			statuses: []string{"healthy", "unhealthy", "unhealthy"},
+			want:     []string{"unhealthy"},
+		},
+		{
+			name:     "recovers",
+			statuses: []string{"healthy", "unhealthy", "starting", "healthy"},
+			want:     []string{"unhealthy", "healthy"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m, rt := newTestManager(t)
+			bus := events.NewBus(0)
+			m.SetEvents(bus)
+			server := installServer(t, m)
+
+			sub, _, _ := bus.Subscribe(events.Filter{Types: []string{events.ServerHealth}}, 0)
+			defer sub.Cancel()
+
+			health := make(map[string]string)
+			for _, status := range tt.statuses {
+				rt.SetHealth(server.DockerContainerID, status)
+				m.checkHealth(context.Background(), health)
+			}
+
+			var got []string
+			for len(sub.C) > 0 {
+				e := <-sub.C
+				data := e.Data.(map[string]any)
+				if healthy := data["healthy"].(bool); healthy != (data["status"] == "healthy") {
+					t.Errorf("healthy = %v for status %v", healthy, data["status"])
+				}
+				got = append(got, data["status"].(string))
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("events = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -3,9 +3,11 @@ package server
 import (
 	"bytes"
 	"context"
+	"database/sql"
 	"encoding/json"
 	"fmt"
 	"io"
+	"log/slog"
 	"net/http"
 	"os"
 	"path/filepath"
@@ -14,25 +16,27 @@ import (
 	"time"
 
 	"realmops/internal/db"
-	"realmops/internal/docker"
+	"realmops/internal/events"
 	"realmops/internal/jobs"
 	"realmops/internal/models"
 	"realmops/internal/packs"
 	"realmops/internal/ports"
+	"realmops/internal/runtime"
 )
 
 type Manager struct {
-	db            *db.DB
-	docker        *docker.Provider
-	packs         *packs.Loader
-	ports         *ports.Allocator
-	jobs          *jobs.Runner
-	dataDir       string
+	db      *db.DB
+	runtime runtime.Runtime
+	packs   *packs.Loader
+	ports   *ports.Allocator
+	jobs    *jobs.Runner
+	dataDir string
+	events  *events.Bus
 }
 
 func NewManager(
 	database *db.DB,
-	dockerProvider *docker.Provider,
+	containerRuntime runtime.Runtime,
 	packLoader *packs.Loader,
 	portAllocator *ports.Allocator,
 	jobRunner *jobs.Runner,
@@ -40,7 +44,7 @@ func NewManager(
 ) *Manager {
 	m := &Manager{
 		db:      database,
-		docker:  dockerProvider,
+		runtime: containerRuntime,
 		packs:   packLoader,
 		ports:   portAllocator,
 		jobs:    jobRunner,
@@ -51,19 +55,33 @@ func NewManager(
 	jobRunner.RegisterHandler(models.JobTypeUpdate, m.handleUpdateJob)
 	jobRunner.RegisterHandler(models.JobTypeBackup, m.handleBackupJob)
 	jobRunner.RegisterHandler(models.JobTypeRestore, m.handleRestoreJob)
+	jobRunner.RegisterHandler(models.JobTypePortMigrate, m.handlePortMigrateJob)
+	jobRunner.SetInterruptHandler(m.handleInterruptedJob)
 
 	return m
 }
 
+// SetEvents publishes state changes on bus.
+func (m *Manager) SetEvents(bus *events.Bus) {
+	m.events = bus
+}
+
 type CreateServerRequest struct {
 	Name      string         `json:"name"`
 	PackID    string         `json:"packId"`
 	Variables map[string]any `json:"variables"`
+	// Networks lists shared networks the server joins in addition to its
+	// own private network, e.g. to let a proxy reach backend servers.
+	Networks []string `json:"networks,omitempty"`
+	// Ports maps "user" mode port names to the requested host port. Ports
+	// left out are allocated automatically.
+	Ports map[string]int `json:"ports,omitempty"`
 }
 
 type UpdateServerRequest struct {
 	Name      *string        `json:"name,omitempty"`
 	Variables map[string]any `json:"variables,omitempty"`
+	Networks  *[]string      `json:"networks,omitempty"`
 }
 
 func (m *Manager) CreateServer(ctx context.Context, req CreateServerRequest) (*models.Server, error) {
@@ -76,25 +94,15 @@ func (m *Manager) CreateServer(ctx context.Context, req CreateServerRequest) (*m
 		return nil, fmt.Errorf("invalid variables: %w", err)
 	}
 
-	serverID := generateServerID()
-
-	allocatedPorts, err := m.ports.AllocatePorts(serverID, len(manifest.Ports))
+	networks, err := normalizeNetworks(req.Networks)
 	if err != nil {
-		return nil, fmt.Errorf("failed to allocate ports: %w", err)
+		return nil, err
 	}
 
-	var serverPorts []models.ServerPort
-	for i, portConfig := range manifest.Ports {
-		serverPorts = append(serverPorts, models.ServerPort{
-			ServerID:      serverID,
-			Name:          portConfig.Name,
-			Protocol:      portConfig.Protocol,
-			ContainerPort: portConfig.ContainerPort,
-			HostPort:      allocatedPorts[i],
-		})
-	}
+	serverID := generateServerID()
 
 	varsJSON, _ := json.Marshal(req.Variables)
+	networksJSON, _ := json.Marshal(networks)
 	server := &models.Server{
 		ID:           serverID,
 		Name:         req.Name,
@@ -104,45 +112,69 @@ func (m *Manager) CreateServer(ctx context.Context, req CreateServerRequest) (*m
 		VarsJSON:     string(varsJSON),
 		State:        models.ServerStateStopped,
 		DesiredState: models.ServerStateStopped,
-		Ports:        serverPorts,
+		Networks:     networks,
+		NetworksJSON: string(networksJSON),
 		CreatedAt:    time.Now(),
 		UpdatedAt:    time.Now(),
 	}
 
-	_, err = m.db.Exec(`
-		INSERT INTO servers (id, name, pack_id, pack_version, vars_json, state, desired_state, created_at, updated_at)
-		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
-	`, server.ID, server.Name, server.PackID, server.PackVersion, server.VarsJSON, server.State, server.DesiredState, server.CreatedAt, server.UpdatedAt)
-	if err != nil {
-		m.ports.ReleasePorts(serverID)
-		return nil, err
-	}
+	// The server row, its ports, their reservations and the install job are
+	// created together so a failure never leaves a half-created server.
+	err = m.ports.WithTx(func(tx *sql.Tx) error {
+		_, err := tx.Exec(`
+			INSERT INTO servers (id, name, pack_id, pack_version, vars_json, networks_json, state, desired_state, created_at, updated_at)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		`, server.ID, server.Name, server.PackID, server.PackVersion, server.VarsJSON, server.NetworksJSON, server.State, server.DesiredState, server.CreatedAt, server.UpdatedAt)
+		if err != nil {
+			return err
+		}
 
-	for _, port := range serverPorts {
-		_, err = m.db.Exec(`
-			INSERT INTO server_ports (server_id, name, protocol, container_port, host_port)
-			VALUES (?, ?, ?, ?, ?)
-		`, port.ServerID, port.Name, port.Protocol, port.ContainerPort, port.HostPort)
+		specs := manifestPorts(manifest)
+		allocatedPorts, err := m.allocateServerPorts(tx, serverID, specs, req.Ports)
 		if err != nil {
-			return nil, err
+			return err
+		}
+
+		for i, spec := range specs {
+			port := models.ServerPort{
+				ServerID:      serverID,
+				Service:       spec.Service,
+				Name:          spec.Config.Name,
+				Protocol:      spec.Config.Protocol,
+				ContainerPort: spec.Config.ContainerPort,
+				HostPort:      allocatedPorts[i],
+			}
+			_, err = tx.Exec(`
+				INSERT INTO server_ports (server_id, service, name, protocol, container_port, host_port)
+				VALUES (?, ?, ?, ?, ?, ?)
+			`, port.ServerID, port.Service, port.Name, port.Protocol, port.ContainerPort, port.HostPort)
+			if err != nil {
+				return err
+			}
+			server.Ports = append(server.Ports, port)
 		}
-	}
 
-	if _, err := m.jobs.CreateJob(models.JobTypeInstall, serverID); err != nil {
+		_, err = m.jobs.CreateJobTx(tx, models.JobTypeInstall, serverID)
+		return err
+	})
+	if err != nil {
 		return nil, err
 	}
 
 	return server, nil
 }
 
-func (m *Manager) GetServer(ctx context.Context, id string) (*models.Server, error) {
+const serverColumns = `id, name, pack_id, pack_version, vars_json, networks_json, state, desired_state, docker_container_id, created_at, updated_at`
+
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+func scanServer(row rowScanner) (*models.Server, error) {
 	var server models.Server
 	var dockerContainerID *string
 
-	err := m.db.QueryRow(`
-		SELECT id, name, pack_id, pack_version, vars_json, state, desired_state, docker_container_id, created_at, updated_at
-		FROM servers WHERE id = ?
-	`, id).Scan(&server.ID, &server.Name, &server.PackID, &server.PackVersion, &server.VarsJSON, &server.State, &server.DesiredState, &dockerContainerID, &server.CreatedAt, &server.UpdatedAt)
+	err := row.Scan(&server.ID, &server.Name, &server.PackID, &server.PackVersion, &server.VarsJSON, &server.NetworksJSON, &server.State, &server.DesiredState, &dockerContainerID, &server.CreatedAt, &server.UpdatedAt)
 	if err != nil {
 		return nil, err
 	}
@@ -152,6 +184,19 @@ func (m *Manager) GetServer(ctx context.Context, id string) (*models.Server, err
 	}
 
 	json.Unmarshal([]byte(server.VarsJSON), &server.Vars)
+	json.Unmarshal([]byte(server.NetworksJSON), &server.Networks)
+	if server.Networks == nil {
+		server.Networks = []string{}
+	}
+
+	return &server, nil
+}
+
+func (m *Manager) GetServer(ctx context.Context, id string) (*models.Server, error) {
+	server, err := scanServer(m.db.QueryRow(`SELECT `+serverColumns+` FROM servers WHERE id = ?`, id))
+	if err != nil {
+		return nil, err
+	}
 
 	ports, err := m.getServerPorts(id)
 	if err != nil {
@@ -159,19 +204,22 @@ func (m *Manager) GetServer(ctx context.Context, id string) (*models.Server, err
 	}
 	server.Ports = ports
 
+	services, err := m.getServerServices(id)
+	if err != nil {
+		return nil, err
+	}
+	server.Services = services
+
 	if server.DockerContainerID != "" && server.State == models.ServerStateRunning {
-		stats, _ := m.docker.GetContainerStats(ctx, server.DockerContainerID)
+		stats, _ := m.runtime.GetContainerStats(ctx, server.DockerContainerID)
 		server.Stats = stats
 	}
 
-	return &server, nil
+	return server, nil
 }
 
 func (m *Manager) ListServers(ctx context.Context) ([]*models.Server, error) {
-	rows, err := m.db.Query(`
-		SELECT id, name, pack_id, pack_version, vars_json, state, desired_state, docker_container_id, created_at, updated_at
-		FROM servers ORDER BY created_at DESC
-	`)
+	rows, err := m.db.Query(`SELECT ` + serverColumns + ` FROM servers ORDER BY created_at DESC`)
 	if err != nil {
 		return nil, err
 	}
@@ -179,29 +227,49 @@ func (m *Manager) ListServers(ctx context.Context) ([]*models.Server, error) {
 
 	var servers []*models.Server
 	for rows.Next() {
-		var server models.Server
-		var dockerContainerID *string
-		if err := rows.Scan(&server.ID, &server.Name, &server.PackID, &server.PackVersion, &server.VarsJSON, &server.State, &server.DesiredState, &dockerContainerID, &server.CreatedAt, &server.UpdatedAt); err != nil {
+		server, err := scanServer(rows)
+		if err != nil {
 			return nil, err
 		}
-		if dockerContainerID != nil {
-			server.DockerContainerID = *dockerContainerID
-		}
-		json.Unmarshal([]byte(server.VarsJSON), &server.Vars)
 
 		ports, _ := m.getServerPorts(server.ID)
 		server.Ports = ports
+		services, _ := m.getServerServices(server.ID)
+		server.Services = services
 
 		if server.DockerContainerID != "" && server.State == models.ServerStateRunning {
-			stats, _ := m.docker.GetContainerStats(ctx, server.DockerContainerID)
+			stats, _ := m.runtime.GetContainerStats(ctx, server.DockerContainerID)
 			server.Stats = stats
 		}
 
-		servers = append(servers, &server)
+		servers = append(servers, server)
 	}
 	return servers, rows.Err()
 }
 
+// RunningContainers maps the ID of every running server to its main
+// container, for background workers that follow running servers.
+func (m *Manager) RunningContainers(ctx context.Context) (map[string]string, error) {
+	rows, err := m.db.QueryContext(ctx, `SELECT id, docker_container_id FROM servers WHERE state = ?`, models.ServerStateRunning)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	running := make(map[string]string)
+	for rows.Next() {
+		var id string
+		var containerID sql.NullString
+		if err := rows.Scan(&id, &containerID); err != nil {
+			return nil, err
+		}
+		if containerID.String != "" {
+			running[id] = containerID.String
+		}
+	}
+	return running, rows.Err()
+}
+
 func (m *Manager) StartServer(ctx context.Context, id string) error {
 	server, err := m.GetServer(ctx, id)
 	if err != nil {
@@ -218,7 +286,8 @@ func (m *Manager) StartServer(ctx context.Context, id string) error {
 
 	m.updateServerState(id, models.ServerStateStarting, models.ServerStateRunning)
 
-	if err := m.docker.StartContainer(ctx, server.DockerContainerID); err != nil {
+	manifest, _ := m.packs.LoadFromDir(m.packs.GetPackPath(server.PackID))
+	if err := m.startContainers(ctx, server, manifest); err != nil {
 		m.updateServerState(id, models.ServerStateError, models.ServerStateStopped)
 		return err
 	}
@@ -245,7 +314,7 @@ func (m *Manager) StopServer(ctx context.Context, id string) error {
 		timeout = manifest.Shutdown.Timeout
 	}
 
-	if err := m.docker.StopContainer(ctx, server.DockerContainerID, timeout); err != nil {
+	if err := m.stopContainers(ctx, server, manifest, timeout); err != nil {
 		return err
 	}
 
@@ -300,15 +369,31 @@ func (m *Manager) UpdateServer(ctx context.Context, id string, req UpdateServerR
 		server.Vars = mergedVars
 	}
 
+	// Update shared networks, connecting the live container right away
+	if req.Networks != nil {
+		networks, err := normalizeNetworks(*req.Networks)
+		if err != nil {
+			return nil, err
+		}
+		if server.DockerContainerID != "" {
+			if err := m.syncSharedNetworks(ctx, server, server.Networks, networks); err != nil {
+				return nil, err
+			}
+		}
+		server.Networks = networks
+	}
+
 	// Serialize variables to JSON
 	varsJSON, _ := json.Marshal(server.Vars)
 	server.VarsJSON = string(varsJSON)
+	networksJSON, _ := json.Marshal(server.Networks)
+	server.NetworksJSON = string(networksJSON)
 	server.UpdatedAt = time.Now()
 
 	// Update database
 	_, err = m.db.Exec(`
-		UPDATE servers SET name = ?, vars_json = ?, updated_at = ? WHERE id = ?
-	`, server.Name, server.VarsJSON, server.UpdatedAt, server.ID)
+		UPDATE servers SET name = ?, vars_json = ?, networks_json = ?, updated_at = ? WHERE id = ?
+	`, server.Name, server.VarsJSON, server.NetworksJSON, server.UpdatedAt, server.ID)
 	if err != nil {
 		return nil, err
 	}
@@ -326,10 +411,13 @@ func (m *Manager) DeleteServer(ctx context.Context, id string) error {
 		m.StopServer(ctx, id)
 	}
 
+	m.removeServiceContainers(ctx, server)
 	if server.DockerContainerID != "" {
-		m.docker.RemoveContainer(ctx, server.DockerContainerID, true)
+		m.runtime.RemoveContainer(ctx, server.DockerContainerID, true)
 	}
 
+	m.removeServerNetworks(ctx, server)
+
 	m.ports.ReleasePorts(id)
 
 	serverDataDir := filepath.Join(m.dataDir, "servers", id)
@@ -363,9 +451,8 @@ func (m *Manager) handleInstallJob(ctx context.Context, job *models.Job) error {
 	// Handle install step (download, steamcmd, etc.)
 	if manifest.Install.Method == "download" {
 		m.jobs.UpdateProgress(job.ID, 10, "Downloading server files...\n")
-		if err := m.handleDownloadInstall(manifest, server, serverDataDir); err != nil {
-			m.updateServerState(server.ID, models.ServerStateError, models.ServerStateStopped)
-			return fmt.Errorf("failed to download server files: %w", err)
+		if err := m.handleDownloadInstall(ctx, manifest, server, serverDataDir); err != nil {
+			return m.installFailed(ctx, job, fmt.Errorf("failed to download server files: %w", err))
 		}
 	}
 
@@ -378,16 +465,59 @@ func (m *Manager) handleInstallJob(ctx context.Context, job *models.Job) error {
 
 	m.jobs.UpdateProgress(job.ID, 40, "Pulling image...\n")
 
-	if err := m.docker.PullImage(ctx, manifest.Runtime.Image); err != nil {
+	if err := m.runtime.PullImage(ctx, manifest.Runtime.Image); err != nil {
+		return m.installFailed(ctx, job, jobs.Retryable(fmt.Errorf("failed to pull image: %w", err)))
+	}
+
+	for _, svc := range manifest.Services {
+		m.jobs.UpdateProgress(job.ID, 50, fmt.Sprintf("Pulling %s image...\n", svc.Name))
+		if err := m.runtime.PullImage(ctx, svc.Image); err != nil {
+			return m.installFailed(ctx, job, jobs.Retryable(fmt.Errorf("failed to pull %s image: %w", svc.Name, err)))
+		}
+	}
+
+	m.jobs.UpdateProgress(job.ID, 60, "Creating containers...\n")
+
+	if err := m.createContainers(ctx, server, manifest, serverDataDir); err != nil {
+		m.updateServerState(server.ID, models.ServerStateError, models.ServerStateStopped)
+		return err
+	}
+
+	m.jobs.UpdateProgress(job.ID, 80, "Container created\n")
+	m.jobs.UpdateProgress(job.ID, 90, "Starting server...\n")
+
+	// Auto-start server after installation
+	if err := m.startContainers(ctx, server, manifest); err != nil {
 		m.updateServerState(server.ID, models.ServerStateError, models.ServerStateStopped)
-		return fmt.Errorf("failed to pull image: %w", err)
+		return fmt.Errorf("failed to start server after installation: %w", err)
+	}
+
+	m.updateServerState(server.ID, models.ServerStateRunning, models.ServerStateRunning)
+	m.jobs.UpdateProgress(job.ID, 100, "Installation complete, server started\n")
+	return nil
+}
+
+// createContainers creates the game container and its sidecars from the
+// manifest, replacing any containers left by a previous install.
+func (m *Manager) createContainers(ctx context.Context, server *models.Server, manifest *models.Manifest, serverDataDir string) error {
+	m.removeServiceContainers(ctx, server)
+	if server.DockerContainerID != "" {
+		if err := m.runtime.RemoveContainer(ctx, server.DockerContainerID, true); err != nil {
+			slog.Warn("failed to remove previous container", "server", server.ID, "error", err)
+		}
 	}
 
-	m.jobs.UpdateProgress(job.ID, 60, "Creating container...\n")
+	serverNetwork, err := m.ensureServerNetwork(ctx, server)
+	if err != nil {
+		return err
+	}
 
-	var portMappings []docker.PortMapping
+	var portMappings []runtime.PortMapping
 	for _, p := range server.Ports {
-		portMappings = append(portMappings, docker.PortMapping{
+		if p.Service != "" {
+			continue
+		}
+		portMappings = append(portMappings, runtime.PortMapping{
 			ContainerPort: p.ContainerPort,
 			HostPort:      p.HostPort,
 			Protocol:      p.Protocol,
@@ -412,7 +542,7 @@ func (m *Manager) handleInstallJob(ctx context.Context, job *models.Job) error {
 		command = append(command, m.renderTemplate(arg, server.Vars))
 	}
 
-	containerID, err := m.docker.CreateContainer(ctx, docker.CreateContainerOptions{
+	containerID, err := m.runtime.CreateContainer(ctx, runtime.CreateContainerOptions{
 		Name:       fmt.Sprintf("gsm-%s", server.ID),
 		Image:      manifest.Runtime.Image,
 		Workdir:    manifest.Runtime.Workdir,
@@ -420,7 +550,7 @@ func (m *Manager) handleInstallJob(ctx context.Context, job *models.Job) error {
 		Env:        env,
 		Command:    command,
 		Entrypoint: manifest.Runtime.Entrypoint,
-		Mounts: []docker.MountConfig{
+		Mounts: []runtime.MountConfig{
 			{
 				Source: serverDataDir,
 				Target: manifest.Storage.MountPath,
@@ -432,32 +562,56 @@ func (m *Manager) handleInstallJob(ctx context.Context, job *models.Job) error {
 			"gsm.server.name": server.Name,
 			"gsm.pack.id":     server.PackID,
 		},
+		Network:        serverNetwork,
+		NetworkAliases: []string{mainServiceAlias},
+		OpenStdin:      manifest.Console.UsesStdin(),
+		Tty:            manifest.Console.UsesStdin(),
 	})
 	if err != nil {
-		m.updateServerState(server.ID, models.ServerStateError, models.ServerStateStopped)
 		return fmt.Errorf("failed to create container: %w", err)
 	}
 
-	m.jobs.UpdateProgress(job.ID, 80, "Container created\n")
-
 	_, err = m.db.Exec("UPDATE servers SET docker_container_id = ?, updated_at = ? WHERE id = ?",
 		containerID, time.Now(), server.ID)
 	if err != nil {
-		m.updateServerState(server.ID, models.ServerStateError, models.ServerStateStopped)
 		return err
 	}
+	server.DockerContainerID = containerID
 
-	m.jobs.UpdateProgress(job.ID, 90, "Starting server...\n")
+	if err := m.connectSharedNetworks(ctx, server, containerID, server.Networks); err != nil {
+		return err
+	}
 
-	// Auto-start server after installation
-	if err := m.docker.StartContainer(ctx, containerID); err != nil {
-		m.updateServerState(server.ID, models.ServerStateError, models.ServerStateStopped)
-		return fmt.Errorf("failed to start server after installation: %w", err)
+	return m.createServiceContainers(ctx, server, manifest, serverDataDir, serverNetwork)
+}
+
+// installFailed puts the server of a failed install into the error state and
+// returns err. A server whose install is retried stays installing, so that
+// it cannot be started halfway installed in the meantime.
+func (m *Manager) installFailed(ctx context.Context, job *models.Job, err error) error {
+	if !jobs.WillRetry(ctx, job, err) {
+		m.updateServerState(job.ServerID, models.ServerStateError, models.ServerStateStopped)
 	}
+	return err
+}
 
-	m.updateServerState(server.ID, models.ServerStateRunning, models.ServerStateRunning)
-	m.jobs.UpdateProgress(job.ID, 100, "Installation complete, server started\n")
-	return nil
+// handleInterruptedJob takes a server out of the installing state an
+// interrupted install or update left it in, which would otherwise block
+// starting and updating it for good. A requeued job installs it again.
+func (m *Manager) handleInterruptedJob(job *models.Job, requeued bool) {
+	if job.ServerID == "" {
+		return
+	}
+	server, err := scanServer(m.db.QueryRow(`SELECT `+serverColumns+` FROM servers WHERE id = ?`, job.ServerID))
+	if err != nil || server.State != models.ServerStateInstalling {
+		return
+	}
+
+	if requeued {
+		m.updateServerState(server.ID, models.ServerStateStopped, models.ServerStateStopped)
+	} else {
+		m.updateServerState(server.ID, models.ServerStateError, models.ServerStateStopped)
+	}
 }
 
 func (m *Manager) handleUpdateJob(ctx context.Context, job *models.Job) error {
@@ -472,7 +626,7 @@ func (m *Manager) handleRestoreJob(ctx context.Context, job *models.Job) error {
 	return nil
 }
 
-func (m *Manager) handleDownloadInstall(manifest *models.Manifest, server *models.Server, serverDataDir string) error {
+func (m *Manager) handleDownloadInstall(ctx context.Context, manifest *models.Manifest, server *models.Server, serverDataDir string) error {
 	// Render the URL template with server variables
 	url := m.renderTemplate(manifest.Install.URL, server.Vars)
 	if url == "" {
@@ -502,14 +656,22 @@ func (m *Manager) handleDownloadInstall(manifest *models.Manifest, server *model
 	}
 
 	// Download the file
-	resp, err := http.Get(url)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return fmt.Errorf("invalid download URL %s: %w", url, err)
+	}
+	resp, err := http.DefaultClient.Do(req)
 	if err != nil {
-		return fmt.Errorf("failed to download from %s: %w", url, err)
+		return jobs.Retryable(fmt.Errorf("failed to download from %s: %w", url, err))
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("download failed with status %d", resp.StatusCode)
+		err := fmt.Errorf("download failed with status %d", resp.StatusCode)
+		if resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500 {
+			return jobs.Retryable(err)
+		}
+		return err
 	}
 
 	// Create the destination file
@@ -522,7 +684,7 @@ func (m *Manager) handleDownloadInstall(manifest *models.Manifest, server *model
 	// Copy the response body to the file
 	_, err = io.Copy(out, resp.Body)
 	if err != nil {
-		return fmt.Errorf("failed to write file: %w", err)
+		return jobs.Retryable(fmt.Errorf("failed to write file: %w", err))
 	}
 
 	return nil
@@ -612,7 +774,7 @@ func (m *Manager) validateVariables(manifest *models.Manifest, vars map[string]a
 
 func (m *Manager) getServerPorts(serverID string) ([]models.ServerPort, error) {
 	rows, err := m.db.Query(`
-		SELECT server_id, name, protocol, container_port, host_port
+		SELECT server_id, service, name, protocol, container_port, host_port
 		FROM server_ports WHERE server_id = ?
 	`, serverID)
 	if err != nil {
@@ -623,7 +785,7 @@ func (m *Manager) getServerPorts(serverID string) ([]models.ServerPort, error) {
 	var ports []models.ServerPort
 	for rows.Next() {
 		var p models.ServerPort
-		if err := rows.Scan(&p.ServerID, &p.Name, &p.Protocol, &p.ContainerPort, &p.HostPort); err != nil {
+		if err := rows.Scan(&p.ServerID, &p.Service, &p.Name, &p.Protocol, &p.ContainerPort, &p.HostPort); err != nil {
 			return nil, err
 		}
 		ports = append(ports, p)
@@ -634,6 +796,11 @@ func (m *Manager) getServerPorts(serverID string) ([]models.ServerPort, error) {
 func (m *Manager) updateServerState(id string, state, desiredState models.ServerState) {
 	m.db.Exec("UPDATE servers SET state = ?, desired_state = ?, updated_at = ? WHERE id = ?",
 		state, desiredState, time.Now(), id)
+
+	m.events.Publish(events.ServerState, id, map[string]any{
+		"state":        state,
+		"desiredState": desiredState,
+	})
 }
 
 func (m *Manager) GetDataDir() string {
@@ -0,0 +1,538 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"realmops/internal/db"
+	"realmops/internal/jobs"
+	"realmops/internal/models"
+	"realmops/internal/packs"
+	"realmops/internal/ports"
+	"realmops/internal/runtime/fake"
+)
+
+const testPack = `id: test
+name: Test Game
+version: "1.0.0"
+
+runtime:
+  image: test/game:latest
+  workdir: /data
+
+storage:
+  mountPath: /data
+
+variables:
+  - name: motd
+    label: MOTD
+    type: string
+    default: hello
+
+ports:
+  - name: game
+    containerPort: 27015
+    protocol: udp
+    hostPortMode: auto
+
+services:
+  - name: db
+    image: test/db:latest
+    startOrder: before
+  - name: web
+    image: test/web:latest
+
+start:
+  command: ["./server", "--motd", "{{.motd}}"]
+`
+
+func newTestManager(t *testing.T) (*Manager, *fake.Runtime) {
+	t.Helper()
+
+	dir := t.TempDir()
+	packDir := filepath.Join(dir, "packs", "test")
+	if err := os.MkdirAll(packDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(packDir, "pack.yaml"), []byte(testPack), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	database, err := db.New(filepath.Join(dir, "db", "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { database.Close() })
+	if err := database.Migrate(); err != nil {
+		t.Fatal(err)
+	}
+
+	allocator := ports.NewAllocator(database, 30000, 30100)
+	allocator.SetProbe(false)
+
+	rt := fake.New()
+	m := NewManager(database, rt, packs.NewLoader(filepath.Join(dir, "packs")), allocator, jobs.NewRunner(database), dir)
+	return m, rt
+}
+
+// installServer creates a server and runs its install job in place of the
+// job runner.
+func installServer(t *testing.T, m *Manager) *models.Server {
+	t.Helper()
+	ctx := context.Background()
+
+	server, err := m.CreateServer(ctx, CreateServerRequest{
+		Name:      "test",
+		PackID:    "test",
+		Variables: map[string]any{"motd": "hello"},
+	})
+	if err != nil {
+		t.Fatalf("CreateServer: %v", err)
+	}
+	runInstall(t, m, server.ID)
+
+	server, err = m.GetServer(ctx, server.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return server
+}
+
+func runInstall(t *testing.T, m *Manager, serverID string) {
+	t.Helper()
+	job := &models.Job{ID: "install-" + serverID, Type: models.JobTypeInstall, ServerID: serverID}
+	if err := m.handleInstallJob(context.Background(), job); err != nil {
+		t.Fatalf("install: %v", err)
+	}
+}
+
+func TestCreateServer(t *testing.T) {
+	tests := []struct {
+		name    string
+		req     CreateServerRequest
+		wantErr bool
+	}{
+		{
+			name: "defaults",
+			req:  CreateServerRequest{Name: "alpha", PackID: "test"},
+		},
+		{
+			name: "shared networks",
+			req:  CreateServerRequest{Name: "beta", PackID: "test", Networks: []string{"Proxy", "proxy"}},
+		},
+		{
+			name:    "unknown pack",
+			req:     CreateServerRequest{Name: "gamma", PackID: "missing"},
+			wantErr: true,
+		},
+		{
+			name:    "invalid network",
+			req:     CreateServerRequest{Name: "delta", PackID: "test", Networks: []string{"not a network"}},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m, rt := newTestManager(t)
+			ctx := context.Background()
+
+			server, err := m.CreateServer(ctx, tt.req)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("expected an error")
+				}
+				servers, _ := m.ListServers(ctx)
+				if len(servers) != 0 {
+					t.Fatalf("failed create left %d servers behind", len(servers))
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("CreateServer: %v", err)
+			}
+
+			got, err := m.GetServer(ctx, server.ID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got.State != models.ServerStateStopped {
+				t.Errorf("state = %s, want stopped", got.State)
+			}
+			if len(got.Ports) != 1 || got.Ports[0].HostPort < 30000 || got.Ports[0].HostPort > 30100 {
+				t.Errorf("ports = %+v, want one port in range", got.Ports)
+			}
+			if len(tt.req.Networks) > 0 && (len(got.Networks) != 1 || got.Networks[0] != "proxy") {
+				t.Errorf("networks = %v, want [proxy]", got.Networks)
+			}
+
+			jobs, err := m.jobs.GetServerJobs(server.ID, 10)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(jobs) != 1 || jobs[0].Type != models.JobTypeInstall || jobs[0].Status != models.JobStatusPending {
+				t.Errorf("jobs = %+v, want one pending install", jobs)
+			}
+
+			// Nothing touches the runtime before the install job runs
+			if calls := rt.Calls(); len(calls) != 0 {
+				t.Errorf("runtime calls = %v, want none", calls)
+			}
+		})
+	}
+}
+
+func TestInstall(t *testing.T) {
+	m, rt := newTestManager(t)
+	server := installServer(t, m)
+
+	if server.State != models.ServerStateRunning {
+		t.Errorf("state = %s, want running", server.State)
+	}
+	if server.DockerContainerID == "" {
+		t.Fatal("no container recorded")
+	}
+
+	game, ok := rt.Container(server.DockerContainerID)
+	if !ok {
+		t.Fatal("game container missing")
+	}
+	if !game.Running {
+		t.Error("game container not running")
+	}
+	if got := game.Options.Command; len(got) != 3 || got[2] != "hello" {
+		t.Errorf("command = %v, want the rendered motd", got)
+	}
+	if _, ok := game.Networks[serverNetworkName(server.ID)]; !ok {
+		t.Errorf("game container networks = %v, want the server network", game.Networks)
+	}
+
+	if len(server.Services) != 2 {
+		t.Fatalf("services = %+v, want db and web", server.Services)
+	}
+	for _, svc := range server.Services {
+		c, ok := rt.Container(svc.ContainerID)
+		if !ok || !c.Running {
+			t.Errorf("service %s not running", svc.Name)
+		}
+	}
+}
+
+func TestInstallFailure(t *testing.T) {
+	tests := []struct {
+		name      string
+		failOn    string
+		attempts  int
+		retryable bool
+		// A server whose install is retried stays installing
+		wantState models.ServerState
+	}{
+		{name: "pull", failOn: "PullImage", attempts: 1, retryable: true, wantState: models.ServerStateInstalling},
+		{name: "pull, last attempt", failOn: "PullImage", attempts: jobs.MaxAttempts, retryable: true, wantState: models.ServerStateError},
+		{name: "create", failOn: "CreateContainer", attempts: 1, wantState: models.ServerStateError},
+		{name: "start", failOn: "StartContainer", attempts: 1, wantState: models.ServerStateError},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m, rt := newTestManager(t)
+			ctx := context.Background()
+
+			server, err := m.CreateServer(ctx, CreateServerRequest{Name: "test", PackID: "test"})
+			if err != nil {
+				t.Fatal(err)
+			}
+			rt.FailOn[tt.failOn] = errors.New("boom")
+
+			job := &models.Job{ID: "install", Type: models.JobTypeInstall, ServerID: server.ID, Attempts: tt.attempts}
+			err = m.handleInstallJob(ctx, job)
+			if err == nil {
+				t.Fatal("expected install to fail")
+			}
+			if jobs.IsRetryable(err) != tt.retryable {
+				t.Errorf("retryable = %v, want %v", jobs.IsRetryable(err), tt.retryable)
+			}
+
+			got, _ := m.GetServer(ctx, server.ID)
+			if got.State != tt.wantState {
+				t.Errorf("state = %s, want %s", got.State, tt.wantState)
+			}
+			if tt.wantState == models.ServerStateInstalling {
+				if err := m.StartServer(ctx, server.ID); err == nil {
+					t.Error("server started while its install waits to be retried")
+				}
+			}
+		})
+	}
+}
+
+func TestStartStop(t *testing.T) {
+	tests := []struct {
+		name      string
+		op        func(m *Manager, id string) error
+		failOn    string
+		wantErr   bool
+		wantState models.ServerState
+		wantGame  bool
+	}{
+		{
+			name:      "stop",
+			op:        func(m *Manager, id string) error { return m.StopServer(context.Background(), id) },
+			wantState: models.ServerStateStopped,
+		},
+		{
+			name: "stop then start",
+			op: func(m *Manager, id string) error {
+				if err := m.StopServer(context.Background(), id); err != nil {
+					return err
+				}
+				return m.StartServer(context.Background(), id)
+			},
+			wantState: models.ServerStateRunning,
+			wantGame:  true,
+		},
+		{
+			name:      "restart",
+			op:        func(m *Manager, id string) error { return m.RestartServer(context.Background(), id) },
+			wantState: models.ServerStateRunning,
+			wantGame:  true,
+		},
+		{
+			name: "start fails",
+			op: func(m *Manager, id string) error {
+				if err := m.StopServer(context.Background(), id); err != nil {
+					return err
+				}
+				return m.StartServer(context.Background(), id)
+			},
+			failOn:    "StartContainer",
+			wantErr:   true,
+			wantState: models.ServerStateError,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m, rt := newTestManager(t)
+			server := installServer(t, m)
+			if tt.failOn != "" {
+				rt.FailOn[tt.failOn] = errors.New("boom")
+			}
+
+			err := tt.op(m, server.ID)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			got, _ := m.GetServer(context.Background(), server.ID)
+			if got.State != tt.wantState {
+				t.Errorf("state = %s, want %s", got.State, tt.wantState)
+			}
+			game, _ := rt.Container(server.DockerContainerID)
+			if game.Running != tt.wantGame {
+				t.Errorf("game running = %v, want %v", game.Running, tt.wantGame)
+			}
+		})
+	}
+}
+
+func TestStartRejected(t *testing.T) {
+	tests := []struct {
+		name  string
+		setup func(t *testing.T, m *Manager) string
+	}{
+		{
+			name: "not installed",
+			setup: func(t *testing.T, m *Manager) string {
+				server, err := m.CreateServer(context.Background(), CreateServerRequest{Name: "test", PackID: "test"})
+				if err != nil {
+					t.Fatal(err)
+				}
+				return server.ID
+			},
+		},
+		{
+			name: "installing",
+			setup: func(t *testing.T, m *Manager) string {
+				server := installServer(t, m)
+				m.updateServerState(server.ID, models.ServerStateInstalling, models.ServerStateStopped)
+				return server.ID
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m, _ := newTestManager(t)
+			id := tt.setup(t, m)
+			if err := m.StartServer(context.Background(), id); err == nil {
+				t.Fatal("expected StartServer to fail")
+			}
+		})
+	}
+}
+
+// TestReinstallReplacesContainers covers the update path, which recreates
+// the game container and its sidecars instead of adding more.
+func TestReinstallReplacesContainers(t *testing.T) {
+	tests := []struct {
+		name string
+		// prepare runs between the first and the second install
+		prepare func(t *testing.T, m *Manager, rt *fake.Runtime, server *models.Server)
+	}{
+		{
+			name: "running",
+		},
+		{
+			name: "stopped",
+			prepare: func(t *testing.T, m *Manager, rt *fake.Runtime, server *models.Server) {
+				if err := m.StopServer(context.Background(), server.ID); err != nil {
+					t.Fatal(err)
+				}
+			},
+		},
+		{
+			name: "container removed outside of the manager",
+			prepare: func(t *testing.T, m *Manager, rt *fake.Runtime, server *models.Server) {
+				if err := rt.RemoveContainer(context.Background(), server.DockerContainerID, true); err != nil {
+					t.Fatal(err)
+				}
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m, rt := newTestManager(t)
+			ctx := context.Background()
+			first := installServer(t, m)
+			if tt.prepare != nil {
+				tt.prepare(t, m, rt, first)
+			}
+
+			runInstall(t, m, first.ID)
+			second, err := m.GetServer(ctx, first.ID)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if second.DockerContainerID == first.DockerContainerID {
+				t.Error("game container was not replaced")
+			}
+			if _, ok := rt.Container(first.DockerContainerID); ok {
+				t.Error("old game container still exists")
+			}
+			for _, svc := range first.Services {
+				if _, ok := rt.Container(svc.ContainerID); ok {
+					t.Errorf("old %s container still exists", svc.Name)
+				}
+			}
+
+			ids, err := rt.ListContainersByLabel(ctx, map[string]string{"gsm.server.id": first.ID})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(ids) != 3 {
+				t.Errorf("containers = %v, want game, db and web", ids)
+			}
+			if second.State != models.ServerStateRunning {
+				t.Errorf("state = %s, want running", second.State)
+			}
+		})
+	}
+}
+
+func TestDeleteServer(t *testing.T) {
+	m, rt := newTestManager(t)
+	ctx := context.Background()
+	server := installServer(t, m)
+
+	if err := m.DeleteServer(ctx, server.ID); err != nil {
+		t.Fatalf("DeleteServer: %v", err)
+	}
+
+	ids, _ := rt.ListContainersByLabel(ctx, map[string]string{"gsm.server.id": server.ID})
+	if len(ids) != 0 {
+		t.Errorf("containers left = %v", ids)
+	}
+	for _, n := range rt.Networks() {
+		if n == serverNetworkName(server.ID) {
+			t.Error("server network left behind")
+		}
+	}
+	if _, err := m.GetServer(ctx, server.ID); err == nil {
+		t.Error("server still exists")
+	}
+}
+
+func TestCreateServerConcurrent(t *testing.T) {
+	m, _ := newTestManager(t)
+	ctx := context.Background()
+
+	const n = 8
+	errs := make(chan error, n)
+	for i := 0; i < n; i++ {
+		go func() {
+			_, err := m.CreateServer(ctx, CreateServerRequest{Name: "test", PackID: "test"})
+			errs <- err
+		}()
+	}
+	for i := 0; i < n; i++ {
+		if err := <-errs; err != nil {
+			t.Errorf("CreateServer: %v", err)
+		}
+	}
+
+	servers, err := m.ListServers(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	seen := make(map[int]bool)
+	for _, s := range servers {
+		for _, p := range s.Ports {
+			if seen[p.HostPort] {
+				t.Errorf("host port %d handed out twice", p.HostPort)
+			}
+			seen[p.HostPort] = true
+		}
+	}
+	if len(seen) != n {
+		t.Errorf("%d ports allocated, want %d", len(seen), n)
+	}
+}
+
+func TestHandleInterruptedJob(t *testing.T) {
+	tests := []struct {
+		name      string
+		state     models.ServerState
+		requeued  bool
+		wantState models.ServerState
+	}{
+		{name: "requeued", state: models.ServerStateInstalling, requeued: true, wantState: models.ServerStateStopped},
+		{name: "failed", state: models.ServerStateInstalling, wantState: models.ServerStateError},
+		{name: "not installing", state: models.ServerStateRunning, wantState: models.ServerStateRunning},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m, _ := newTestManager(t)
+			ctx := context.Background()
+
+			server, err := m.CreateServer(ctx, CreateServerRequest{Name: "test", PackID: "test"})
+			if err != nil {
+				t.Fatal(err)
+			}
+			m.updateServerState(server.ID, tt.state, models.ServerStateStopped)
+
+			m.handleInterruptedJob(&models.Job{ID: "install", Type: models.JobTypeInstall, ServerID: server.ID}, tt.requeued)
+
+			got, _ := m.GetServer(ctx, server.ID)
+			if got.State != tt.wantState {
+				t.Errorf("state = %s, want %s", got.State, tt.wantState)
+			}
+		})
+	}
+}
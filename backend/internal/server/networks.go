@@ -0,0 +1,130 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"regexp"
+	"sort"
+	"strings"
+
+	"realmops/internal/models"
+)
+
+// mainServiceAlias is the hostname of the game container on its server's
+// private network.
+const mainServiceAlias = "game"
+
+var networkNamePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_.-]{0,62}$`)
+
+// serverNetworkName is the private network every container of a server joins.
+func serverNetworkName(serverID string) string {
+	return fmt.Sprintf("gsm-%s", serverID)
+}
+
+// sharedNetworkName is the Docker name of a user-defined network that
+// groups several servers together.
+func sharedNetworkName(name string) string {
+	return fmt.Sprintf("gsm-net-%s", name)
+}
+
+// serverHostAlias is the hostname servers on a shared network address each
+// other by. It is derived from the server ID rather than the name, which can
+// change while the container keeps its aliases.
+func serverHostAlias(server *models.Server) string {
+	return fmt.Sprintf("gsm-%s", server.ID)
+}
+
+func normalizeNetworks(networks []string) ([]string, error) {
+	seen := make(map[string]bool)
+	result := []string{}
+	for _, n := range networks {
+		n = strings.ToLower(strings.TrimSpace(n))
+		if n == "" || seen[n] {
+			continue
+		}
+		if !networkNamePattern.MatchString(n) {
+			return nil, fmt.Errorf("invalid network name %q: use lowercase letters, digits, '-', '_' or '.'", n)
+		}
+		seen[n] = true
+		result = append(result, n)
+	}
+	sort.Strings(result)
+	return result, nil
+}
+
+func (m *Manager) ensureServerNetwork(ctx context.Context, server *models.Server) (string, error) {
+	name := serverNetworkName(server.ID)
+	if _, err := m.runtime.EnsureNetwork(ctx, name, map[string]string{
+		"gsm.server.id": server.ID,
+	}); err != nil {
+		return "", err
+	}
+	return name, nil
+}
+
+func (m *Manager) connectSharedNetworks(ctx context.Context, server *models.Server, containerID string, networks []string) error {
+	aliases := []string{serverHostAlias(server)}
+	for _, n := range networks {
+		name := sharedNetworkName(n)
+		if _, err := m.runtime.EnsureNetwork(ctx, name, map[string]string{
+			"gsm.network.shared": n,
+		}); err != nil {
+			return err
+		}
+		if err := m.runtime.ConnectNetwork(ctx, name, containerID, aliases); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// syncSharedNetworks attaches and detaches the server's container so that it
+// is a member of exactly the given shared networks.
+func (m *Manager) syncSharedNetworks(ctx context.Context, server *models.Server, current, desired []string) error {
+	want := make(map[string]bool)
+	for _, n := range desired {
+		want[n] = true
+	}
+	have := make(map[string]bool)
+	for _, n := range current {
+		have[n] = true
+	}
+
+	var added []string
+	for _, n := range desired {
+		if !have[n] {
+			added = append(added, n)
+		}
+	}
+	if err := m.connectSharedNetworks(ctx, server, server.DockerContainerID, added); err != nil {
+		return err
+	}
+
+	for _, n := range current {
+		if want[n] {
+			continue
+		}
+		name := sharedNetworkName(n)
+		if err := m.runtime.DisconnectNetwork(ctx, name, server.DockerContainerID); err != nil {
+			return err
+		}
+		if err := m.runtime.RemoveNetworkIfUnused(ctx, name); err != nil {
+			slog.Warn("failed to remove unused network", "network", name, "error", err)
+		}
+	}
+	return nil
+}
+
+// removeServerNetworks deletes the server's private network and any shared
+// network it was the last member of. Containers must be removed first.
+func (m *Manager) removeServerNetworks(ctx context.Context, server *models.Server) {
+	if err := m.runtime.RemoveNetwork(ctx, serverNetworkName(server.ID)); err != nil {
+		slog.Warn("failed to remove server network", "server", server.ID, "error", err)
+	}
+	for _, n := range server.Networks {
+		if err := m.runtime.RemoveNetworkIfUnused(ctx, sharedNetworkName(n)); err != nil {
+			slog.Warn("failed to remove unused network", "network", n, "error", err)
+		}
+	}
+}
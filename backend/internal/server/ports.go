@@ -0,0 +1,465 @@
+package server
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"time"
+
+	"realmops/internal/models"
+	"realmops/internal/ports"
+)
+
+// ErrServerInstalling is returned for changes that cannot be made while a
+// server is being installed.
+var ErrServerInstalling = errors.New("server is installing")
+
+type UpdateServerPortsRequest struct {
+	// Ports maps manifest port names to the requested host port.
+	Ports map[string]int `json:"ports"`
+}
+
+// portGroup is a port together with the ports linked to it through
+// offsetFrom or sameAs. A group is always allocated as one block.
+type portGroup struct {
+	Root    string
+	Members []int // indexes into the port specs
+	Offsets []int // host port offset of each member from the root
+}
+
+func groupPorts(specs []portSpec) ([]portGroup, error) {
+	configs := make([]models.PortConfig, len(specs))
+	for i, spec := range specs {
+		configs[i] = spec.Config
+	}
+
+	root, offset, err := models.ResolvePortLinks(configs)
+	if err != nil {
+		return nil, err
+	}
+
+	var groups []portGroup
+	index := make(map[string]int)
+	for i, spec := range specs {
+		r := root[spec.Config.Name]
+		g, ok := index[r]
+		if !ok {
+			g = len(groups)
+			index[r] = g
+			groups = append(groups, portGroup{Root: r})
+		}
+		groups[g].Members = append(groups[g].Members, i)
+		groups[g].Offsets = append(groups[g].Offsets, offset[spec.Config.Name])
+	}
+	return groups, nil
+}
+
+// checkRequestedPorts verifies that every requested port names a "user" mode
+// port of the pack and that no host port is requested twice.
+func checkRequestedPorts(specs []portSpec, requested map[string]int) error {
+	configs := make(map[string]models.PortConfig)
+	for _, spec := range specs {
+		configs[spec.Config.Name] = spec.Config
+	}
+
+	seen := make(map[int]string)
+	for name, hostPort := range requested {
+		port, ok := configs[name]
+		if !ok {
+			return fmt.Errorf("unknown port %q", name)
+		}
+		if link, _ := port.Link(); link != "" {
+			return fmt.Errorf("port %q follows port %q and cannot be chosen", name, link)
+		}
+		if port.HostPortMode != "user" {
+			return fmt.Errorf("port %q is assigned automatically and cannot be chosen", name)
+		}
+		if hostPort < 1 || hostPort > 65535 {
+			return fmt.Errorf("port %q: invalid host port %d", name, hostPort)
+		}
+		if other, dup := seen[hostPort]; dup {
+			return fmt.Errorf("ports %q and %q both request host port %d", other, name, hostPort)
+		}
+		seen[hostPort] = name
+	}
+	return nil
+}
+
+// allocateServerPorts reserves a host port for each spec within tx, a
+// transaction run by the allocator's WithTx, allocating linked ports as one
+// block. Requested ports are reserved first so automatic allocation cannot
+// take them; "user" mode ports without a request fall back to automatic
+// allocation.
+func (m *Manager) allocateServerPorts(tx *sql.Tx, serverID string, specs []portSpec, requested map[string]int) ([]int, error) {
+	if err := checkRequestedPorts(specs, requested); err != nil {
+		return nil, err
+	}
+
+	groups, err := groupPorts(specs)
+	if err != nil {
+		return nil, err
+	}
+
+	hostPorts := make([]int, len(specs))
+	assign := func(g portGroup, base int) {
+		for j, i := range g.Members {
+			hostPorts[i] = base + g.Offsets[j]
+		}
+	}
+
+	for _, g := range groups {
+		base, ok := requested[g.Root]
+		if !ok {
+			continue
+		}
+		if err := m.ports.ReserveGroupTx(tx, serverID, base, g.Offsets); err != nil {
+			return nil, m.portError(g.Root, base, err)
+		}
+		assign(g, base)
+	}
+
+	for _, g := range groups {
+		if _, ok := requested[g.Root]; ok {
+			continue
+		}
+		base, err := m.ports.AllocateGroupTx(tx, serverID, g.Offsets)
+		if err != nil {
+			return nil, fmt.Errorf("failed to allocate ports: %w", err)
+		}
+		assign(g, base)
+	}
+
+	return hostPorts, nil
+}
+
+// portError turns an allocator error for a requested port into a message that
+// says why the port cannot be used. The allocator's sentinel stays wrapped.
+func (m *Manager) portError(name string, hostPort int, err error) error {
+	var pe *ports.PortError
+	if errors.As(err, &pe) {
+		hostPort = pe.Port
+	}
+
+	switch {
+	case errors.Is(err, ports.ErrPortOutOfRange):
+		return fmt.Errorf("port %q: host port %d: %w", name, hostPort, ports.ErrPortOutOfRange)
+	case errors.Is(err, ports.ErrPortExcluded):
+		return fmt.Errorf("port %q: host port %d: %w", name, hostPort, ports.ErrPortExcluded)
+	case errors.Is(err, ports.ErrPortInUse):
+		return fmt.Errorf("port %q: host port %d: %w", name, hostPort, ports.ErrPortInUse)
+	case errors.Is(err, ports.ErrPortReserved):
+		if owner, _ := m.ports.ReservedBy(hostPort); owner != "" {
+			return fmt.Errorf("port %q: host port %d: %w by server %s", name, hostPort, ports.ErrPortReserved, owner)
+		}
+		return fmt.Errorf("port %q: host port %d: %w", name, hostPort, ports.ErrPortReserved)
+	}
+	return fmt.Errorf("port %q: %w", name, err)
+}
+
+// UpdateServerPorts changes the host ports of a server's "user" mode ports.
+// Port bindings are fixed when a container is created, so installed servers
+// have their containers recreated and restarted if they were running.
+func (m *Manager) UpdateServerPorts(ctx context.Context, id string, req UpdateServerPortsRequest) (*models.Server, error) {
+	server, err := m.GetServer(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	if server.State == models.ServerStateInstalling {
+		return nil, fmt.Errorf("cannot update ports: %w", ErrServerInstalling)
+	}
+
+	manifest, err := m.packs.LoadFromDir(m.packs.GetPackPath(server.PackID))
+	if err != nil {
+		return nil, fmt.Errorf("failed to load pack: %w", err)
+	}
+
+	specs := manifestPorts(manifest)
+	if err := checkRequestedPorts(specs, req.Ports); err != nil {
+		return nil, err
+	}
+
+	groups, err := groupPorts(specs)
+	if err != nil {
+		return nil, err
+	}
+
+	// Moving a port moves every port linked to it along with it
+	moves := make(map[int]int)
+	moved := make(map[string]int)
+	for _, g := range groups {
+		base, ok := req.Ports[g.Root]
+		if !ok {
+			continue
+		}
+		for j, i := range g.Members {
+			name := specs[i].Config.Name
+			hostPort := base + g.Offsets[j]
+
+			current := -1
+			for _, p := range server.Ports {
+				if p.Name == name {
+					current = p.HostPort
+					break
+				}
+			}
+			if current == -1 {
+				return nil, fmt.Errorf("port %q is not allocated for this server", name)
+			}
+			if current != hostPort {
+				moves[current] = hostPort
+				moved[name] = hostPort
+			}
+		}
+	}
+
+	if len(moves) == 0 {
+		return server, nil
+	}
+
+	for name, hostPort := range moved {
+		owner, err := m.ports.ReservedBy(hostPort)
+		if err != nil {
+			return nil, err
+		}
+		if owner != "" && owner != server.ID {
+			return nil, m.portError(name, hostPort, ports.ErrPortReserved)
+		}
+		if _, freed := moves[hostPort]; owner == server.ID && !freed {
+			return nil, fmt.Errorf("port %q: host port %d: %w by another port of this server", name, hostPort, ports.ErrPortReserved)
+		}
+	}
+
+	if err := m.ports.ReassignPorts(server.ID, moves); err != nil {
+		return nil, fmt.Errorf("failed to reassign ports: %w", err)
+	}
+
+	for i, p := range server.Ports {
+		hostPort, ok := moved[p.Name]
+		if !ok {
+			continue
+		}
+		_, err := m.db.Exec("UPDATE server_ports SET host_port = ? WHERE server_id = ? AND name = ?",
+			hostPort, server.ID, p.Name)
+		if err != nil {
+			return nil, err
+		}
+		server.Ports[i].HostPort = hostPort
+	}
+	m.db.Exec("UPDATE servers SET updated_at = ? WHERE id = ?", time.Now(), server.ID)
+
+	if server.DockerContainerID == "" {
+		return server, nil
+	}
+
+	wasRunning := server.State == models.ServerStateRunning
+	if wasRunning {
+		if err := m.StopServer(ctx, server.ID); err != nil {
+			return nil, fmt.Errorf("failed to stop server: %w", err)
+		}
+	}
+
+	serverDataDir := filepath.Join(m.dataDir, "servers", server.ID, "data")
+	if err := m.createContainers(ctx, server, manifest, serverDataDir); err != nil {
+		m.updateServerState(server.ID, models.ServerStateError, models.ServerStateStopped)
+		return nil, fmt.Errorf("failed to recreate containers: %w", err)
+	}
+
+	if wasRunning {
+		if err := m.StartServer(ctx, server.ID); err != nil {
+			return nil, err
+		}
+	}
+
+	return m.GetServer(ctx, server.ID)
+}
+
+// OutOfRangeServer is a server holding host ports outside the allocation
+// range, usually after the range was changed.
+type OutOfRangeServer struct {
+	ServerID   string              `json:"serverId"`
+	ServerName string              `json:"serverName"`
+	State      models.ServerState  `json:"state"`
+	Ports      []models.ServerPort `json:"ports"`
+}
+
+// OutOfRangeServers lists the servers with at least one port outside the
+// allocator's current range, along with those ports.
+func (m *Manager) OutOfRangeServers(ctx context.Context) ([]OutOfRangeServer, error) {
+	servers, err := m.ListServers(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	result := []OutOfRangeServer{}
+	for _, server := range servers {
+		var outside []models.ServerPort
+		for _, p := range server.Ports {
+			if !m.ports.InRange(p.HostPort) {
+				outside = append(outside, p)
+			}
+		}
+		if len(outside) > 0 {
+			result = append(result, OutOfRangeServer{
+				ServerID:   server.ID,
+				ServerName: server.Name,
+				State:      server.State,
+				Ports:      outside,
+			})
+		}
+	}
+	return result, nil
+}
+
+// MigratePorts queues a port migration job for each given server, or for
+// every out-of-range server when none are given.
+func (m *Manager) MigratePorts(ctx context.Context, serverIDs []string) ([]*models.Job, error) {
+	if len(serverIDs) == 0 {
+		servers, err := m.OutOfRangeServers(ctx)
+		if err != nil {
+			return nil, err
+		}
+		for _, s := range servers {
+			serverIDs = append(serverIDs, s.ServerID)
+		}
+	}
+
+	jobs := []*models.Job{}
+	for _, id := range serverIDs {
+		if _, err := m.GetServer(ctx, id); err != nil {
+			return jobs, fmt.Errorf("server %s not found", id)
+		}
+		job, err := m.jobs.CreateJob(models.JobTypePortMigrate, id)
+		if err != nil {
+			return jobs, err
+		}
+		jobs = append(jobs, job)
+	}
+	return jobs, nil
+}
+
+// handlePortMigrateJob reallocates every port group with a port outside the
+// allocation range, then re-renders configs and recreates the containers so
+// the new bindings take effect. Running servers are restarted.
+func (m *Manager) handlePortMigrateJob(ctx context.Context, job *models.Job) error {
+	server, err := m.GetServer(ctx, job.ServerID)
+	if err != nil {
+		return err
+	}
+
+	if server.State == models.ServerStateInstalling {
+		return fmt.Errorf("cannot migrate ports while installing")
+	}
+
+	manifest, err := m.packs.LoadFromDir(m.packs.GetPackPath(server.PackID))
+	if err != nil {
+		return fmt.Errorf("failed to load pack: %w", err)
+	}
+
+	specs := manifestPorts(manifest)
+	groups, err := groupPorts(specs)
+	if err != nil {
+		return err
+	}
+
+	current := make(map[string]int)
+	for _, p := range server.Ports {
+		current[p.Name] = p.HostPort
+	}
+
+	m.jobs.UpdateProgress(job.ID, 10, "Reallocating ports...\n")
+
+	var outside []portGroup
+	for _, g := range groups {
+		for _, i := range g.Members {
+			if hostPort, ok := current[specs[i].Config.Name]; ok && !m.ports.InRange(hostPort) {
+				outside = append(outside, g)
+				break
+			}
+		}
+	}
+
+	// The new ports are reserved, the old ones released and the server's
+	// ports updated in one transaction, so a failure leaves the server on
+	// its old ports with nothing leaked
+	moved := make(map[string]int)
+	err = m.ports.WithTx(func(tx *sql.Tx) error {
+		for _, g := range outside {
+			base, err := m.ports.AllocateGroupTx(tx, server.ID, g.Offsets)
+			if err != nil {
+				return fmt.Errorf("failed to allocate ports: %w", err)
+			}
+			for j, i := range g.Members {
+				name := specs[i].Config.Name
+				old, ok := current[name]
+				if !ok {
+					continue
+				}
+				if err := m.ports.ReleasePortTx(tx, server.ID, old); err != nil {
+					return err
+				}
+				moved[name] = base + g.Offsets[j]
+				if _, err := tx.Exec("UPDATE server_ports SET host_port = ? WHERE server_id = ? AND name = ?",
+					moved[name], server.ID, name); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	if len(moved) == 0 {
+		m.jobs.UpdateProgress(job.ID, 100, "All ports are within the allocation range\n")
+		return nil
+	}
+
+	for i, p := range server.Ports {
+		if hostPort, ok := moved[p.Name]; ok {
+			m.jobs.UpdateProgress(job.ID, 20, fmt.Sprintf("Port %s: %d -> %d\n", p.Name, p.HostPort, hostPort))
+			server.Ports[i].HostPort = hostPort
+		}
+	}
+
+	if server.DockerContainerID == "" {
+		m.jobs.UpdateProgress(job.ID, 100, "Ports migrated\n")
+		return nil
+	}
+
+	wasRunning := server.State == models.ServerStateRunning
+	if wasRunning {
+		m.jobs.UpdateProgress(job.ID, 40, "Stopping server...\n")
+		if err := m.StopServer(ctx, server.ID); err != nil {
+			return fmt.Errorf("failed to stop server: %w", err)
+		}
+	}
+
+	m.jobs.UpdateProgress(job.ID, 60, "Rendering configuration...\n")
+
+	serverDataDir := filepath.Join(m.dataDir, "servers", server.ID, "data")
+	if err := m.renderConfigs(manifest, server, serverDataDir); err != nil {
+		m.updateServerState(server.ID, models.ServerStateError, models.ServerStateStopped)
+		return fmt.Errorf("failed to render configs: %w", err)
+	}
+
+	m.jobs.UpdateProgress(job.ID, 70, "Recreating containers...\n")
+
+	if err := m.createContainers(ctx, server, manifest, serverDataDir); err != nil {
+		m.updateServerState(server.ID, models.ServerStateError, models.ServerStateStopped)
+		return fmt.Errorf("failed to recreate containers: %w", err)
+	}
+
+	if wasRunning {
+		m.jobs.UpdateProgress(job.ID, 90, "Starting server...\n")
+		if err := m.StartServer(ctx, server.ID); err != nil {
+			return err
+		}
+	}
+
+	m.jobs.UpdateProgress(job.ID, 100, "Ports migrated\n")
+	return nil
+}
@@ -0,0 +1,61 @@
+package server
+
+import (
+	"context"
+	"testing"
+
+	"realmops/internal/models"
+)
+
+func TestPortMigration(t *testing.T) {
+	tests := []struct {
+		name       string
+		rangeStart int
+		rangeEnd   int
+		// taken is reserved by another server before the migration
+		taken   int
+		wantErr bool
+	}{
+		{name: "moved into the new range", rangeStart: 31000, rangeEnd: 31100, taken: 31000},
+		{name: "no room in the new range", rangeStart: 31000, rangeEnd: 31000, taken: 31000, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m, _ := newTestManager(t)
+			ctx := context.Background()
+			server := installServer(t, m)
+			oldPort := server.Ports[0].HostPort
+
+			m.ports.SetRange(tt.rangeStart, tt.rangeEnd)
+			if err := m.ports.AllocateSpecificPort("other", tt.taken); err != nil {
+				t.Fatal(err)
+			}
+
+			job := &models.Job{ID: "migrate", Type: models.JobTypePortMigrate, ServerID: server.ID}
+			err := m.handlePortMigrateJob(ctx, job)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			got, _ := m.GetServer(ctx, server.ID)
+			reserved, _ := m.ports.GetServerPorts(server.ID)
+			if len(reserved) != 1 || reserved[0] != got.Ports[0].HostPort {
+				t.Errorf("reservations = %v, want only port %d", reserved, got.Ports[0].HostPort)
+			}
+
+			if tt.wantErr {
+				if got.Ports[0].HostPort != oldPort {
+					t.Errorf("port = %d, want it left at %d", got.Ports[0].HostPort, oldPort)
+				}
+				return
+			}
+			if p := got.Ports[0].HostPort; !m.ports.InRange(p) || p == tt.taken {
+				t.Errorf("port = %d, want a free port in the new range", p)
+			}
+			if got.State != models.ServerStateRunning {
+				t.Errorf("state = %s, want running", got.State)
+			}
+		})
+	}
+}
@@ -0,0 +1,207 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"path/filepath"
+
+	"realmops/internal/models"
+	"realmops/internal/runtime"
+)
+
+// portSpec is a manifest port together with the service that exposes it.
+// The main container uses an empty service name.
+type portSpec struct {
+	Service string
+	Config  models.PortConfig
+}
+
+func manifestPorts(manifest *models.Manifest) []portSpec {
+	var specs []portSpec
+	for _, p := range manifest.Ports {
+		specs = append(specs, portSpec{Config: p})
+	}
+	for _, svc := range manifest.Services {
+		for _, p := range svc.Ports {
+			specs = append(specs, portSpec{Service: svc.Name, Config: p})
+		}
+	}
+	return specs
+}
+
+func serviceContainerName(serverID, service string) string {
+	return fmt.Sprintf("gsm-%s-%s", serverID, service)
+}
+
+func (m *Manager) getServerServices(serverID string) ([]models.ServerService, error) {
+	rows, err := m.db.Query(`
+		SELECT service, container_id FROM server_containers
+		WHERE server_id = ? ORDER BY created_at ASC
+	`, serverID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var services []models.ServerService
+	for rows.Next() {
+		var s models.ServerService
+		if err := rows.Scan(&s.Name, &s.ContainerID); err != nil {
+			return nil, err
+		}
+		services = append(services, s)
+	}
+	return services, rows.Err()
+}
+
+// createServiceContainers creates the sidecar containers declared by the pack
+// on the server's private network, where each one is reachable by its name.
+func (m *Manager) createServiceContainers(ctx context.Context, server *models.Server, manifest *models.Manifest, dataDir, network string) error {
+	for _, svc := range manifest.Services {
+		var env []string
+		for k, v := range svc.Env {
+			env = append(env, fmt.Sprintf("%s=%s", k, m.renderTemplate(v, server.Vars)))
+		}
+
+		var command []string
+		for _, arg := range svc.Command {
+			command = append(command, m.renderTemplate(arg, server.Vars))
+		}
+
+		var mounts []runtime.MountConfig
+		for _, mnt := range svc.Mounts {
+			mounts = append(mounts, runtime.MountConfig{
+				Source:   filepath.Join(dataDir, filepath.FromSlash(mnt.Source)),
+				Target:   mnt.Target,
+				ReadOnly: mnt.ReadOnly,
+			})
+		}
+
+		var portMappings []runtime.PortMapping
+		for _, p := range server.Ports {
+			if p.Service == svc.Name {
+				portMappings = append(portMappings, runtime.PortMapping{
+					ContainerPort: p.ContainerPort,
+					HostPort:      p.HostPort,
+					Protocol:      p.Protocol,
+				})
+			}
+		}
+
+		containerID, err := m.runtime.CreateContainer(ctx, runtime.CreateContainerOptions{
+			Name:       serviceContainerName(server.ID, svc.Name),
+			Image:      svc.Image,
+			Workdir:    svc.Workdir,
+			User:       svc.User,
+			Env:        env,
+			Command:    command,
+			Entrypoint: svc.Entrypoint,
+			Mounts:     mounts,
+			Ports:      portMappings,
+			Labels: map[string]string{
+				"gsm.server.id":   server.ID,
+				"gsm.server.name": server.Name,
+				"gsm.pack.id":     server.PackID,
+				"gsm.service":     svc.Name,
+			},
+			Network:        network,
+			NetworkAliases: []string{svc.Name},
+		})
+		if err != nil {
+			return fmt.Errorf("failed to create %s container: %w", svc.Name, err)
+		}
+
+		_, err = m.db.Exec(`
+			INSERT OR REPLACE INTO server_containers (server_id, service, container_id)
+			VALUES (?, ?, ?)
+		`, server.ID, svc.Name, containerID)
+		if err != nil {
+			m.runtime.RemoveContainer(ctx, containerID, true)
+			return err
+		}
+
+		server.Services = append(server.Services, models.ServerService{
+			Name:        svc.Name,
+			ContainerID: containerID,
+		})
+	}
+	return nil
+}
+
+func (m *Manager) removeServiceContainers(ctx context.Context, server *models.Server) {
+	for _, svc := range server.Services {
+		if err := m.runtime.RemoveContainer(ctx, svc.ContainerID, true); err != nil {
+			slog.Warn("failed to remove service container", "server", server.ID, "service", svc.Name, "error", err)
+		}
+	}
+	m.db.Exec("DELETE FROM server_containers WHERE server_id = ?", server.ID)
+	server.Services = nil
+}
+
+// splitServices groups a server's sidecars by whether they start before or
+// after the game container. Services no longer in the manifest start after.
+func splitServices(manifest *models.Manifest, services []models.ServerService) (before, after []models.ServerService) {
+	order := make(map[string]string)
+	if manifest != nil {
+		for _, svc := range manifest.Services {
+			order[svc.Name] = svc.StartOrder
+		}
+	}
+	for _, s := range services {
+		if order[s.Name] == "before" {
+			before = append(before, s)
+		} else {
+			after = append(after, s)
+		}
+	}
+	return before, after
+}
+
+// startContainers starts the server as a unit: "before" services, then the
+// game container, then "after" services.
+func (m *Manager) startContainers(ctx context.Context, server *models.Server, manifest *models.Manifest) error {
+	before, after := splitServices(manifest, server.Services)
+
+	for _, svc := range before {
+		if err := m.runtime.StartContainer(ctx, svc.ContainerID); err != nil {
+			return fmt.Errorf("failed to start %s: %w", svc.Name, err)
+		}
+	}
+
+	if err := m.runtime.StartContainer(ctx, server.DockerContainerID); err != nil {
+		return err
+	}
+
+	for _, svc := range after {
+		if err := m.runtime.StartContainer(ctx, svc.ContainerID); err != nil {
+			return fmt.Errorf("failed to start %s: %w", svc.Name, err)
+		}
+	}
+	return nil
+}
+
+// stopContainers stops the server in the reverse order of startContainers.
+// Sidecar failures are logged so they never keep the game server running.
+func (m *Manager) stopContainers(ctx context.Context, server *models.Server, manifest *models.Manifest, timeout int) error {
+	before, after := splitServices(manifest, server.Services)
+
+	for i := len(after) - 1; i >= 0; i-- {
+		if err := m.runtime.StopContainer(ctx, after[i].ContainerID, serviceStopTimeout); err != nil {
+			slog.Warn("failed to stop service container", "server", server.ID, "service", after[i].Name, "error", err)
+		}
+	}
+
+	if err := m.runtime.StopContainer(ctx, server.DockerContainerID, timeout); err != nil {
+		return err
+	}
+
+	for i := len(before) - 1; i >= 0; i-- {
+		if err := m.runtime.StopContainer(ctx, before[i].ContainerID, serviceStopTimeout); err != nil {
+			slog.Warn("failed to stop service container", "server", server.ID, "service", before[i].Name, "error", err)
+		}
+	}
+	return nil
+}
+
+const serviceStopTimeout = 10
@@ -17,6 +17,7 @@ import (
 	"golang.org/x/crypto/ssh"
 	"realmops/internal/config"
 	"realmops/internal/db"
+	"realmops/internal/events"
 	"realmops/internal/packs"
 	"realmops/internal/sshkeys"
 )
@@ -105,6 +106,11 @@ func (s *Server) Start(ctx context.Context) error {
 	}
 }
 
+// SetEvents publishes SFTP session starts and ends on bus
+func (s *Server) SetEvents(bus *events.Bus) {
+	s.sessionManager.events = bus
+}
+
 // Shutdown gracefully shuts down the server
 func (s *Server) Shutdown() {
 	s.mu.Lock()
@@ -6,6 +6,7 @@ import (
 	"time"
 
 	"realmops/internal/db"
+	"realmops/internal/events"
 )
 
 // Session represents an active SFTP connection
@@ -33,6 +34,7 @@ type SessionManager struct {
 	db       *db.DB
 	sessions sync.Map
 	counter  int64
+	events   *events.Bus
 }
 
 // NewSessionManager creates a new session manager
@@ -54,6 +56,10 @@ func (m *SessionManager) Create(serverID, remoteAddr string) *Session {
 	}
 
 	m.sessions.Store(id, session)
+	m.events.Publish(events.SFTPSessionStarted, serverID, map[string]any{
+		"sessionId":  id,
+		"remoteAddr": remoteAddr,
+	})
 
 	// Log to database (optional, for audit trail)
 	go m.logSessionStart(session)
@@ -65,6 +71,13 @@ func (m *SessionManager) Create(serverID, remoteAddr string) *Session {
 func (m *SessionManager) End(sessionID string) {
 	if val, ok := m.sessions.LoadAndDelete(sessionID); ok {
 		session := val.(*Session)
+		m.events.Publish(events.SFTPSessionEnded, session.ServerID, map[string]any{
+			"sessionId":       session.ID,
+			"remoteAddr":      session.RemoteAddr,
+			"duration":        time.Since(session.ConnectedAt).Seconds(),
+			"bytesUploaded":   atomic.LoadInt64(&session.BytesUploaded),
+			"bytesDownloaded": atomic.LoadInt64(&session.BytesDownloaded),
+		})
 		go m.logSessionEnd(session)
 	}
 }
@@ -0,0 +1,300 @@
+// Package triggers watches the logs of running servers and performs actions
+// when lines match pack- or user-defined patterns.
+package triggers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"regexp"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+
+	"realmops/internal/console"
+	"realmops/internal/db"
+	"realmops/internal/jobs"
+	"realmops/internal/logstream"
+	"realmops/internal/models"
+	"realmops/internal/packs"
+	"realmops/internal/rcon"
+	"realmops/internal/runtime"
+	"realmops/internal/server"
+)
+
+const webhookTimeout = 10 * time.Second
+
+type Engine struct {
+	db            *db.DB
+	serverManager *server.Manager
+	packLoader    *packs.Loader
+	runtime       runtime.Runtime
+	rconManager   *rcon.Manager
+	jobs          *jobs.Runner
+	history       *console.History
+	client        *http.Client
+
+	ctx context.Context
+	// watcher follows each server's container with the triggers it had
+	// when the watch started; Reload restarts it
+	watcher *logstream.Watcher
+
+	mu        sync.Mutex
+	lastFired map[string]time.Time // by server ID + trigger ID
+}
+
+type compiled struct {
+	*Trigger
+	re *regexp.Regexp
+}
+
+func NewEngine(database *db.DB, serverManager *server.Manager, packLoader *packs.Loader, containerRuntime runtime.Runtime, rconManager *rcon.Manager, jobRunner *jobs.Runner, history *console.History) *Engine {
+	e := &Engine{
+		db:            database,
+		serverManager: serverManager,
+		packLoader:    packLoader,
+		runtime:       containerRuntime,
+		rconManager:   rconManager,
+		jobs:          jobRunner,
+		history:       history,
+		client:        &http.Client{Timeout: webhookTimeout},
+		ctx:           context.Background(),
+		lastFired:     make(map[string]time.Time),
+	}
+	e.watcher = logstream.NewWatcher(serverManager.RunningContainers, e.watch)
+	return e
+}
+
+// Start watches running servers until ctx is done.
+func (e *Engine) Start(ctx context.Context) {
+	e.mu.Lock()
+	e.ctx = ctx
+	e.mu.Unlock()
+
+	e.watcher.Run(ctx)
+}
+
+// Reload makes a server's watcher pick up changed triggers.
+func (e *Engine) Reload(serverID string) {
+	e.watcher.Restart(serverID)
+}
+
+// Triggers lists a server's pack and user triggers.
+func (e *Engine) Triggers(ctx context.Context, serverID string) ([]*Trigger, error) {
+	srv, err := e.serverManager.GetServer(ctx, serverID)
+	if err != nil {
+		return nil, err
+	}
+
+	triggers := []*Trigger{}
+	if manifest, err := e.packLoader.LoadFromDir(e.packLoader.GetPackPath(srv.PackID)); err == nil {
+		for _, c := range manifest.Triggers {
+			triggers = append(triggers, FromConfig(serverID, c))
+		}
+	}
+
+	user, err := e.userTriggers(serverID)
+	if err != nil {
+		return nil, err
+	}
+	triggers = append(triggers, user...)
+
+	e.mu.Lock()
+	for _, t := range triggers {
+		if at, ok := e.lastFired[serverID+"/"+t.ID]; ok {
+			at := at
+			t.LastFiredAt = &at
+		}
+	}
+	e.mu.Unlock()
+
+	return triggers, nil
+}
+
+// watch runs a server's enabled triggers against its container's logs.
+func (e *Engine) watch(ctx context.Context, serverID, containerID string) {
+	triggers, err := e.Triggers(ctx, serverID)
+	if err != nil {
+		// Try again on the next reconcile
+		return
+	}
+
+	var active []compiled
+	for _, t := range triggers {
+		if !t.Enabled {
+			continue
+		}
+		re, err := regexp.Compile(t.Pattern)
+		if err != nil {
+			continue
+		}
+		active = append(active, compiled{Trigger: t, re: re})
+	}
+	if len(active) == 0 {
+		<-ctx.Done()
+		return
+	}
+
+	logstream.Repeat(ctx, func(ctx context.Context) {
+		err := logstream.Follow(ctx, e.runtime, containerID, func(line logstream.Line) {
+			for _, t := range active {
+				if m := t.re.FindStringSubmatch(line.Text); m != nil {
+					e.match(serverID, t, m, line)
+				}
+			}
+		})
+		if err != nil {
+			slog.Debug("trigger log following interrupted", "serverId", serverID, "error", err)
+		}
+	})
+}
+
+// match fires a trigger unless it is cooling down. Actions run in the
+// background so that slow ones do not hold up the log stream.
+func (e *Engine) match(serverID string, t compiled, m []string, line logstream.Line) {
+	key := serverID + "/" + t.ID
+	now := time.Now()
+
+	e.mu.Lock()
+	if last, ok := e.lastFired[key]; ok && now.Sub(last) < t.cooldown() {
+		e.mu.Unlock()
+		return
+	}
+	e.lastFired[key] = now
+	ctx := e.ctx
+	e.mu.Unlock()
+
+	vars := map[string]string{"line": line.Text}
+	for i, name := range t.re.SubexpNames() {
+		if name != "" && i < len(m) {
+			vars[name] = m[i]
+		}
+	}
+
+	go func() {
+		if err := e.fire(ctx, serverID, t.Trigger, vars, line); err != nil {
+			slog.Error("trigger action failed", "serverId", serverID, "trigger", t.Name, "action", t.Action, "error", err)
+			return
+		}
+		slog.Info("trigger fired", "serverId", serverID, "trigger", t.Name, "action", t.Action)
+	}()
+}
+
+func (e *Engine) fire(ctx context.Context, serverID string, t *Trigger, vars map[string]string, line logstream.Line) error {
+	switch t.Action {
+	case models.TriggerRestart:
+		return e.serverManager.RestartServer(ctx, serverID)
+
+	case models.TriggerBackup:
+		_, err := e.jobs.CreateJob(models.JobTypeBackup, serverID)
+		return err
+
+	case models.TriggerRCON:
+		return e.runCommand(ctx, serverID, t, vars)
+
+	case models.TriggerWebhook:
+		return e.postWebhook(ctx, serverID, t, vars, line)
+	}
+	return fmt.Errorf("unknown action %q", t.Action)
+}
+
+// checkVars validates the vars a command template mentions like console
+// string params. They come from log lines, which include player chat, so
+// they must not be able to add arguments or commands.
+func checkVars(command string, vars map[string]string) error {
+	for name, val := range vars {
+		if !strings.Contains(command, name) {
+			continue
+		}
+		if _, err := console.CheckParam(models.CommandParam{Name: name, Type: "string"}, val); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (e *Engine) runCommand(ctx context.Context, serverID string, t *Trigger, vars map[string]string) error {
+	if err := checkVars(t.Command, vars); err != nil {
+		return err
+	}
+
+	tmpl, err := template.New(t.Name).Option("missingkey=zero").Parse(t.Command)
+	if err != nil {
+		return err
+	}
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, vars); err != nil {
+		return err
+	}
+	command := buf.String()
+
+	srv, err := e.serverManager.GetServer(ctx, serverID)
+	if err != nil {
+		return err
+	}
+	manifest, err := e.packLoader.LoadFromDir(e.packLoader.GetPackPath(srv.PackID))
+	if err != nil {
+		return err
+	}
+	target, err := rcon.TargetFor(manifest, srv)
+	if err != nil {
+		return err
+	}
+
+	rctx, cancel := context.WithTimeout(ctx, rcon.DefaultTimeout)
+	defer cancel()
+
+	start := time.Now()
+	response, err := e.rconManager.Run(rctx, serverID, target, command)
+	e.history.RecordActorCommand(serverID, console.SourceTrigger, "trigger: "+t.Name, command, response, err, time.Since(start))
+
+	return err
+}
+
+type webhookPayload struct {
+	Trigger  string            `json:"trigger"`
+	ServerID string            `json:"serverId"`
+	Line     string            `json:"line"`
+	Stream   string            `json:"stream"`
+	Time     time.Time         `json:"time"`
+	Groups   map[string]string `json:"groups"`
+}
+
+func (e *Engine) postWebhook(ctx context.Context, serverID string, t *Trigger, vars map[string]string, line logstream.Line) error {
+	groups := make(map[string]string, len(vars))
+	for k, v := range vars {
+		if k != "line" {
+			groups[k] = v
+		}
+	}
+
+	body, _ := json.Marshal(webhookPayload{
+		Trigger:  t.Name,
+		ServerID: serverID,
+		Line:     line.Text,
+		Stream:   line.Stream,
+		Time:     line.Time,
+		Groups:   groups,
+	})
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, t.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook returned %s", resp.Status)
+	}
+	return nil
+}
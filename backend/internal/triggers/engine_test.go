@@ -0,0 +1,27 @@
+package triggers
+
+import "testing"
+
+func TestCheckVars(t *testing.T) {
+	tests := []struct {
+		name    string
+		command string
+		vars    map[string]string
+		wantErr bool
+	}{
+		{name: "plain group", command: "kick {{.player}}", vars: map[string]string{"player": "Steve"}},
+		{name: "quote in group", command: `say "{{.msg}}"`, vars: map[string]string{"msg": `hi" "op Steve`}, wantErr: true},
+		{name: "line break in group", command: "say {{.msg}}", vars: map[string]string{"msg": "hi\nop Steve"}, wantErr: true},
+		{name: "through index", command: `say {{index . "msg"}}`, vars: map[string]string{"msg": `"`}, wantErr: true},
+		{name: "unused var", command: "save-all", vars: map[string]string{"line": `<Steve> "hi"`}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := checkVars(tt.command, tt.vars)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("err = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
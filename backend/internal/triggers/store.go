@@ -0,0 +1,130 @@
+package triggers
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ErrNotFound is returned for unknown or read-only (pack) triggers.
+var ErrNotFound = errors.New("trigger not found")
+
+// TriggerRequest creates or replaces a user trigger.
+type TriggerRequest struct {
+	Name     string `json:"name"`
+	Pattern  string `json:"pattern"`
+	Action   string `json:"action"`
+	Cooldown int    `json:"cooldown"`
+	Command  string `json:"command"`
+	URL      string `json:"url"`
+	Enabled  *bool  `json:"enabled"`
+}
+
+func (req TriggerRequest) trigger() *Trigger {
+	enabled := true
+	if req.Enabled != nil {
+		enabled = *req.Enabled
+	}
+	return &Trigger{
+		Source:   SourceUser,
+		Name:     req.Name,
+		Pattern:  req.Pattern,
+		Action:   req.Action,
+		Cooldown: req.Cooldown,
+		Command:  req.Command,
+		URL:      req.URL,
+		Enabled:  enabled,
+	}
+}
+
+func (e *Engine) userTriggers(serverID string) ([]*Trigger, error) {
+	rows, err := e.db.Query(`
+		SELECT id, server_id, name, pattern, action, cooldown, command, url, enabled, created_at
+		FROM triggers WHERE server_id = ? ORDER BY created_at
+	`, serverID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var triggers []*Trigger
+	for rows.Next() {
+		t := &Trigger{Source: SourceUser}
+		var command, url sql.NullString
+		var createdAt time.Time
+		if err := rows.Scan(&t.ID, &t.ServerID, &t.Name, &t.Pattern, &t.Action, &t.Cooldown, &command, &url, &t.Enabled, &createdAt); err != nil {
+			return nil, err
+		}
+		t.Command = command.String
+		t.URL = url.String
+		t.CreatedAt = &createdAt
+		triggers = append(triggers, t)
+	}
+	return triggers, rows.Err()
+}
+
+// CreateTrigger adds a user trigger to a server and applies it right away.
+func (e *Engine) CreateTrigger(serverID string, req TriggerRequest) (*Trigger, error) {
+	t := req.trigger()
+	if err := t.config().Validate(); err != nil {
+		return nil, err
+	}
+
+	t.ID = newID()
+	t.ServerID = serverID
+	now := time.Now()
+	t.CreatedAt = &now
+
+	_, err := e.db.Exec(`
+		INSERT INTO triggers (id, server_id, name, pattern, action, cooldown, command, url, enabled, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`, t.ID, serverID, t.Name, t.Pattern, t.Action, t.Cooldown, t.Command, t.URL, t.Enabled, now)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create trigger: %w", err)
+	}
+
+	e.Reload(serverID)
+	return t, nil
+}
+
+// UpdateTrigger replaces a user trigger.
+func (e *Engine) UpdateTrigger(serverID, id string, req TriggerRequest) (*Trigger, error) {
+	t := req.trigger()
+	if err := t.config().Validate(); err != nil {
+		return nil, err
+	}
+
+	result, err := e.db.Exec(`
+		UPDATE triggers SET name = ?, pattern = ?, action = ?, cooldown = ?, command = ?, url = ?, enabled = ?
+		WHERE id = ? AND server_id = ?
+	`, t.Name, t.Pattern, t.Action, t.Cooldown, t.Command, t.URL, t.Enabled, id, serverID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to update trigger: %w", err)
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return nil, ErrNotFound
+	}
+
+	t.ID = id
+	t.ServerID = serverID
+	e.Reload(serverID)
+	return t, nil
+}
+
+func (e *Engine) DeleteTrigger(serverID, id string) error {
+	result, err := e.db.Exec(`DELETE FROM triggers WHERE id = ? AND server_id = ?`, id, serverID)
+	if err != nil {
+		return err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return ErrNotFound
+	}
+
+	e.Reload(serverID)
+	return nil
+}
+
+func newID() string {
+	return fmt.Sprintf("trigger_%d", time.Now().UnixNano())
+}
@@ -0,0 +1,67 @@
+package triggers
+
+import (
+	"time"
+
+	"realmops/internal/models"
+)
+
+// DefaultCooldown applies to triggers without a cooldown.
+const DefaultCooldown = 60 * time.Second
+
+const (
+	SourcePack = "pack"
+	SourceUser = "user"
+)
+
+// Trigger is a pack- or user-defined reaction to a log line. Pack triggers
+// have IDs of the form "pack:<name>" and cannot be edited.
+type Trigger struct {
+	ID       string `json:"id"`
+	ServerID string `json:"serverId"`
+	Source   string `json:"source"`
+	Name     string `json:"name"`
+	Pattern  string `json:"pattern"`
+	Action   string `json:"action"`
+	Cooldown int    `json:"cooldown"`
+	Command  string `json:"command,omitempty"`
+	URL      string `json:"url,omitempty"`
+	Enabled  bool   `json:"enabled"`
+
+	LastFiredAt *time.Time `json:"lastFiredAt,omitempty"`
+	CreatedAt   *time.Time `json:"createdAt,omitempty"`
+}
+
+// FromConfig turns a pack trigger into a Trigger of a server.
+func FromConfig(serverID string, c models.TriggerConfig) *Trigger {
+	return &Trigger{
+		ID:       "pack:" + c.Name,
+		ServerID: serverID,
+		Source:   SourcePack,
+		Name:     c.Name,
+		Pattern:  c.Pattern,
+		Action:   c.Action,
+		Cooldown: c.Cooldown,
+		Command:  c.Command,
+		URL:      c.URL,
+		Enabled:  true,
+	}
+}
+
+func (t *Trigger) config() models.TriggerConfig {
+	return models.TriggerConfig{
+		Name:     t.Name,
+		Pattern:  t.Pattern,
+		Action:   t.Action,
+		Cooldown: t.Cooldown,
+		Command:  t.Command,
+		URL:      t.URL,
+	}
+}
+
+func (t *Trigger) cooldown() time.Duration {
+	if t.Cooldown > 0 {
+		return time.Duration(t.Cooldown) * time.Second
+	}
+	return DefaultCooldown
+}
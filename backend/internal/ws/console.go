@@ -8,9 +8,12 @@ import (
 	"time"
 
 	"github.com/gorilla/websocket"
+	"realmops/internal/auth"
+	"realmops/internal/console"
 	"realmops/internal/models"
 	"realmops/internal/packs"
 	"realmops/internal/rcon"
+	"realmops/internal/runtime"
 )
 
 type ConsoleMessage struct {
@@ -19,20 +22,32 @@ type ConsoleMessage struct {
 }
 
 type ConsoleResponse struct {
-	Type    string `json:"type"`    // "response", "error", "status"
+	Type    string `json:"type"` // "response", "error", "status", "broadcast", "history"
 	Payload string `json:"payload"`
+	// Kind classifies broadcasts, e.g. "chat" or "log"
+	Kind string `json:"kind,omitempty"`
+	// Command and User describe a replayed "history" entry
+	Command string `json:"command,omitempty"`
+	User    string `json:"user,omitempty"`
 	Time    string `json:"time"`
 }
 
+// scrollbackSize is how many past commands a new console session replays.
+const scrollbackSize = 50
+
 type ConsoleHandler struct {
 	packLoader  *packs.Loader
 	rconManager *rcon.Manager
+	runtime     runtime.Runtime
+	history     *console.History
 }
 
-func NewConsoleHandler(packLoader *packs.Loader, rconManager *rcon.Manager) *ConsoleHandler {
+func NewConsoleHandler(packLoader *packs.Loader, rconManager *rcon.Manager, containerRuntime runtime.Runtime, history *console.History) *ConsoleHandler {
 	return &ConsoleHandler{
 		packLoader:  packLoader,
 		rconManager: rconManager,
+		runtime:     containerRuntime,
+		history:     history,
 	}
 }
 
@@ -44,6 +59,8 @@ func (ch *ConsoleHandler) HandleWebSocket(w http.ResponseWriter, r *http.Request
 	}
 	defer conn.Close()
 
+	user := auth.GetUser(r.Context())
+
 	// Load pack manifest to get RCON config
 	manifest, err := ch.packLoader.LoadFromDir(ch.packLoader.GetPackPath(server.PackID))
 	if err != nil {
@@ -51,51 +68,43 @@ func (ch *ConsoleHandler) HandleWebSocket(w http.ResponseWriter, r *http.Request
 		return
 	}
 
-	if !manifest.RCON.Enabled {
-		ch.sendError(conn, "RCON is not enabled for this server type")
-		return
-	}
-
-	// Find RCON port mapping
-	var rconPort int
-	for _, port := range server.Ports {
-		if port.Name == manifest.RCON.PortName {
-			rconPort = port.HostPort
-			break
-		}
-	}
-
-	if rconPort == 0 {
-		ch.sendError(conn, "RCON port not found")
+	if manifest.Console.UsesStdin() {
+		ch.handleStdin(conn, server, user)
 		return
 	}
 
-	// Get RCON password from server variables
-	password := ""
-	if passVar, ok := server.Vars[manifest.RCON.PasswordVariable]; ok {
-		password, _ = passVar.(string)
-	}
-
-	if password == "" {
-		ch.sendError(conn, "RCON password not configured")
+	target, err := rcon.TargetFor(manifest, server)
+	if err != nil {
+		ch.sendError(conn, err.Error())
 		return
 	}
 
-	// Connect to RCON
+	// Join the server's shared RCON connection
 	ch.sendStatus(conn, "connecting")
 
-	err = ch.rconManager.Connect(server.ID, "127.0.0.1", rconPort, password)
+	handle, err := ch.rconManager.Acquire(server.ID, target)
 	if err != nil {
 		ch.sendError(conn, "failed to connect to RCON: "+err.Error())
 		return
 	}
-	defer ch.rconManager.Disconnect(server.ID)
+	defer handle.Release()
 
 	ch.sendStatus(conn, "connected")
+	ch.sendScrollback(conn, server.ID)
 
 	// Handle bidirectional communication
 	var wsMu sync.Mutex
 
+	// Forward chat and other messages the server sends on its own
+	if messages, unsubscribe, err := ch.rconManager.Subscribe(server.ID); err == nil {
+		defer unsubscribe()
+		go func() {
+			for msg := range messages {
+				ch.sendBroadcastSync(conn, &wsMu, msg)
+			}
+		}()
+	}
+
 	for {
 		_, msgBytes, err := conn.ReadMessage()
 		if err != nil {
@@ -117,15 +126,15 @@ func (ch *ConsoleHandler) HandleWebSocket(w http.ResponseWriter, r *http.Request
 				continue
 			}
 
+			start := time.Now()
 			response, err := ch.rconManager.Execute(server.ID, msg.Payload)
+			ch.history.RecordCommand(server.ID, console.SourceConsole, user, msg.Payload, response, err, time.Since(start))
 			if err != nil {
 				ch.sendErrorSync(conn, &wsMu, "command failed: "+err.Error())
-				// Try to reconnect
-				if err := ch.rconManager.Connect(server.ID, "127.0.0.1", rconPort, password); err != nil {
-					ch.sendErrorSync(conn, &wsMu, "reconnection failed, please refresh")
-					return
+				// The manager reconnects in the background
+				if !ch.rconManager.IsConnected(server.ID) {
+					ch.sendStatusSync(conn, &wsMu, "reconnecting")
 				}
-				ch.sendStatusSync(conn, &wsMu, "reconnected")
 				continue
 			}
 
@@ -181,3 +190,42 @@ func (ch *ConsoleHandler) sendResponseSync(conn *websocket.Conn, mu *sync.Mutex,
 	data, _ := json.Marshal(resp)
 	conn.WriteMessage(websocket.TextMessage, data)
 }
+
+func (ch *ConsoleHandler) sendBroadcastSync(conn *websocket.Conn, mu *sync.Mutex, msg rcon.Message) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	resp := ConsoleResponse{
+		Type:    "broadcast",
+		Payload: msg.Body,
+		Kind:    msg.Type,
+		Time:    msg.Time.Format(time.RFC3339),
+	}
+	data, _ := json.Marshal(resp)
+	conn.WriteMessage(websocket.TextMessage, data)
+}
+
+// sendScrollback replays the server's recent commands to a new session.
+func (ch *ConsoleHandler) sendScrollback(conn *websocket.Conn, serverID string) {
+	entries, err := ch.history.Scrollback(serverID, scrollbackSize)
+	if err != nil {
+		slog.Warn("failed to load console history", "serverId", serverID, "error", err)
+		return
+	}
+
+	for _, e := range entries {
+		payload := e.Response
+		if e.Error != "" {
+			payload = e.Error
+		}
+		resp := ConsoleResponse{
+			Type:    "history",
+			Payload: payload,
+			Command: e.Command,
+			User:    e.UserName,
+			Time:    e.CreatedAt.Format(time.RFC3339),
+		}
+		data, _ := json.Marshal(resp)
+		conn.WriteMessage(websocket.TextMessage, data)
+	}
+}
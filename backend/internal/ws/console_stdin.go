@@ -0,0 +1,131 @@
+package ws
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"realmops/internal/auth"
+	"realmops/internal/console"
+	"realmops/internal/models"
+)
+
+// handleStdin serves the console of packs with console.mode stdin by
+// attaching to the game process. Every output line is sent as a "response"
+// and commands are written to stdin followed by a newline. Output is not tied
+// to the command that caused it, so history entries have no response.
+//
+// The container's TTY echoes stdin back, so the echo of each command is
+// dropped from the output. Servers installed before their pack switched to
+// stdin mode have no TTY or open stdin and must be reinstalled.
+func (ch *ConsoleHandler) handleStdin(conn *websocket.Conn, server *models.Server, user *auth.User) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	ch.sendStatus(conn, "connecting")
+
+	stream, err := ch.runtime.Attach(ctx, server.DockerContainerID)
+	if err != nil {
+		ch.sendError(conn, "failed to attach to server console: "+err.Error())
+		return
+	}
+	defer stream.Close()
+
+	ch.sendStatus(conn, "connected")
+	ch.sendScrollback(conn, server.ID)
+
+	var wsMu sync.Mutex
+	echoes := &echoFilter{}
+
+	go func() {
+		reader := bufio.NewReader(stream)
+		for {
+			line, err := reader.ReadString('\n')
+			line = strings.TrimRight(line, "\r\n")
+			if line != "" && !echoes.drop(line) {
+				ch.sendResponseSync(conn, &wsMu, line)
+			}
+			if err != nil {
+				ch.sendStatusSync(conn, &wsMu, "disconnected")
+				conn.Close()
+				return
+			}
+		}
+	}()
+
+	for {
+		_, msgBytes, err := conn.ReadMessage()
+		if err != nil {
+			if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseAbnormalClosure) {
+				slog.Error("websocket read error", "error", err)
+			}
+			return
+		}
+
+		var msg ConsoleMessage
+		if err := json.Unmarshal(msgBytes, &msg); err != nil {
+			ch.sendErrorSync(conn, &wsMu, "invalid message format")
+			continue
+		}
+
+		switch msg.Type {
+		case "command":
+			if msg.Payload == "" {
+				continue
+			}
+			echoes.expect(msg.Payload)
+			_, err := stream.Write([]byte(msg.Payload + "\n"))
+			// Kept for the audit trail, without a response
+			ch.history.RecordCommand(server.ID, console.SourceConsole, user, msg.Payload, "", err, 0)
+			if err != nil {
+				ch.sendErrorSync(conn, &wsMu, "command failed: "+err.Error())
+				return
+			}
+
+		default:
+			ch.sendErrorSync(conn, &wsMu, "unknown message type")
+		}
+	}
+}
+
+// echoTimeout is how long an echo is waited for before it is given up on,
+// e.g. because the game turned echo off itself.
+const echoTimeout = 2 * time.Second
+
+// echoFilter recognizes the TTY's echo of commands written to stdin.
+type echoFilter struct {
+	mu      sync.Mutex
+	pending []pendingEcho
+}
+
+type pendingEcho struct {
+	line string
+	sent time.Time
+}
+
+func (f *echoFilter) expect(command string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.pending = append(f.pending, pendingEcho{line: strings.TrimSpace(command), sent: time.Now()})
+}
+
+// drop reports whether an output line is the echo of the oldest command
+// still waiting for one, and consumes it if so.
+func (f *echoFilter) drop(line string) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for len(f.pending) > 0 && time.Since(f.pending[0].sent) > echoTimeout {
+		f.pending = f.pending[1:]
+	}
+	if len(f.pending) == 0 || strings.TrimSpace(line) != f.pending[0].line {
+		return false
+	}
+	f.pending = f.pending[1:]
+	return true
+}
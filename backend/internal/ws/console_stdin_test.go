@@ -0,0 +1,77 @@
+package ws
+
+import (
+	"testing"
+	"time"
+)
+
+func TestEchoFilter(t *testing.T) {
+	tests := []struct {
+		name     string
+		commands []string
+		lines    []string
+		// stale expires the pending echoes before the lines arrive
+		stale bool
+		want  []string
+	}{
+		{
+			name:     "echo dropped",
+			commands: []string{"say hi"},
+			lines:    []string{"say hi", "[Server] hi"},
+			want:     []string{"[Server] hi"},
+		},
+		{
+			name:     "echoes in order",
+			commands: []string{"list", "save"},
+			lines:    []string{"list", "There are 0 players", "save", "Saved"},
+			want:     []string{"There are 0 players", "Saved"},
+		},
+		{
+			name:     "same text later is kept",
+			commands: []string{"list"},
+			lines:    []string{"list", "list"},
+			want:     []string{"list"},
+		},
+		{
+			name:  "output without a command",
+			lines: []string{"Done (3.2s)!"},
+			want:  []string{"Done (3.2s)!"},
+		},
+		{
+			name:     "echo turned off by the game",
+			commands: []string{"list"},
+			lines:    []string{"list"},
+			stale:    true,
+			want:     []string{"list"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := &echoFilter{}
+			for _, c := range tt.commands {
+				f.expect(c)
+			}
+			if tt.stale {
+				for i := range f.pending {
+					f.pending[i].sent = time.Now().Add(-2 * echoTimeout)
+				}
+			}
+
+			var got []string
+			for _, line := range tt.lines {
+				if !f.drop(line) {
+					got = append(got, line)
+				}
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("got %q, want %q", got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Fatalf("got %q, want %q", got, tt.want)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,108 @@
+package ws
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"realmops/internal/events"
+)
+
+// resyncEvent tells a client that it missed events and has to reload its
+// state before relying on the stream again.
+const resyncEvent = "resync"
+
+type EventsHandler struct {
+	bus *events.Bus
+}
+
+func NewEventsHandler(bus *events.Bus) *EventsHandler {
+	return &EventsHandler{bus: bus}
+}
+
+// HandleWebSocket streams events as JSON. The query selects them:
+// serverId (repeated or comma separated) and types (comma separated, see
+// events.Filter). A client reconnecting passes the ID of the last event it
+// got as cursor to receive what it missed.
+func (h *EventsHandler) HandleWebSocket(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	filter := events.Filter{
+		ServerIDs: splitList(query["serverId"]),
+		Types:     splitList(query["types"]),
+	}
+
+	var cursor int64
+	if v := query.Get("cursor"); v != "" {
+		c, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			http.Error(w, "invalid cursor", http.StatusBadRequest)
+			return
+		}
+		cursor = c
+	}
+
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		slog.Error("websocket upgrade failed", "error", err)
+		return
+	}
+	defer conn.Close()
+
+	sub, backlog, complete := h.bus.Subscribe(filter, cursor)
+	defer sub.Cancel()
+
+	ctx, cancel := context.WithCancel(r.Context())
+	defer cancel()
+
+	go func() {
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				cancel()
+				return
+			}
+		}
+	}()
+
+	if !complete {
+		if conn.WriteJSON(events.Event{Type: resyncEvent, Time: time.Now()}) != nil {
+			return
+		}
+	}
+	for _, e := range backlog {
+		if conn.WriteJSON(e) != nil {
+			return
+		}
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case e, ok := <-sub.C:
+			if !ok {
+				if sub.Dropped() {
+					conn.WriteJSON(events.Event{Type: resyncEvent, Time: time.Now()})
+				}
+				return
+			}
+			if conn.WriteJSON(e) != nil {
+				return
+			}
+		}
+	}
+}
+
+func splitList(values []string) []string {
+	var list []string
+	for _, v := range values {
+		for _, item := range strings.Split(v, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				list = append(list, item)
+			}
+		}
+	}
+	return list
+}
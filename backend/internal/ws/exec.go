@@ -0,0 +1,189 @@
+package ws
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/gorilla/websocket"
+	"realmops/internal/models"
+	"realmops/internal/packs"
+	"realmops/internal/runtime"
+)
+
+var defaultShell = []string{"/bin/sh"}
+
+type ExecMessage struct {
+	Type    string `json:"type"`    // "input", "resize"
+	Payload string `json:"payload"` // keystrokes for input
+	Cols    uint   `json:"cols,omitempty"`
+	Rows    uint   `json:"rows,omitempty"`
+}
+
+type ExecResponse struct {
+	Type    string `json:"type"` // "output", "exit", "error", "status"
+	Payload string `json:"payload"`
+	Time    string `json:"time"`
+}
+
+// ExecHandler attaches an interactive TTY process inside a server's running
+// container to a WebSocket, for debugging without access to the host.
+type ExecHandler struct {
+	packLoader *packs.Loader
+	runtime    runtime.Runtime
+}
+
+func NewExecHandler(packLoader *packs.Loader, containerRuntime runtime.Runtime) *ExecHandler {
+	return &ExecHandler{
+		packLoader: packLoader,
+		runtime:    containerRuntime,
+	}
+}
+
+// HandleWebSocket runs the pack's shell, or the command given through
+// repeated "cmd" query parameters. "cols" and "rows" set the initial size.
+func (eh *ExecHandler) HandleWebSocket(w http.ResponseWriter, r *http.Request, server *models.Server) {
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		slog.Error("websocket upgrade failed", "error", err)
+		return
+	}
+	defer conn.Close()
+
+	var wsMu sync.Mutex
+	send := func(msgType, payload string) error {
+		data, _ := json.Marshal(ExecResponse{
+			Type:    msgType,
+			Payload: payload,
+			Time:    time.Now().Format(time.RFC3339),
+		})
+		wsMu.Lock()
+		defer wsMu.Unlock()
+		return conn.WriteMessage(websocket.TextMessage, data)
+	}
+
+	command := r.URL.Query()["cmd"]
+	if len(command) == 0 {
+		command = defaultShell
+		manifest, err := eh.packLoader.LoadFromDir(eh.packLoader.GetPackPath(server.PackID))
+		if err == nil && len(manifest.Runtime.Shell) > 0 {
+			command = manifest.Runtime.Shell
+		}
+	}
+
+	cols, _ := strconv.ParseUint(r.URL.Query().Get("cols"), 10, 32)
+	rows, _ := strconv.ParseUint(r.URL.Query().Get("rows"), 10, 32)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	session, err := eh.runtime.Exec(ctx, server.DockerContainerID, runtime.ExecOptions{
+		Cmd:  command,
+		Env:  []string{"TERM=xterm-256color"},
+		Tty:  true,
+		Cols: uint(cols),
+		Rows: uint(rows),
+	})
+	if err != nil {
+		send("error", "failed to start process: "+err.Error())
+		return
+	}
+	defer session.Close()
+
+	send("status", "attached")
+
+	// Forward process output until it exits or the socket goes away
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		buf := make([]byte, 4096)
+		var pending []byte
+		for {
+			n, err := session.Read(buf)
+			if n > 0 {
+				var out string
+				out, pending = splitUTF8(append(pending, buf[:n]...))
+				if out != "" {
+					if send("output", out) != nil {
+						return
+					}
+				}
+			}
+			if err != nil {
+				if err != io.EOF {
+					slog.Debug("exec stream ended", "server", server.ID, "error", err)
+				}
+				code, err := session.ExitCode(ctx)
+				if err != nil {
+					send("exit", "")
+				} else {
+					send("exit", strconv.Itoa(code))
+				}
+				return
+			}
+		}
+	}()
+
+	go func() {
+		<-done
+		// Unblock ReadMessage below once the process is gone
+		wsMu.Lock()
+		conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, "process exited"))
+		wsMu.Unlock()
+		conn.Close()
+	}()
+
+	for {
+		_, msgBytes, err := conn.ReadMessage()
+		if err != nil {
+			if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseAbnormalClosure, websocket.CloseNormalClosure) {
+				slog.Error("websocket read error", "error", err)
+			}
+			return
+		}
+
+		var msg ExecMessage
+		if err := json.Unmarshal(msgBytes, &msg); err != nil {
+			send("error", "invalid message format")
+			continue
+		}
+
+		switch msg.Type {
+		case "input":
+			if _, err := session.Write([]byte(msg.Payload)); err != nil {
+				send("error", "failed to write input: "+err.Error())
+				return
+			}
+		case "resize":
+			if msg.Cols == 0 || msg.Rows == 0 {
+				continue
+			}
+			if err := session.Resize(ctx, msg.Cols, msg.Rows); err != nil {
+				send("error", "failed to resize terminal: "+err.Error())
+			}
+		default:
+			send("error", "unknown message type")
+		}
+	}
+}
+
+// splitUTF8 returns the longest prefix of b made of complete UTF-8 sequences
+// and the trailing bytes of a sequence that continues in the next read.
+func splitUTF8(b []byte) (string, []byte) {
+	end := len(b)
+	for i := len(b) - 1; i >= 0 && i >= len(b)-utf8.UTFMax; i-- {
+		if utf8.RuneStart(b[i]) {
+			if !utf8.FullRune(b[i:]) {
+				end = i
+			}
+			break
+		}
+	}
+	return string(b[:end]), append([]byte(nil), b[end:]...)
+}
@@ -1,15 +1,17 @@
 package ws
 
 import (
-	"bufio"
 	"context"
+	"encoding/json"
 	"io"
 	"log/slog"
 	"net/http"
+	"sync"
 	"time"
 
 	"github.com/gorilla/websocket"
-	"realmops/internal/docker"
+	"realmops/internal/logstream"
+	"realmops/internal/runtime"
 )
 
 var upgrader = websocket.Upgrader{
@@ -20,15 +22,56 @@ var upgrader = websocket.Upgrader{
 	},
 }
 
+const (
+	// logTail is how many lines a new stream starts with.
+	logTail = "100"
+	// logRetryDelay is the pause before reopening the logs of a container
+	// whose stream ended, e.g. because it stopped.
+	logRetryDelay = 2 * time.Second
+)
+
 type LogStreamer struct {
-	docker *docker.Provider
+	runtime runtime.Runtime
+}
+
+func NewLogStreamer(containerRuntime runtime.Runtime) *LogStreamer {
+	return &LogStreamer{runtime: containerRuntime}
+}
+
+// LogSource is a container whose output is part of a server's log stream.
+type LogSource struct {
+	// Name identifies sidecar services; empty for the game container.
+	Name        string
+	ContainerID string
 }
 
-func NewLogStreamer(dockerProvider *docker.Provider) *LogStreamer {
-	return &LogStreamer{docker: dockerProvider}
+// LogMessage is one message of a log stream: a line of output, or an error
+// reading a source.
+type LogMessage struct {
+	Type   string    `json:"type"` // log, error
+	Source string    `json:"source,omitempty"`
+	Stream string    `json:"stream,omitempty"`
+	Time   time.Time `json:"time"`
+	Text   string    `json:"text,omitempty"`
+	Error  string    `json:"error,omitempty"`
 }
 
-func (ls *LogStreamer) HandleWebSocket(w http.ResponseWriter, r *http.Request, containerID string) {
+// HandleWebSocket streams the output of the sources as LogMessages. A new
+// stream starts with the last lines of each source; clients resuming after
+// a reconnect pass the time of the last line they got as since (RFC 3339)
+// to get only what they missed.
+func (ls *LogStreamer) HandleWebSocket(w http.ResponseWriter, r *http.Request, sources []LogSource) {
+	opts := runtime.LogsOptions{Tail: logTail, Follow: true}
+	if v := r.URL.Query().Get("since"); v != "" {
+		since, err := time.Parse(time.RFC3339Nano, v)
+		if err != nil {
+			http.Error(w, "invalid since", http.StatusBadRequest)
+			return
+		}
+		opts.Tail = "all"
+		opts.Since = since
+	}
+
 	conn, err := upgrader.Upgrade(w, r, nil)
 	if err != nil {
 		slog.Error("websocket upgrade failed", "error", err)
@@ -48,36 +91,92 @@ func (ls *LogStreamer) HandleWebSocket(w http.ResponseWriter, r *http.Request, c
 		}
 	}()
 
-	logs, err := ls.docker.GetContainerLogs(ctx, containerID, "100", true)
-	if err != nil {
-		slog.Error("failed to get container logs", "error", err)
-		conn.WriteMessage(websocket.TextMessage, []byte("Error: "+err.Error()))
-		return
+	var wsMu sync.Mutex
+	send := func(msg LogMessage) error {
+		data, _ := json.Marshal(msg)
+		wsMu.Lock()
+		defer wsMu.Unlock()
+		return conn.WriteMessage(websocket.TextMessage, data)
+	}
+
+	var wg sync.WaitGroup
+	for _, source := range sources {
+		wg.Add(1)
+		go func(source LogSource) {
+			defer wg.Done()
+			if err := ls.streamContainer(ctx, source, opts, send); err != nil {
+				cancel()
+			}
+		}(source)
 	}
-	defer logs.Close()
+	wg.Wait()
+}
+
+// streamContainer sends a source's lines until ctx is done or a send fails.
+// When the container's stream ends it is reopened from the last line sent,
+// so a restarted container carries on in the same stream.
+func (ls *LogStreamer) streamContainer(ctx context.Context, source LogSource, opts runtime.LogsOptions, send func(LogMessage) error) error {
+	last := opts.Since
 
-	reader := bufio.NewReader(logs)
 	for {
+		r, err := logstream.Open(ctx, ls.runtime, source.ContainerID, opts)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			slog.Error("failed to get container logs", "containerId", source.ContainerID, "error", err)
+			return send(LogMessage{Type: "error", Source: source.Name, Time: time.Now(), Error: err.Error()})
+		}
+
+		err = ls.copyLines(ctx, r, source, last, func(line logstream.Line) error {
+			last = line.Time
+			return send(LogMessage{Type: "log", Source: source.Name, Stream: line.Stream, Time: line.Time, Text: line.Text})
+		})
+		r.Close()
+		if err != nil {
+			return err
+		}
+
 		select {
 		case <-ctx.Done():
-			return
-		default:
-			line, err := reader.ReadBytes('\n')
-			if err != nil {
-				if err == io.EOF {
-					time.Sleep(100 * time.Millisecond)
-					continue
-				}
-				return
-			}
+			return nil
+		case <-time.After(logRetryDelay):
+		}
 
-			if len(line) > 8 {
-				line = line[8:]
-			}
+		opts.Tail = "all"
+		if !last.IsZero() {
+			opts.Since = last
+		}
+	}
+}
 
-			if err := conn.WriteMessage(websocket.TextMessage, line); err != nil {
-				return
+// copyLines passes the lines after last to fn until the stream ends. Only
+// errors from fn are returned.
+func (ls *LogStreamer) copyLines(ctx context.Context, r *logstream.Reader, source LogSource, last time.Time, fn func(logstream.Line) error) error {
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			r.Close()
+		case <-done:
+		}
+	}()
+
+	for {
+		line, err := r.Next()
+		if err != nil {
+			if err != io.EOF && ctx.Err() == nil {
+				slog.Debug("container log stream interrupted", "containerId", source.ContainerID, "error", err)
 			}
+			return nil
+		}
+		// Since is inclusive, and only to the second on some engines
+		if !last.IsZero() && !line.Time.After(last) {
+			continue
+		}
+		if err := fn(line); err != nil {
+			return err
 		}
 	}
 }
@@ -2,6 +2,7 @@ import { useState, useEffect, useRef } from 'react'
 import { Button } from '../ui/button'
 import { ConnectionStatusBadge } from '../connection-status'
 import { Terminal, RefreshCw } from 'lucide-react'
+import type { LogMessage } from '../../lib/api/types'
 
 interface LogsTabProps {
   serverId: string
@@ -9,11 +10,13 @@ interface LogsTabProps {
 }
 
 export function LogsTab({ serverId, containerID }: LogsTabProps) {
-  const [logs, setLogs] = useState<string[]>([])
+  const [logs, setLogs] = useState<LogMessage[]>([])
   const [connectionError, setConnectionError] = useState(false)
   const scrollRef = useRef<HTMLDivElement>(null)
   const wsRef = useRef<WebSocket | null>(null)
   const retryTimeoutRef = useRef<number | null>(null)
+  // Time of the last line received, so a reconnect only fetches what was missed
+  const lastTimeRef = useRef<string | null>(null)
 
   useEffect(() => {
     if (!containerID) return
@@ -26,7 +29,10 @@ export function LogsTab({ serverId, containerID }: LogsTabProps) {
       )
         .replace('http', 'ws')
         .replace('/api', '')
-      const ws = new WebSocket(`${wsUrl}/api/servers/${serverId}/logs/stream`)
+      const since = lastTimeRef.current
+        ? `?since=${encodeURIComponent(lastTimeRef.current)}`
+        : ''
+      const ws = new WebSocket(`${wsUrl}/api/servers/${serverId}/logs/stream${since}`)
       wsRef.current = ws
 
       ws.onopen = () => {
@@ -34,7 +40,11 @@ export function LogsTab({ serverId, containerID }: LogsTabProps) {
       }
 
       ws.onmessage = (event) => {
-        setLogs((prev) => [...prev.slice(-500), event.data])
+        const msg: LogMessage = JSON.parse(event.data)
+        if (msg.type === 'log') {
+          lastTimeRef.current = msg.time
+        }
+        setLogs((prev) => [...prev.slice(-500), msg])
       }
 
       ws.onerror = () => {
@@ -49,6 +59,7 @@ export function LogsTab({ serverId, containerID }: LogsTabProps) {
       }
     }
 
+    lastTimeRef.current = null
     connect()
 
     return () => {
@@ -101,9 +112,13 @@ export function LogsTab({ serverId, containerID }: LogsTabProps) {
             logs.map((log, i) => (
               <div
                 key={i}
-                className="whitespace-pre-wrap break-all text-zinc-300 border-l-2 border-transparent hover:border-emerald-500/50 hover:bg-emerald-500/5 pl-2 -ml-2 py-0.5 transition-colors"
+                className={`whitespace-pre-wrap break-all ${
+                  log.type === 'error' || log.stream === 'stderr' ? 'text-red-400' : 'text-zinc-300'
+                } border-l-2 border-transparent hover:border-emerald-500/50 hover:bg-emerald-500/5 pl-2 -ml-2 py-0.5 transition-colors`}
               >
-                {log}
+                <span className="text-zinc-600">{new Date(log.time).toLocaleTimeString()} </span>
+                {log.source && <span className="text-sky-400">[{log.source}] </span>}
+                {log.type === 'error' ? `Error: ${log.error}` : log.text}
               </div>
             ))
           )}
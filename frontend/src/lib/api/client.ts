@@ -1,15 +1,42 @@
 import type {
+    Ban,
+    ConsoleCommand,
+    ConsoleHistoryEntry,
     CreatePackRequest,
     CreateServerRequest,
     CreateSSHKeyRequest,
+    EventStreamOptions,
+    ExecuteConsoleCommandRequest,
     FileEntry,
     Job,
+    LogSearchParams,
+    LogSearchResult,
+    LogSession,
     Manifest,
+    ModerationRequest,
+    ModerationResult,
+    NotificationChannel,
+    NotificationChannelRequest,
+    NotificationDelivery,
+    NotificationDeliveryParams,
+    NotificationRule,
+    NotificationRuleRequest,
+    OnlinePlayers,
+    PlayerSession,
+    PortMigration,
+    PortStatus,
+    RCONCommandRequest,
+    RCONCommandResponse,
     Server,
+    ServerModeration,
     SFTPConfig,
     SFTPStatus,
     SSHKey,
     SystemConfig,
+    Trigger,
+    TriggerRequest,
+    UpdateServerPortsRequest,
+    UpdateServerRequest,
     UpdateSFTPConfigRequest,
     UpdateSystemConfigRequest
 } from './types';
@@ -52,6 +79,11 @@ export const api = {
         method: 'PATCH',
         body: JSON.stringify(data),
       }),
+    updatePorts: (id: string, data: UpdateServerPortsRequest) =>
+      request<Server>(`/servers/${id}/ports`, {
+        method: 'PUT',
+        body: JSON.stringify(data),
+      }),
     delete: (id: string) =>
       request<void>(`/servers/${id}`, { method: 'DELETE' }),
     start: (id: string) =>
@@ -60,6 +92,68 @@ export const api = {
       request<{ status: string }>(`/servers/${id}/stop`, { method: 'POST' }),
     restart: (id: string) =>
       request<{ status: string }>(`/servers/${id}/restart`, { method: 'POST' }),
+    rcon: (id: string, data: RCONCommandRequest) =>
+      request<RCONCommandResponse>(`/servers/${id}/rcon`, {
+        method: 'POST',
+        body: JSON.stringify(data),
+      }),
+    logSessions: (id: string) => request<LogSession[]>(`/servers/${id}/logs/sessions`),
+    searchLogs: (id: string, params?: LogSearchParams) => {
+      const query = new URLSearchParams();
+      if (params?.q) query.set('q', params.q);
+      if (params?.from) query.set('from', params.from);
+      if (params?.to) query.set('to', params.to);
+      if (params?.stream) query.set('stream', params.stream);
+      if (params?.limit) query.set('limit', String(params.limit));
+      if (params?.cursor) query.set('cursor', params.cursor);
+      const qs = query.toString();
+      return request<LogSearchResult>(`/servers/${id}/logs/search${qs ? `?${qs}` : ''}`);
+    },
+    consoleCommands: (id: string) =>
+      request<ConsoleCommand[]>(`/servers/${id}/console/commands`),
+    executeConsoleCommand: (id: string, name: string, data: ExecuteConsoleCommandRequest) =>
+      request<RCONCommandResponse>(`/servers/${id}/console/commands/${encodeURIComponent(name)}`, {
+        method: 'POST',
+        body: JSON.stringify(data),
+      }),
+    consoleHistory: (id: string, params?: { limit?: number; before?: number; user?: string }) => {
+      const query = new URLSearchParams();
+      if (params?.limit) query.set('limit', String(params.limit));
+      if (params?.before) query.set('before', String(params.before));
+      if (params?.user) query.set('user', params.user);
+      const qs = query.toString();
+      return request<ConsoleHistoryEntry[]>(`/servers/${id}/console/history${qs ? `?${qs}` : ''}`);
+    },
+    players: (id: string) => request<OnlinePlayers>(`/servers/${id}/players`),
+    playerHistory: (id: string, params?: { limit?: number; before?: number; player?: string }) => {
+      const query = new URLSearchParams();
+      if (params?.limit) query.set('limit', String(params.limit));
+      if (params?.before) query.set('before', String(params.before));
+      if (params?.player) query.set('player', params.player);
+      const qs = query.toString();
+      return request<PlayerSession[]>(`/servers/${id}/players/history${qs ? `?${qs}` : ''}`);
+    },
+    moderation: (id: string) => request<ServerModeration>(`/servers/${id}/moderation`),
+    moderate: (id: string, data: ModerationRequest) =>
+      request<{ results: ModerationResult[] }>(`/servers/${id}/moderation`, {
+        method: 'POST',
+        body: JSON.stringify(data),
+      }),
+    triggers: {
+      list: (serverId: string) => request<Trigger[]>(`/servers/${serverId}/triggers`),
+      create: (serverId: string, data: TriggerRequest) =>
+        request<Trigger>(`/servers/${serverId}/triggers`, {
+          method: 'POST',
+          body: JSON.stringify(data),
+        }),
+      update: (serverId: string, triggerId: string, data: TriggerRequest) =>
+        request<Trigger>(`/servers/${serverId}/triggers/${triggerId}`, {
+          method: 'PUT',
+          body: JSON.stringify(data),
+        }),
+      delete: (serverId: string, triggerId: string) =>
+        request<void>(`/servers/${serverId}/triggers/${triggerId}`, { method: 'DELETE' }),
+    },
     jobs: (id: string) => request<Job[]>(`/servers/${id}/jobs`),
     files: {
       list: (serverId: string, path = '') =>
@@ -117,6 +211,9 @@ export const api = {
         method: 'POST',
         body: JSON.stringify({ path }),
       }),
+    bans: (id: string) => request<Ban[]>(`/packs/${id}/bans`),
+    applyBans: (id: string) =>
+      request<{ results: ModerationResult[] }>(`/packs/${id}/bans/apply`, { method: 'POST' }),
     files: {
       list: (packId: string, path = '') =>
         request<FileEntry[]>(`/packs/${packId}/files${path ? `/${path}` : ''}`),
@@ -141,11 +238,66 @@ export const api = {
   },
   jobs: {
     get: (id: string) => request<Job>(`/jobs/${id}`),
+    cancel: (id: string) => request<Job>(`/jobs/${id}/cancel`, { method: 'POST' }),
+  },
+  notifications: {
+    channels: {
+      list: () => request<NotificationChannel[]>('/notifications/channels'),
+      create: (data: NotificationChannelRequest) =>
+        request<NotificationChannel>('/notifications/channels', {
+          method: 'POST',
+          body: JSON.stringify(data),
+        }),
+      update: (id: string, data: NotificationChannelRequest) =>
+        request<NotificationChannel>(`/notifications/channels/${id}`, {
+          method: 'PUT',
+          body: JSON.stringify(data),
+        }),
+      delete: (id: string) =>
+        request<void>(`/notifications/channels/${id}`, { method: 'DELETE' }),
+      test: (id: string) =>
+        request<NotificationDelivery>(`/notifications/channels/${id}/test`, { method: 'POST' }),
+    },
+    rules: {
+      list: (channelId?: string) =>
+        request<NotificationRule[]>(
+          `/notifications/rules${channelId ? `?channel=${encodeURIComponent(channelId)}` : ''}`
+        ),
+      create: (data: NotificationRuleRequest) =>
+        request<NotificationRule>('/notifications/rules', {
+          method: 'POST',
+          body: JSON.stringify(data),
+        }),
+      update: (id: string, data: NotificationRuleRequest) =>
+        request<NotificationRule>(`/notifications/rules/${id}`, {
+          method: 'PUT',
+          body: JSON.stringify(data),
+        }),
+      delete: (id: string) =>
+        request<void>(`/notifications/rules/${id}`, { method: 'DELETE' }),
+    },
+    deliveries: (params?: NotificationDeliveryParams) => {
+      const query = new URLSearchParams();
+      if (params?.channel) query.set('channel', params.channel);
+      if (params?.server) query.set('server', params.server);
+      if (params?.status) query.set('status', params.status);
+      if (params?.limit) query.set('limit', String(params.limit));
+      if (params?.before) query.set('before', String(params.before));
+      const qs = query.toString();
+      return request<NotificationDelivery[]>(`/notifications/deliveries${qs ? `?${qs}` : ''}`);
+    },
   },
   system: {
     info: () => request<{ hostIP: string }>('/system/info'),
     sftpStatus: () => request<SFTPStatus>('/system/sftp-status'),
     config: () => request<SystemConfig>('/system/config'),
+    ports: () => request<PortStatus>('/system/ports'),
+    portMigration: () => request<PortMigration>('/system/ports/migrate'),
+    migratePorts: (serverIds?: string[]) =>
+      request<Job[]>('/system/ports/migrate', {
+        method: 'POST',
+        body: JSON.stringify({ serverIds }),
+      }),
     updateConfig: (data: UpdateSystemConfigRequest) =>
       request<SystemConfig>('/system/config', {
         method: 'PATCH',
@@ -176,9 +328,20 @@ export const api = {
   },
 };
 
-export function createLogsWebSocket(serverId: string): WebSocket {
+export function createLogsWebSocket(serverId: string, since?: string): WebSocket {
+  const protocol = window.location.protocol === 'https:' ? 'wss:' : 'ws:';
+  const qs = since ? `?since=${encodeURIComponent(since)}` : '';
+  return new WebSocket(`${protocol}//${window.location.host}/api/servers/${serverId}/logs/stream${qs}`);
+}
+
+export function createEventsWebSocket(options?: EventStreamOptions): WebSocket {
   const protocol = window.location.protocol === 'https:' ? 'wss:' : 'ws:';
-  return new WebSocket(`${protocol}//${window.location.host}/api/servers/${serverId}/logs/stream`);
+  const query = new URLSearchParams();
+  if (options?.serverIds?.length) query.set('serverId', options.serverIds.join(','));
+  if (options?.types?.length) query.set('types', options.types.join(','));
+  if (options?.cursor) query.set('cursor', String(options.cursor));
+  const qs = query.toString();
+  return new WebSocket(`${protocol}//${window.location.host}/api/events${qs ? `?${qs}` : ''}`);
 }
 
 export function createConsoleWebSocket(serverId: string): WebSocket {
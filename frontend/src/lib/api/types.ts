@@ -7,14 +7,31 @@ export interface ServerStats {
   memoryPercent: number;
 }
 
+export type RCONState = 'connecting' | 'connected' | 'reconnecting' | 'disconnected';
+
+export interface RCONStatus {
+  state: RCONState;
+  protocol?: string;
+  users: number;
+  connectedAt?: string;
+  reconnects: number;
+  lastError?: string;
+}
+
 export interface ServerPort {
   serverId: string;
+  service?: string;
   name: string;
   protocol: string;
   containerPort: number;
   hostPort: number;
 }
 
+export interface ServerService {
+  name: string;
+  containerId: string;
+}
+
 export interface Server {
   id: string;
   name: string;
@@ -25,7 +42,10 @@ export interface Server {
   desiredState: ServerState;
   dockerContainerId?: string;
   ports: ServerPort[];
+  services?: ServerService[];
+  networks: string[];
   stats?: ServerStats;
+  rcon?: RCONStatus;
   createdAt: string;
   updatedAt: string;
 }
@@ -48,10 +68,14 @@ export interface PortConfig {
   protocol: string;
   hostPortMode: string;
   description: string;
+  offsetFrom?: string;
+  offset?: number;
+  sameAs?: string;
 }
 
 export interface RCONConfig {
   enabled: boolean;
+  protocol?: 'source' | 'webrcon';
   portName: string;
   passwordVariable: string;
 }
@@ -62,6 +86,98 @@ export interface RuntimeConfig {
   user?: string;
   env?: Record<string, string>;
   entrypoint?: string[];
+  shell?: string[];
+}
+
+export interface PlayerListConfig {
+  command: string;
+  pattern: string;
+  interval?: number;
+}
+
+export interface PlayersConfig {
+  list?: PlayerListConfig;
+  join?: string;
+  leave?: string;
+}
+
+export type ModerationActionName =
+  | 'kick'
+  | 'ban'
+  | 'unban'
+  | 'whitelistAdd'
+  | 'whitelistRemove'
+  | 'op'
+  | 'deop';
+
+export interface ModerationFile {
+  path: string;
+  format: 'lines' | 'json';
+  field?: string;
+  uuid?: 'mojang' | 'offline';
+  fields?: Record<string, unknown>;
+}
+
+export interface ModerationAction {
+  command?: string;
+  file?: ModerationFile;
+}
+
+export type ModerationConfig = Partial<Record<ModerationActionName, ModerationAction>>;
+
+export type TriggerAction = 'restart' | 'backup' | 'rcon' | 'webhook';
+
+export interface TriggerConfig {
+  name: string;
+  pattern: string;
+  action: TriggerAction;
+  cooldown?: number;
+  command?: string;
+  url?: string;
+}
+
+export interface Trigger extends TriggerConfig {
+  id: string;
+  serverId: string;
+  source: 'pack' | 'user';
+  cooldown: number;
+  enabled: boolean;
+  lastFiredAt?: string;
+  createdAt?: string;
+}
+
+export interface TriggerRequest extends TriggerConfig {
+  enabled?: boolean;
+}
+
+export interface ConsoleConfig {
+  mode?: 'rcon' | 'stdin';
+  commands?: ConsoleCommand[];
+}
+
+export interface CommandParam {
+  name: string;
+  label: string;
+  description?: string;
+  type: 'string' | 'number' | 'boolean' | 'select' | 'player';
+  required: boolean;
+  default?: unknown;
+  options?: string[];
+  min?: number;
+  max?: number;
+}
+
+export interface ConsoleCommand {
+  name: string;
+  description: string;
+  template: string;
+  dangerous: boolean;
+  params: CommandParam[] | null;
+}
+
+export interface ExecuteConsoleCommandRequest {
+  params?: Record<string, unknown>;
+  confirm?: boolean;
 }
 
 export interface StorageConfig {
@@ -124,6 +240,26 @@ export interface ModsConfig {
   applyWhileRunning?: boolean;
 }
 
+export interface ServiceMount {
+  source?: string;
+  target: string;
+  readOnly?: boolean;
+}
+
+export interface ServiceConfig {
+  name: string;
+  description?: string;
+  image: string;
+  workdir?: string;
+  user?: string;
+  env?: Record<string, string>;
+  command?: string[];
+  entrypoint?: string[];
+  ports?: PortConfig[];
+  mounts?: ServiceMount[];
+  startOrder?: 'before' | 'after';
+}
+
 export interface Manifest {
   id: string;
   name: string;
@@ -140,6 +276,11 @@ export interface Manifest {
   shutdown?: ShutdownConfig;
   mods?: ModsConfig;
   rcon?: RCONConfig;
+  console?: ConsoleConfig;
+  players?: PlayersConfig;
+  moderation?: ModerationConfig;
+  triggers?: TriggerConfig[];
+  services?: ServiceConfig[];
 }
 
 export interface CreatePackRequest {
@@ -158,6 +299,11 @@ export interface CreatePackRequest {
   shutdown?: ShutdownConfig;
   mods?: ModsConfig;
   rcon?: RCONConfig;
+  console?: ConsoleConfig;
+  players?: PlayersConfig;
+  moderation?: ModerationConfig;
+  triggers?: TriggerConfig[];
+  services?: ServiceConfig[];
 }
 
 export interface GamePack {
@@ -168,8 +314,8 @@ export interface GamePack {
   installedAt: string;
 }
 
-export type JobStatus = 'pending' | 'running' | 'completed' | 'failed';
-export type JobType = 'install' | 'update' | 'backup' | 'restore' | 'mod_apply';
+export type JobStatus = 'pending' | 'running' | 'completed' | 'failed' | 'canceled';
+export type JobType = 'install' | 'update' | 'backup' | 'restore' | 'mod_apply' | 'port_migrate';
 
 export interface Job {
   id: string;
@@ -178,6 +324,8 @@ export interface Job {
   status: JobStatus;
   progress: number;
   logs: string;
+  attempts: number;
+  nextRunAt?: string;
   createdAt: string;
   updatedAt: string;
 }
@@ -192,11 +340,18 @@ export interface CreateServerRequest {
   name: string;
   packId: string;
   variables: Record<string, unknown>;
+  networks?: string[];
+  ports?: Record<string, number>;
 }
 
 export interface UpdateServerRequest {
   name?: string;
   variables?: Record<string, unknown>;
+  networks?: string[];
+}
+
+export interface UpdateServerPortsRequest {
+  ports: Record<string, number>;
 }
 
 export interface ConsoleMessage {
@@ -204,12 +359,220 @@ export interface ConsoleMessage {
   payload: string;
 }
 
+export interface LogMessage {
+  type: 'log' | 'error';
+  source?: string;
+  stream?: 'stdout' | 'stderr';
+  time: string;
+  text?: string;
+  error?: string;
+}
+
+export type ServerEventType =
+  | 'server.state'
+  | 'server.health'
+  | 'server.crashed'
+  | 'job.created'
+  | 'job.started'
+  | 'job.progress'
+  | 'job.completed'
+  | 'job.failed'
+  | 'job.retrying'
+  | 'job.canceled'
+  | 'backup.completed'
+  | 'sftp.session_started'
+  | 'sftp.session_ended'
+  | 'resync';
+
+export interface ServerEvent {
+  id: number;
+  type: ServerEventType;
+  serverId?: string;
+  time: string;
+  data?: Record<string, unknown>;
+}
+
+export interface EventStreamOptions {
+  serverIds?: string[];
+  types?: string[];
+  cursor?: number;
+}
+
+export type NotificationChannelType = 'discord' | 'slack' | 'webhook';
+
+export interface NotificationChannel {
+  id: string;
+  name: string;
+  type: NotificationChannelType;
+  url: string;
+  hasSecret: boolean;
+  enabled: boolean;
+  createdAt: string;
+}
+
+export interface NotificationChannelRequest {
+  name: string;
+  type: NotificationChannelType;
+  url: string;
+  // An empty secret keeps the current one
+  secret?: string;
+  enabled?: boolean;
+}
+
+export interface NotificationRule {
+  id: string;
+  channelId: string;
+  serverId?: string;
+  events: string[];
+  createdAt: string;
+}
+
+export interface NotificationRuleRequest {
+  channelId: string;
+  serverId?: string;
+  events: string[];
+}
+
+export type NotificationDeliveryStatus = 'pending' | 'delivered' | 'failed';
+
+export interface NotificationDelivery {
+  id: number;
+  channelId: string;
+  eventId: number;
+  eventType: string;
+  serverId?: string;
+  status: NotificationDeliveryStatus;
+  attempts: number;
+  responseCode?: number;
+  error?: string;
+  createdAt: string;
+  updatedAt: string;
+  deliveredAt?: string;
+}
+
+export interface NotificationDeliveryParams {
+  channel?: string;
+  server?: string;
+  status?: NotificationDeliveryStatus;
+  limit?: number;
+  before?: number;
+}
+
+export interface Player {
+  name: string;
+  id?: string;
+  joinedAt: string;
+}
+
+export interface OnlinePlayers {
+  count: number;
+  players: Player[];
+}
+
+export interface PlayerSession {
+  id: number;
+  serverId: string;
+  playerName: string;
+  playerId?: string;
+  joinedAt: string;
+  leftAt?: string;
+}
+
+export interface LogSession {
+  id: string;
+  containerId: string;
+  startedAt: string;
+  endedAt?: string;
+  lastLineAt?: string;
+  files: number;
+  size: number;
+}
+
+export interface LogMatch {
+  session: string;
+  containerId: string;
+  stream: 'stdout' | 'stderr';
+  time: string;
+  text: string;
+}
+
+export interface LogSearchResult {
+  matches: LogMatch[];
+  nextCursor?: string;
+}
+
+export interface LogSearchParams {
+  q?: string;
+  from?: string;
+  to?: string;
+  stream?: 'stdout' | 'stderr';
+  limit?: number;
+  cursor?: string;
+}
+
+export interface Ban {
+  id: number;
+  packId: string;
+  serverId?: string;
+  player: string;
+  reason?: string;
+  createdBy?: string;
+  createdAt: string;
+}
+
+export interface ServerModeration {
+  actions: ModerationActionName[];
+  bans: Ban[];
+}
+
+export interface ModerationRequest {
+  action: ModerationActionName;
+  player: string;
+  reason?: string;
+  allServers?: boolean;
+}
+
+export interface ModerationResult {
+  serverId: string;
+  serverName: string;
+  method?: 'rcon' | 'file';
+  response?: string;
+  error?: string;
+}
+
+export interface RCONCommandRequest {
+  command: string;
+  timeoutMs?: number;
+}
+
+export interface RCONCommandResponse {
+  command: string;
+  response: string;
+  durationMs: number;
+}
+
 export interface ConsoleResponse {
-  type: 'response' | 'error' | 'status';
+  type: 'response' | 'error' | 'status' | 'broadcast' | 'history';
   payload: string;
+  kind?: string;
+  command?: string;
+  user?: string;
   time: string;
 }
 
+export interface ConsoleHistoryEntry {
+  id: number;
+  serverId: string;
+  userId?: string;
+  userName?: string;
+  source: 'console' | 'api';
+  command: string;
+  response?: string;
+  error?: string;
+  durationMs: number;
+  createdAt: string;
+}
+
 // SSH Key types
 export interface SSHKey {
   id: string;
@@ -261,7 +624,11 @@ export interface SystemConfigRunning {
   sftpPort: number;
   portRangeStart: number;
   portRangeEnd: number;
+  portExclude: string;
+  portProbe: boolean;
   dockerHost: string;
+  containerRuntime: 'docker' | 'podman';
+  podmanHost: string;
   dataDir: string;
   databasePath: string;
   packsDir: string;
@@ -272,7 +639,10 @@ export interface SystemConfigSaved {
   sftpPort?: string;
   portRangeStart?: number;
   portRangeEnd?: number;
+  portExclude?: string;
   dockerHost?: string;
+  containerRuntime?: 'docker' | 'podman';
+  podmanHost?: string;
 }
 
 export interface SystemConfig {
@@ -287,5 +657,54 @@ export interface UpdateSystemConfigRequest {
   sftpPort?: number;
   portRangeStart?: number;
   portRangeEnd?: number;
+  portExclude?: string;
   dockerHost?: string;
+  containerRuntime?: 'docker' | 'podman';
+  podmanHost?: string;
+}
+
+// Port allocation types
+export interface PortReservation {
+  hostPort: number;
+  serverId: string;
+  serverName?: string;
+  portName?: string;
+  protocol?: string;
+  reservedAt: string;
+}
+
+export interface PortConflict {
+  hostPort: number;
+  serverId: string;
+  reason: string;
+}
+
+export interface PortRangeStats {
+  start: number;
+  end: number;
+  total: number;
+  reserved: number;
+  excluded: number;
+  free: number;
+}
+
+export interface PortStatus {
+  range: PortRangeStats;
+  probe: boolean;
+  excluded: number[];
+  reservations: PortReservation[];
+  conflicts: PortConflict[];
+}
+
+export interface OutOfRangeServer {
+  serverId: string;
+  serverName: string;
+  state: ServerState;
+  ports: ServerPort[];
+}
+
+export interface PortMigration {
+  rangeStart: number;
+  rangeEnd: number;
+  servers: OutOfRangeServer[];
 }